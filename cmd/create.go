@@ -14,8 +14,10 @@ var createCmd = &cobra.Command{
 	Use:   "create",
 	Short: "Creates a migration file",
 	Long: `Creates migration files with the installed version (timestamped) and name in directory [--path/-p]
-For the format [--format / -f] 'sql', two files with up/down postfixes are created, 
-and for the 'go' format a go-file with 'Up*/Down*'' methods is generated`,
+For the format [--format / -f] 'sql', two files with up/down postfixes are created
+(or a single file with '-- +migrate Up' and '-- +migrate Down' sections for [--sql-layout] 'single'),
+and for the 'go' format a go-file with 'Up*/Down*'' methods is generated.
+For the 'mixed' format sql files are created, pass [--format / -f] 'golang' to create a go migration`,
 	Example: "migrator create <name> [flags]",
 	Run: func(_ *cobra.Command, args []string) {
 		ctx, cancelFunc := context.WithCancel(context.Background())
@@ -24,6 +26,11 @@ and for the 'go' format a go-file with 'Up*/Down*'' methods is generated`,
 }
 
 func init() {
+	createCmd.Flags().StringVar(
+		&cfg.SQLLayout,
+		"sql-layout",
+		"",
+		"layout of a new sql migration (\"split\" - up/down files, \"single\" - one file with sections)")
 	rootCmd.AddCommand(createCmd)
 }
 
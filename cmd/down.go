@@ -18,13 +18,20 @@ var downCmd = &cobra.Command{
 	Use:   "down",
 	Short: "Roll back of one or all or <version> down migrations",
 	Long: `Roll back of one or all or <version> down migrations since the last applied migration.
-You can specify which version to roll back migrations to (the version is a starting point and may not exist)
+You can specify which version to roll back migrations to (the version is a starting point and may not exist):
+the migration with this version and the migrations applied after it (in dependency order) are rolled back,
+for a version that is not applied - the migrations with greater or equal versions
 Command accepts all common flags. 
 Depending on the format of the migrations, she can run the SQL file herself 
 or build a program (golang) for executing and applying migrations
 
-If parallel migration start is allowed in the settings, then parallel migrations are possible.
-Attention, while the consistency of the database may suffer!`,
+Parallel runs are serialized with a database lock: the command waits until the lock
+held by another migrator is released, but no longer than [--lock-timeout]
+
+Rolling back across an applied migration whose file (or down file) is missing fails,
+unless [--force] is specified
+
+Tagged migrations can be limited with [--tags] and skipped with [--exclude-tags]`,
 	SilenceUsage: true,
 	Example:      "migrator down <version> [all] [flags] - where <version> is the version request",
 	Run: func(_ *cobra.Command, args []string) {
@@ -34,6 +41,12 @@ Attention, while the consistency of the database may suffer!`,
 }
 
 func init() {
+	downCmd.Flags().BoolVar(
+		&cfg.Force,
+		"force",
+		false,
+		"roll back migrations whose files are missing by marking them as rolled back without running them")
+	addTagFlags(downCmd)
 	rootCmd.AddCommand(downCmd)
 }
 
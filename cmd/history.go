@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/BashMS/SQL_migrator/internal/converter" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/report"    //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"         //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/migrate"        //nolint:depguard
+	"github.com/spf13/cobra"                            //nolint:depguard
+	"go.uber.org/zap"                                   //nolint:depguard
+)
+
+const defaultHistoryLimit = 50
+
+var historyLimit int
+
+// historyCmd команда вывода журнала выполнения миграций.
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Displays the log of up/down executions of migrations",
+	Long: `Output the append-only log of migration executions, newest first.
+Every up and down of a migration is recorded with its direction, start time, duration, outcome, error text,
+the OS user, the database role, the hostname and the version of the migrator that ran it.
+If <version> is specified, only the executions of that migration are displayed`,
+	SilenceUsage: true,
+	Example:      "migrator history [version] [--limit N] [flags]",
+	Run: func(_ *cobra.Command, args []string) {
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		runMigrate(ctx, cancelFunc, History, args...)
+	},
+}
+
+func init() {
+	historyCmd.Flags().IntVarP(&historyLimit, "limit", "l", defaultHistoryLimit,
+		"maximum number of records to display (0 - all)")
+	rootCmd.AddCommand(historyCmd)
+}
+
+// History - выводит журнал выполнения миграций.
+func History(ctx context.Context, migrator migrate.Migrate, logger *zap.Logger, args ...string) error {
+	var (
+		version uint64
+		err     error
+	)
+	if len(args) > 0 {
+		version, err = converter.VersionToUint(args[0])
+		if err != nil {
+			return domain.ErrMigrateVersionIncorrect
+		}
+	}
+
+	executions, err := migrator.History(ctx, version, historyLimit)
+	if err != nil {
+		return err
+	}
+
+	if len(executions) == 0 {
+		logger.Warn("no migration executions found")
+		return nil
+	}
+
+	report.PrintExecutions(executions)
+	return nil
+}
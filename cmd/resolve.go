@@ -0,0 +1,56 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BashMS/SQL_migrator/internal/converter" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"         //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/migrate"        //nolint:depguard
+	"github.com/spf13/cobra"                            //nolint:depguard
+	"go.uber.org/zap"                                   //nolint:depguard
+)
+
+var errResolveArgs = errors.New("version and status are required")
+
+// resolveCmd команда разрешения незавершенной миграции.
+var resolveCmd = &cobra.Command{
+	Use:   "resolve",
+	Short: "Marks a dirty migration as applied or rolled back",
+	Long: `If the migrator was interrupted while a migration was running, the migration stays in the "running" state
+and is marked as dirty: 'up', 'down' and 'redo' refuse to run until it is resolved.
+Check the database manually, finish or revert the changes of the migration and then set its real state:
+applied - the changes of the migration are present in the database
+rolled_back - the changes of the migration are absent from the database`,
+	SilenceUsage: true,
+	Example:      "migrator resolve <version> <applied|rolled_back> [flags]",
+	ValidArgs:    []string{string(domain.StatusApplied), string(domain.StatusRolledBack)},
+	Run: func(_ *cobra.Command, args []string) {
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		runMigrate(ctx, cancelFunc, Resolve, args...)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resolveCmd)
+}
+
+// Resolve - устанавливает состояние незавершенной миграции.
+func Resolve(ctx context.Context, migrator migrate.Migrate, logger *zap.Logger, args ...string) error {
+	if len(args) < 2 {
+		return errResolveArgs
+	}
+	version, err := converter.VersionToUint(args[0])
+	if err != nil || version == 0 {
+		return domain.ErrMigrateVersionIncorrect
+	}
+	status := domain.MigrationStatus(args[1])
+
+	if err := migrator.Resolve(ctx, version, status); err != nil {
+		return err
+	}
+	logger.Info(fmt.Sprintf("migration %d is marked as %s", version, status))
+
+	return nil
+}
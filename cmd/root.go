@@ -19,11 +19,12 @@ import (
 const timeoutShutdown = 3 * time.Second
 
 // AppVersion - версия.
-const AppVersion = "0.0.1"
+const AppVersion = config.AppVersion
 
 var (
 	configFile string
 	cfg        config.Config
+	vars       []string
 )
 
 // rootCmd базовая команда при вызове без каких-либо подкоманд.
@@ -38,6 +39,10 @@ Capabilities:
 	* down - roll back migrations
 	* redo - repetition of the last applied migration (down and up again)
 	* status - displays the status of migrations in a table
+	* history - displays the log of up/down executions of migrations
+	* verify - check that applied migrations have not been modified
+	* validate - check the migration directory without a database
+	* resolve - mark a dirty (interrupted) migration as applied or rolled back
 	* version - output current version of migration
 `,
 	Version: AppVersion,
@@ -49,6 +54,9 @@ Capabilities:
 		} else if cfg.ReadConfigFromDefaultPath() {
 			fmt.Println("default configuration file loaded successfully")
 		}
+		if err := cfg.SetVars(vars); err != nil {
+			return err
+		}
 		cfg.Apply()
 		return cfg.PathConversion()
 	},
@@ -59,7 +67,13 @@ func init() {
 	var err error
 	rootCmd.PersistentFlags().StringVarP(&configFile, "config", "c", "", "path to configuration file")
 	rootCmd.PersistentFlags().StringVar(&cfg.DSN, "dsn", "", "database connection string (Data Source Name or DSN)")
-	rootCmd.PersistentFlags().StringVarP(&cfg.Path, "path", "p", "", "absolute path to the migration folder")
+	rootCmd.PersistentFlags().StringSliceVarP(
+		&cfg.Paths,
+		"path",
+		"p",
+		nil,
+		"path to the migration folder; repeat the flag or separate paths with commas to merge several folders, "+
+			"globs (modules/*/migrations) are expanded")
 
 	flagFormat := "format"
 	rootCmd.PersistentFlags().StringVarP(
@@ -67,17 +81,40 @@ func init() {
 		flagFormat,
 		"f",
 		"",
-		"format of migrations (\"sql\", \"golang\")")
+		"format of migrations (\"sql\", \"golang\" or \"mixed\" for sql and go migrations in one folder)")
 	err = rootCmd.RegisterFlagCompletionFunc(
 		flagFormat,
 		func(_ *cobra.Command, _ []string, _ string) ([]string, cobra.ShellCompDirective) {
-			return []string{config.FormatSQL, config.FormatGolang}, cobra.ShellCompDirectiveDefault
+			return []string{config.FormatSQL, config.FormatGolang, config.FormatMixed}, cobra.ShellCompDirectiveDefault
 		})
 	if err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
 
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.TableSchema,
+		"table-schema",
+		"",
+		"schema of the migration history table (default \"public\")")
+	rootCmd.PersistentFlags().StringVar(
+		&cfg.TableName,
+		"table-name",
+		"",
+		"name of the migration history table (default \"tmigration\")")
+
+	rootCmd.PersistentFlags().DurationVar(
+		&cfg.LockTimeout,
+		"lock-timeout",
+		0,
+		"how long to wait for a lock held by another running migrator (e.g. \"30s\", \"2m\")")
+
+	rootCmd.PersistentFlags().StringArrayVar(
+		&vars,
+		"var",
+		nil,
+		"template variable of sql migrations in the form key=value, available as {{ .Vars.key }} (can be repeated)")
+
 	rootCmd.PersistentFlags().StringVar(&cfg.LogPath, "log-path", "", "absolute path to the log")
 
 	flagLogLevel := "log-level"
@@ -111,6 +148,20 @@ func Execute() {
 	}
 }
 
+// addTagFlags - добавляет команде флаги фильтра миграций по тегам.
+func addTagFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(
+		&cfg.Tags,
+		"tags",
+		nil,
+		"only tagged migrations with at least one of these tags (untagged migrations are always included)")
+	cmd.Flags().StringSliceVar(
+		&cfg.ExcludeTags,
+		"exclude-tags",
+		nil,
+		"skip migrations with at least one of these tags")
+}
+
 // migrateFunc реализация функции работы с мигратором.
 type migrateFunc func(ctx context.Context, migrator migrate.Migrate, logger *zap.Logger, args ...string) error
 
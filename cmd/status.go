@@ -17,8 +17,21 @@ var statusCmd = &cobra.Command{
 Data is taken from the migration table and contains the following fields:
 Version - migration version (may contain only numbers)
 Name - human-readable name of migration
-Is applied? - migration status (applied or not applied)
+Status - migration state:
+	pending - the migration is registered but has never been applied
+	running - the migration is being applied or rolled back right now
+	applied - the migration is applied
+	failed - the last attempt to apply or roll back the migration failed (its transaction was rolled back)
+	rolled_back - the migration is rolled back
+	(dirty) - the run was interrupted, further migrations are blocked until 'migrator resolve' is used
+	(missing) - the migration is applied, but its file has been deleted or renamed
 Data update - Last update date at which any actions on migration were performed (for example, up, down, redo)
+Tags - migration tags (use [--tags] and [--exclude-tags] to filter the table)
+
+Repeatable migrations (R_<name>.sql) are listed in a separate table:
+	pending - the migration has never been applied
+	applied - the migration is applied and its file has not changed since
+	outdated - the file has changed, the migration will be re-applied by the next 'migrator up'
 `,
 	Run: func(_ *cobra.Command, _ []string) {
 		ctx, cancelFunc := context.WithCancel(context.Background())
@@ -27,6 +40,7 @@ Data update - Last update date at which any actions on migration were performed
 }
 
 func init() {
+	addTagFlags(statusCmd)
 	rootCmd.AddCommand(statusCmd)
 }
 
@@ -36,12 +50,22 @@ func Status(ctx context.Context, migrator migrate.Migrate, logger *zap.Logger, _
 	if err != nil {
 		return err
 	}
+	repeatableMigrations, err := migrator.RepeatableStatus(ctx)
+	if err != nil {
+		return err
+	}
 
-	if len(migrations) == 0 {
+	if len(migrations) == 0 && len(repeatableMigrations) == 0 {
 		logger.Warn("no migration found")
 		return nil
 	}
 
-	report.PrintMigrations(migrations)
+	if len(migrations) != 0 {
+		report.PrintMigrations(migrations)
+	}
+	if len(repeatableMigrations) != 0 {
+		report.PrintRepeatableMigrations(repeatableMigrations)
+	}
+
 	return nil
 }
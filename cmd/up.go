@@ -21,8 +21,14 @@ Command accepts all common flags.
 Depending on the format of the migrations, she can run the SQL file herself 
 or build a program (golang) for executing and applying migrations
 
-If parallel migration start is allowed in the settings, then parallel migrations are possible.
-Attention, while the consistency of the database may suffer!
+Parallel runs are serialized with a database lock: the command waits until the lock
+held by another migrator is released, but no longer than [--lock-timeout]
+
+Pending migrations with versions below the latest applied one (for example, merged from a long-lived branch)
+are skipped with a warning. In CI mode [--ci] the command fails instead;
+use [--allow-out-of-order] to apply them in version order
+
+Tagged migrations can be limited with [--tags] and skipped with [--exclude-tags]
 `,
 	SilenceUsage: true,
 	Example:      "migrator up <version> [flags] - where <version> is the version request",
@@ -33,6 +39,23 @@ Attention, while the consistency of the database may suffer!
 }
 
 func init() {
+	upCmd.Flags().BoolVar(
+		&cfg.AllowModified,
+		"allow-modified",
+		false,
+		"apply migrations even if files of already applied migrations have been modified")
+	upCmd.Flags().BoolVar(
+		&cfg.AllowOutOfOrder,
+		"allow-out-of-order",
+		false,
+		"apply pending migrations with versions below the latest applied migration (in version order)")
+	upCmd.Flags().BoolVar(
+		&cfg.CI,
+		"ci",
+		false,
+		"fail if pending migrations have versions below the latest applied migration "+
+			"(enabled automatically when the CI environment variable is set)")
+	addTagFlags(upCmd)
 	rootCmd.AddCommand(upCmd)
 }
 
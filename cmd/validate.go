@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BashMS/SQL_migrator/pkg/domain"  //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/migrate" //nolint:depguard
+	"github.com/spf13/cobra"                     //nolint:depguard
+	"go.uber.org/zap"                            //nolint:depguard
+)
+
+// validateCmd команда проверки каталога миграций.
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Checks the migration directory without a database",
+	Long: `Checks the migration files offline and prints every problem found:
+unparsable file names, duplicate versions, up and down files with different names,
+missing up or down files, empty up migrations and Go migrations that do not compile.
+Exits with a non-zero code if any problem is found, so it can be used as a CI step`,
+	SilenceUsage: true,
+	Run: func(_ *cobra.Command, _ []string) {
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		runMigrate(ctx, cancelFunc, Validate)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+}
+
+// Validate - проверяет каталог миграций.
+func Validate(ctx context.Context, migrator migrate.Migrate, logger *zap.Logger, _ ...string) error {
+	problems, err := migrator.Validate(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(problems) == 0 {
+		logger.Info("migration directory is valid")
+		return nil
+	}
+
+	for _, problem := range problems {
+		logger.Error(problem.Error())
+	}
+	return fmt.Errorf("%w: %d problem(s)", domain.ErrInvalidMigrations, len(problems))
+}
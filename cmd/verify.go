@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/BashMS/SQL_migrator/internal/report" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"      //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/migrate"     //nolint:depguard
+	"github.com/spf13/cobra"                         //nolint:depguard
+	"go.uber.org/zap"                                //nolint:depguard
+)
+
+// verifyCmd команда проверки контрольных сумм.
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "Checks that applied migrations have not been modified",
+	Long: `Compares the SHA-256 checksum of every applied migration stored in the migration table 
+with the checksum of its file on disk and lists the migrations whose files no longer match.
+Migrations applied before checksums were introduced are not checked.
+The same check is performed automatically before 'up' (see the [--allow-modified] flag)`,
+	SilenceUsage: true,
+	Run: func(_ *cobra.Command, _ []string) {
+		ctx, cancelFunc := context.WithCancel(context.Background())
+		runMigrate(ctx, cancelFunc, Verify)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// Verify - проверяет контрольные суммы примененных миграций.
+func Verify(ctx context.Context, migrator migrate.Migrate, logger *zap.Logger, _ ...string) error {
+	modified, err := migrator.Verify(ctx)
+	if err != nil {
+		return err
+	}
+
+	if len(modified) == 0 {
+		logger.Info("all applied migrations match their files")
+		return nil
+	}
+
+	report.PrintMigrations(modified)
+	return fmt.Errorf("%w: %d migration(s)", domain.ErrMigrationsModified, len(modified))
+}
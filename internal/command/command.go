@@ -12,6 +12,7 @@ type (
 	Command interface {
 		Run(ctx context.Context, name string, args Args, dir string, env Env) error
 		RunWithGracefulShutdown(ctx context.Context, name string, args Args, dir string, env Env) error
+		Output(ctx context.Context, name string, args Args, dir string, env Env) ([]byte, error)
 	}
 	command struct{}
 
@@ -74,6 +75,18 @@ func (c *command) RunWithGracefulShutdown(ctx context.Context, name string, args
 	return nil
 }
 
+// Output - выполнить в определенном каталоге и среде и вернуть стандартный вывод команды.
+func (c *command) Output(ctx context.Context, name string, args Args, dir string, env Env) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	c.apply(cmd, dir, env).Stdout = nil
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("`%s %v` failed: %w", name, args, err)
+	}
+
+	return output, nil
+}
+
 func (c *command) apply(cmd *exec.Cmd, dir string, env []string) *exec.Cmd {
 	if len(env) > 0 {
 		cmd.Env = append(cmd.Env, env...)
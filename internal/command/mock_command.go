@@ -38,3 +38,24 @@ func (_m *MockCommand) RunWithGracefulShutdown(ctx context.Context, name string,
 
 	return r0
 }
+
+// Output provides a mock function with given fields: ctx, name, args, dir, env.
+func (_m *MockCommand) Output(ctx context.Context, name string, args Args, dir string, env Env) ([]byte, error) {
+	ret := _m.Called(ctx, name, args, dir, env)
+
+	var r0 []byte
+	if rf, ok := ret.Get(0).(func(context.Context, string, Args, string, Env) []byte); ok {
+		r0 = rf(ctx, name, args, dir, env)
+	} else if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]byte)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, Args, string, Env) error); ok {
+		r1 = rf(ctx, name, args, dir, env)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
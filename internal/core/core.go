@@ -4,20 +4,24 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
 	"os"
+	"os/user"
 	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/coreos/etcd/pkg/fileutil" //nolint:depguard
 	"github.com/iancoleman/strcase"       //nolint:depguard
 	"github.com/jackc/pgconn"             //nolint:depguard
-	"github.com/jackc/pgx/v4"             //nolint:depguard
 	"go.uber.org/zap"                     //nolint:depguard
 
 	"github.com/BashMS/SQL_migrator/internal/command"   //nolint:depguard
 	"github.com/BashMS/SQL_migrator/internal/converter" //nolint:depguard
 	"github.com/BashMS/SQL_migrator/internal/loader"    //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/splitter"  //nolint:depguard
 	"github.com/BashMS/SQL_migrator/internal/storage"   //nolint:depguard
 	"github.com/BashMS/SQL_migrator/internal/template"  //nolint:depguard
 	"github.com/BashMS/SQL_migrator/internal/util"      //nolint:depguard
@@ -26,6 +30,9 @@ import (
 	"github.com/BashMS/SQL_migrator/pkg/logger"         //nolint:depguard
 )
 
+// sqlSectionsSample - содержимое нового sql-файла миграции с секциями наката и отката.
+const sqlSectionsSample = "-- +migrate " + loader.DirectiveUp + "\n\n-- +migrate " + loader.DirectiveDown + "\n"
+
 type (
 	DeferFunc func()
 
@@ -36,6 +43,10 @@ type (
 		logger  *zap.Logger
 		config  *config.Config
 		loader  loader.Loader
+		// fsys - источник файлов миграций вместо каталога config.Path (например, embed.FS).
+		fsys fs.FS
+		// registered - миграции, зарегистрированные в приложении, по версиям.
+		registered map[uint64]RegisteredMigration
 	}
 )
 
@@ -56,6 +67,11 @@ func NewMigrateCore(
 	}
 }
 
+// SetFS - загружать миграции из fsys (например, embed.FS) вместо каталога config.Path.
+func (mc *MigrateCore) SetFS(fsys fs.FS) {
+	mc.fsys = fsys
+}
+
 // ConnectDB - соединение с БД.
 func (mc *MigrateCore) ConnectDB(ctx context.Context) (DeferFunc, error) {
 	if err := mc.storage.Connect(ctx); err != nil {
@@ -65,27 +81,44 @@ func (mc *MigrateCore) ConnectDB(ctx context.Context) (DeferFunc, error) {
 	return mc.storage.Close, nil
 }
 
+// Lock - устанавливает блокировку на время выполнения миграций,
+// чтобы параллельно запущенные миграторы не изменяли таблицу миграций одновременно.
+func (mc *MigrateCore) Lock(ctx context.Context) (DeferFunc, error) {
+	timeout := mc.config.LockTimeout
+	if timeout <= 0 {
+		timeout = config.DefaultLockTimeout
+	}
+
+	if err := mc.storage.Lock(ctx, mc.lockUID(), timeout); err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := mc.storage.UnLock(context.Background()); err != nil {
+			mc.logger.Error(fmt.Sprintf("failed to release the lock: %s", err))
+		}
+	}, nil
+}
+
 // LoadMigrations - загружает все файлы миграции.
+// При откате до версии requestToVersion откатываются эта миграция и все, что идут перед ней в обратном
+// топологическом порядке примененных миграций (то есть накатывались после нее), а не все миграции
+// с версией не ниже requestToVersion.
 func (mc *MigrateCore) LoadMigrations(
 	ctx context.Context,
 	requestToVersion uint64,
 	direction bool,
 ) ([]loader.RawMigration, error) {
-	if err := mc.validateFormat(mc.config.Format); err != nil {
-		return nil, err
-	}
-	mc.loader.SetFormat(mc.config.Format)
-	excludeMigrations, err := mc.storage.GetMigrationsByDirection(ctx, direction)
+	filter, err := mc.prepareLoader(ctx, direction)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %s", domain.ErrLoadMigrations, err.Error())
+		return nil, err
 	}
-
-	filter := loader.Filter{Exclude: excludeMigrations}
-	if requestToVersion != 0 {
-		filter.RequestToVersion = requestToVersion
-	} else {
+	excludeMigrations := filter.Exclude
+	filter.RequestToVersion = requestToVersion
+	// последняя примененная миграция нужна при накате (в том числе до версии) для поиска пропущенных миграций
+	if requestToVersion == 0 || direction {
 		filter.Recent, err = mc.storage.RecentMigration(ctx)
-		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		if err != nil && !errors.Is(err, storage.ErrNoAppliedMigrations) {
 			return nil, fmt.Errorf("%w: %s", domain.ErrGetRecentMigration, err.Error())
 		}
 		// Если миграций нет и текущая — MigrationDown,
@@ -93,16 +126,277 @@ func (mc *MigrateCore) LoadMigrations(
 		if filter.Recent.Version == 0 && !direction {
 			return nil, nil
 		}
+		// пропущенные миграции загружаются всегда, чтобы о них можно было сообщить
+		filter.AllowOutOfOrder = direction
 	}
-	neededMigrations, err := mc.loader.LoadMigrations(ctx, filter, mc.config.Path, direction)
+	loadFilter := filter
+	if !direction {
+		// граница отката определяется по порядку всех примененных миграций (downTo)
+		loadFilter.RequestToVersion = 0
+	}
+	neededMigrations, err := mc.loader.LoadMigrations(ctx, loadFilter, direction)
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", domain.ErrLoadMigrations, err.Error())
 	}
+	if !direction {
+		return mc.checkDown(ctx, filter, neededMigrations)
+	}
+	if neededMigrations, err = mc.checkOutOfOrder(filter, neededMigrations); err != nil {
+		return nil, err
+	}
+	if err := checkRequires(excludeMigrations, neededMigrations); err != nil {
+		return nil, err
+	}
 
 	return neededMigrations, nil
 }
 
+// prepareLoader - настраивает загрузчик миграций и возвращает фильтр по тегам
+// с миграциями, исключенными для направления direction.
+func (mc *MigrateCore) prepareLoader(ctx context.Context, direction bool) (loader.Filter, error) {
+	if err := mc.validateFormat(mc.config.Format); err != nil {
+		return loader.Filter{}, err
+	}
+	mc.loader.SetFormat(mc.config.Format)
+	mc.loader.SetVars(mc.config.Vars)
+	mc.loader.SetSource(mc.sources()...)
+	filter, err := mc.tagFilter()
+	if err != nil {
+		return loader.Filter{}, err
+	}
+	filter.Exclude, err = mc.storage.GetMigrationsByDirection(ctx, direction)
+	if err != nil {
+		return loader.Filter{}, fmt.Errorf("%w: %s", domain.ErrLoadMigrations, err.Error())
+	}
+
+	return filter, nil
+}
+
+// downTo - возвращает из applied (примененных миграций в порядке отката) миграции, откатываемые до версии
+// requestToVersion: саму миграцию и все миграции перед ней. Если миграции с такой версией нет среди applied
+// (версия - только граница), откатываются миграции с версией не ниже requestToVersion.
+func downTo(applied []loader.RawMigration, requestToVersion uint64) []loader.RawMigration {
+	if requestToVersion == 0 {
+		return applied
+	}
+	for idx, rawMigration := range applied {
+		if rawMigration.Version == requestToVersion {
+			return applied[:idx+1]
+		}
+	}
+
+	var rawMigrations []loader.RawMigration
+	for _, rawMigration := range applied {
+		if rawMigration.Version >= requestToVersion {
+			rawMigrations = append(rawMigrations, rawMigration)
+		}
+	}
+
+	return rawMigrations
+}
+
+// checkRequires - проверяет, что каждая накатываемая миграция зависит только от примененных миграций
+// или от миграций, которые накатываются раньше нее.
+func checkRequires(applied map[uint64]domain.Migration, rawMigrations []loader.RawMigration) error {
+	var (
+		problems []string
+		planned  = make(map[uint64]bool, len(rawMigrations))
+	)
+	for _, rawMigration := range rawMigrations {
+		for _, version := range rawMigration.Requires {
+			if _, ok := applied[version]; !ok && !planned[version] {
+				problems = append(problems,
+					fmt.Sprintf("%d (%s) requires %d", rawMigration.Version, rawMigration.Name, version))
+			}
+		}
+		planned[rawMigration.Version] = true
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("%w: %s", domain.ErrDependencyNotApplied, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// checkDown - выбирает из applied (примененных миграций в порядке отката) откатываемые миграции
+// и проверяет их: наличие файлов отката и отсутствие примененных зависимых миграций.
+func (mc *MigrateCore) checkDown(
+	ctx context.Context,
+	filter loader.Filter,
+	applied []loader.RawMigration,
+) ([]loader.RawMigration, error) {
+	rawMigrations := downTo(applied, filter.RequestToVersion)
+	migrations, err := mc.storage.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrLoadMigrations, err.Error())
+	}
+	allMigrations, err := mc.loadAllMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	migrations = fillTags(migrations, allMigrations)
+
+	rawMigrations, err = mc.checkMissingDown(filter, migrations, applied, rawMigrations)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkDependents(migrations, allMigrations, rawMigrations); err != nil {
+		return nil, err
+	}
+
+	return rawMigrations, nil
+}
+
+// checkDependents - проверяет, что от откатываемых миграций не зависят миграции, которые остаются примененными.
+// Зависимости берутся из файлов миграций allMigrations.
+func checkDependents(
+	migrations []domain.Migration,
+	allMigrations []loader.RawMigration,
+	rawMigrations []loader.RawMigration,
+) error {
+	rollingBack := make(map[uint64]bool, len(rawMigrations))
+	for _, rawMigration := range rawMigrations {
+		rollingBack[rawMigration.Version] = true
+	}
+	remaining := make(map[uint64]bool, len(migrations))
+	for _, migration := range migrations {
+		if migration.IsApplied && !rollingBack[migration.Version] {
+			remaining[migration.Version] = true
+		}
+	}
+
+	var problems []string
+	for _, rawMigration := range allMigrations {
+		if !remaining[rawMigration.Version] {
+			continue
+		}
+		for _, version := range rawMigration.Requires {
+			if rollingBack[version] {
+				problems = append(problems,
+					fmt.Sprintf("%d is required by %d (%s)", version, rawMigration.Version, rawMigration.Name))
+			}
+		}
+	}
+	if len(problems) != 0 {
+		return fmt.Errorf("%w: %s", domain.ErrDependentMigrations, strings.Join(problems, ", "))
+	}
+
+	return nil
+}
+
+// checkOutOfOrder - находит не примененные миграции с версией ниже последней примененной
+// (например, влитые из долгоживущей ветки). Без AllowOutOfOrder они пропускаются с предупреждением,
+// а в режиме CI возвращается ошибка. С AllowOutOfOrder они накатываются в порядке версий вместе с остальными.
+func (mc *MigrateCore) checkOutOfOrder(
+	filter loader.Filter,
+	rawMigrations []loader.RawMigration,
+) ([]loader.RawMigration, error) {
+	var (
+		versions []string
+		ordered  = make([]loader.RawMigration, 0, len(rawMigrations))
+	)
+	for _, rawMigration := range rawMigrations {
+		if filter.IsOutOfOrder(rawMigration) {
+			versions = append(versions, fmt.Sprintf("%d (%s)", rawMigration.Version, rawMigration.Name))
+			continue
+		}
+		ordered = append(ordered, rawMigration)
+	}
+	if len(versions) == 0 {
+		return rawMigrations, nil
+	}
+
+	list := strings.Join(versions, ", ")
+	switch {
+	case mc.config.AllowOutOfOrder:
+		mc.logger.Warn(fmt.Sprintf("applying out-of-order migrations below the latest applied version %d: %s",
+			filter.Recent.Version, list))
+		return rawMigrations, nil
+	case mc.config.CI:
+		return nil, fmt.Errorf("%w: %s", domain.ErrOutOfOrderMigrations, list)
+	}
+
+	mc.logger.Warn(fmt.Sprintf("WARNING: pending migrations below the latest applied version %d will NOT be applied: %s "+
+		"(use --allow-out-of-order to apply them)", filter.Recent.Version, list))
+
+	return ordered, nil
+}
+
+// checkMissingDown - проверяет, что у всех откатываемых примененных миграций есть файл отката.
+// Файлы миграций ищутся среди applied; миграции без файла откатываются, если их версия не ниже границы отката.
+// Без Force откат прерывается; с Force sql-миграции без файла отмечаются откаченными без выполнения запросов,
+// а go-миграции без файла пропускаются. В формате mixed формат миграции без файла неизвестен,
+// поэтому она отмечается откаченной, как sql-миграция.
+func (mc *MigrateCore) checkMissingDown(
+	filter loader.Filter,
+	migrations []domain.Migration,
+	applied []loader.RawMigration,
+	rawMigrations []loader.RawMigration,
+) ([]loader.RawMigration, error) {
+	loaded := make(map[uint64]loader.RawMigration, len(applied))
+	for _, rawMigration := range applied {
+		loaded[rawMigration.Version] = rawMigration
+	}
+	rollingBack := make(map[uint64]bool, len(rawMigrations))
+	for _, rawMigration := range rawMigrations {
+		rollingBack[rawMigration.Version] = true
+	}
+
+	var (
+		problems []string
+		missing  []loader.RawMigration
+	)
+	for _, migration := range migrations {
+		if !migration.IsApplied || !filter.MatchTags(migration.Tags) {
+			continue
+		}
+		rawMigration, ok := loaded[migration.Version]
+		switch {
+		case !ok && !filter.AllowDown(loader.RawMigration{Version: migration.Version}):
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%d (%s): file is missing", migration.Version, migration.Name))
+			missing = append(missing, loader.RawMigration{
+				Version: migration.Version,
+				Name:    migration.Name,
+				Format:  config.FormatSQL,
+			})
+		case !rollingBack[migration.Version]:
+		case rawMigration.Format == config.FormatSQL && rawMigration.PathDown == "":
+			problems = append(problems, fmt.Sprintf("%d (%s): down file is missing", migration.Version, migration.Name))
+		}
+	}
+	if len(problems) == 0 {
+		return rawMigrations, nil
+	}
+
+	list := strings.Join(problems, ", ")
+	if !mc.config.Force {
+		return nil, fmt.Errorf("%w: %s", domain.ErrMissingDownMigration, list)
+	}
+	mc.logger.Warn(fmt.Sprintf("rolling back migrations without down files, the database is NOT changed for: %s", list))
+
+	// миграцию на Go без файла не собрать, она остается примененной
+	if mc.config.Format == config.FormatGolang {
+		return rawMigrations, nil
+	}
+	// порядок миграций без файлов неизвестен: каждая откатывается перед первой миграцией с меньшей версией
+	for _, migration := range missing {
+		idx := len(rawMigrations)
+		for pos, rawMigration := range rawMigrations {
+			if rawMigration.Version < migration.Version {
+				idx = pos
+				break
+			}
+		}
+		rawMigrations = append(rawMigrations[:idx], append([]loader.RawMigration{migration}, rawMigrations[idx:]...)...)
+	}
+
+	return rawMigrations, nil
+}
+
 // StartMigrate - запускает процесc миграции.
+// Миграции выполняются строго в порядке neededMigrations: подряд идущие sql-миграции выполняются по одной,
+// а подряд идущие go-миграции - одной программой миграций (в формате mixed их может быть несколько).
 func (mc *MigrateCore) StartMigrate(
 	ctx context.Context,
 	neededMigrations []loader.RawMigration,
@@ -111,20 +405,192 @@ func (mc *MigrateCore) StartMigrate(
 	if err := mc.validateFormat(mc.config.Format); err != nil {
 		return 0, err
 	}
-	switch mc.config.Format {
-	case config.FormatSQL:
-		return mc.runSQLMigration(ctx, neededMigrations, direction)
-	case config.FormatGolang:
-		return mc.runGoMigration(ctx, neededMigrations, direction)
+
+	var count int
+	for start := 0; start < len(neededMigrations); {
+		format := mc.migrationFormat(neededMigrations[start])
+		end := start + 1
+		for end < len(neededMigrations) && mc.migrationFormat(neededMigrations[end]) == format {
+			end++
+		}
+
+		var (
+			applied int
+			err     error
+		)
+		switch format {
+		case config.FormatSQL:
+			applied, err = mc.runSQLMigration(ctx, neededMigrations[start:end], direction)
+		case config.FormatGolang:
+			applied, err = mc.runGoMigration(ctx, neededMigrations[start:end], direction)
+		case loader.FormatRegistered:
+			applied, err = mc.runRegisteredMigration(ctx, neededMigrations[start:end], direction)
+		}
+		count += applied
+		if err != nil {
+			return count, err
+		}
+		start = end
+	}
+
+	return count, nil
+}
+
+// migrationFormat - возвращает формат миграции (формат из конфигурации, если в миграции он не указан).
+func (mc *MigrateCore) migrationFormat(rawMigration loader.RawMigration) string {
+	if rawMigration.Format != "" {
+		return rawMigration.Format
 	}
 
-	return 0, nil
+	return mc.config.Format
+}
+
+// LoadRepeatableMigrations - загружает повторяемые миграции (только для форматов sql и mixed).
+func (mc *MigrateCore) LoadRepeatableMigrations(ctx context.Context) ([]loader.RawMigration, error) {
+	if mc.config.Format == config.FormatGolang {
+		return nil, nil
+	}
+	mc.loader.SetFormat(mc.config.Format)
+	mc.loader.SetVars(mc.config.Vars)
+	mc.loader.SetSource(mc.sources()...)
+	rawMigrations, err := mc.loader.LoadRepeatableMigrations(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrLoadMigrations, err.Error())
+	}
+
+	return rawMigrations, nil
+}
+
+// StartRepeatableMigrate - накатывает повторяемые миграции, контрольная сумма которых изменилась
+// с последнего наката (или которые еще не накатывались). Возвращает число накаченных миграций.
+func (mc *MigrateCore) StartRepeatableMigrate(ctx context.Context, rawMigrations []loader.RawMigration) (int, error) {
+	if len(rawMigrations) == 0 {
+		return 0, nil
+	}
+
+	applied, err := mc.storage.RepeatableMigrations(ctx)
+	if err != nil {
+		return 0, err
+	}
+	checksums := make(map[string]string, len(applied))
+	for _, migration := range applied {
+		checksums[migration.Name] = migration.Checksum
+	}
+
+	var count int
+	for _, rawMigration := range rawMigrations {
+		if checksum, ok := checksums[rawMigration.Name]; ok && checksum == rawMigration.Checksum {
+			mc.logger.Debug(fmt.Sprintf("repeatable migration %s is up to date", rawMigration.Name))
+			continue
+		}
+		if rawMigration.QueryUp == "" {
+			mc.logger.Warn(fmt.Sprintf("%s empty migration file detected, it will be skipped", rawMigration.PathUp))
+			continue
+		}
+
+		migration := domain.Migration{Name: rawMigration.Name, Checksum: rawMigration.Checksum}
+		startedAt := time.Now()
+		tx, err := mc.storage.BeginTxRepeatableMigration(ctx, domain.RepeatableMigration{
+			Name:     rawMigration.Name,
+			Checksum: rawMigration.Checksum,
+		})
+		if err != nil {
+			mc.RecordExecution(ctx, migration, true, startedAt, err)
+			return count, err
+		}
+
+		mc.logger.Info(fmt.Sprintf("running repeatable migration %s...", rawMigration.Name))
+		rowAffected, err := mc.execStatements(ctx, tx, rawMigration, true)
+		mc.RecordExecution(ctx, migration, true, startedAt, err)
+		if err != nil {
+			return count, err
+		}
+		mc.logger.Debug(fmt.Sprintf("%d row affected", rowAffected))
+		count++
+	}
+
+	return count, nil
+}
+
+// GetRepeatableMigrations - возвращает повторяемые миграции с их состоянием:
+// pending (еще не накатывалась), applied или outdated (файл изменен после наката).
+// Накаченные миграции, файлы которых удалены, возвращаются в состоянии applied.
+func (mc *MigrateCore) GetRepeatableMigrations(ctx context.Context) ([]domain.RepeatableMigration, error) {
+	rawMigrations, err := mc.LoadRepeatableMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := mc.storage.RepeatableMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make(map[string]domain.RepeatableMigration, len(applied)+len(rawMigrations))
+	for _, migration := range applied {
+		migrations[migration.Name] = migration
+	}
+	for _, rawMigration := range rawMigrations {
+		migration, ok := migrations[rawMigration.Name]
+		switch {
+		case !ok:
+			migration = domain.RepeatableMigration{Name: rawMigration.Name, Status: domain.StatusPending}
+		case migration.Checksum != rawMigration.Checksum:
+			migration.Status = domain.StatusOutdated
+		}
+		migration.Checksum = rawMigration.Checksum
+		migrations[rawMigration.Name] = migration
+	}
+
+	result := make([]domain.RepeatableMigration, 0, len(migrations))
+	for _, migration := range migrations {
+		result = append(result, migration)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+// GetLastAppliedMigration - возвращает примененную миграцию, которая откатывается первой: последнюю
+// в топологическом порядке примененных миграций (с учетом зависимостей и фильтра по тегам),
+// а не миграцию с наибольшей версией. Nil - нет примененных миграций.
+func (mc *MigrateCore) GetLastAppliedMigration(ctx context.Context) (*domain.Migration, error) {
+	recent, err := mc.GetRecentMigration(ctx)
+	if err != nil || recent == nil {
+		return nil, err
+	}
+	filter, err := mc.prepareLoader(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+	filter.Recent = *recent
+	applied, err := mc.loader.LoadMigrations(ctx, filter, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrLoadMigrations, err.Error())
+	}
+	// у примененных миграций без файлов порядок неизвестен, откат начинается с наибольшей версии
+	if len(applied) == 0 {
+		return recent, nil
+	}
+
+	migrations, err := mc.storage.Stats(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrGetRecentMigration, err.Error())
+	}
+	for _, migration := range migrations {
+		if migration.Version == applied[0].Version {
+			return &migration, nil
+		}
+	}
+
+	return recent, nil
 }
 
 // GetRecentMigration - возвращает последнюю примененную миграцию.
 func (mc *MigrateCore) GetRecentMigration(ctx context.Context) (*domain.Migration, error) {
 	migration, err := mc.storage.RecentMigration(ctx)
-	if err != nil && errors.Is(err, pgx.ErrNoRows) {
+	if err != nil && errors.Is(err, storage.ErrNoAppliedMigrations) {
 		return nil, nil
 	} else if err != nil {
 		return nil, err
@@ -133,9 +599,235 @@ func (mc *MigrateCore) GetRecentMigration(ctx context.Context) (*domain.Migratio
 	return &migration, nil
 }
 
-// GetMigrations - возвращает все миграции из БД.
+// VerifyMigrations - возвращает примененные миграции, файлы которых были изменены после наката.
+func (mc *MigrateCore) VerifyMigrations(ctx context.Context) ([]domain.Migration, error) {
+	if err := mc.validateFormat(mc.config.Format); err != nil {
+		return nil, err
+	}
+	rawMigrations, err := mc.loadAllMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := make(map[uint64]string, len(rawMigrations))
+	for _, rawMigration := range rawMigrations {
+		checksums[rawMigration.Version] = rawMigration.Checksum
+	}
+
+	migrations, err := mc.storage.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var modified []domain.Migration
+	for _, migration := range migrations {
+		// миграции, примененные до появления контрольных сумм, не проверяются
+		if !migration.IsApplied || migration.Checksum == "" {
+			continue
+		}
+		checksum, ok := checksums[migration.Version]
+		if ok && checksum != migration.Checksum {
+			modified = append(modified, migration)
+		}
+	}
+
+	return modified, nil
+}
+
+// MissingMigrations - возвращает примененные миграции, файлы которых отсутствуют на диске
+// (удалены или переименованы после наката).
+func (mc *MigrateCore) MissingMigrations(ctx context.Context) ([]domain.Migration, error) {
+	if err := mc.validateFormat(mc.config.Format); err != nil {
+		return nil, err
+	}
+	rawMigrations, err := mc.loadAllMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := mc.storage.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var missing []domain.Migration
+	for _, migration := range markMissing(migrations, rawMigrations) {
+		if migration.Missing {
+			missing = append(missing, migration)
+		}
+	}
+
+	return missing, nil
+}
+
+// ReportMissingMigrations - предупреждает о примененных миграциях, файлы которых отсутствуют на диске.
+func (mc *MigrateCore) ReportMissingMigrations(ctx context.Context) error {
+	missing, err := mc.MissingMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	versions := make([]string, 0, len(missing))
+	for _, migration := range missing {
+		versions = append(versions, fmt.Sprintf("%d (%s)", migration.Version, migration.Name))
+	}
+	mc.logger.Warn(fmt.Sprintf("applied migrations are missing on disk (deleted or renamed): %s",
+		strings.Join(versions, ", ")))
+
+	return nil
+}
+
+// ValidateMigrations - проверяет каталог миграций без подключения к БД и возвращает все найденные проблемы.
+// Если go-файлы миграций разобраны без ошибок, программа миграций дополнительно собирается,
+// чтобы найти ошибки компиляции.
+func (mc *MigrateCore) ValidateMigrations(ctx context.Context) ([]error, error) {
+	if err := mc.validateFormat(mc.config.Format); err != nil {
+		return nil, err
+	}
+	mc.loader.SetFormat(mc.config.Format)
+	mc.loader.SetSource(mc.sources()...)
+	problems, err := mc.loader.Validate(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", domain.ErrLoadMigrations, err.Error())
+	}
+	if mc.config.Format == config.FormatSQL || len(problems) != 0 {
+		return problems, nil
+	}
+
+	rawMigrations, err := mc.loadAllMigrations(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var goMigrations []loader.RawMigration
+	for _, rawMigration := range rawMigrations {
+		if rawMigration.Format == config.FormatGolang {
+			goMigrations = append(goMigrations, rawMigration)
+		}
+	}
+	if len(goMigrations) == 0 {
+		return nil, nil
+	}
+	if _, err := mc.buildGoProgram(ctx, goMigrations, true); err != nil {
+		problems = append(problems, err)
+	}
+
+	return problems, nil
+}
+
+// CheckModified - возвращает ошибку, если файлы примененных миграций были изменены.
+func (mc *MigrateCore) CheckModified(ctx context.Context) error {
+	modified, err := mc.VerifyMigrations(ctx)
+	if err != nil {
+		return err
+	}
+	if len(modified) == 0 {
+		return nil
+	}
+
+	versions := make([]string, 0, len(modified))
+	for _, migration := range modified {
+		versions = append(versions, fmt.Sprintf("%d (%s)", migration.Version, migration.Name))
+	}
+
+	return fmt.Errorf("%w: %s", domain.ErrMigrationsModified, strings.Join(versions, ", "))
+}
+
+// CheckDirty - возвращает ошибку, если есть миграции, прерванные в незавершенном состоянии.
+func (mc *MigrateCore) CheckDirty(ctx context.Context) error {
+	migrations, err := mc.storage.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	var versions []string
+	for _, migration := range migrations {
+		if migration.Dirty {
+			versions = append(versions, fmt.Sprintf("%d (%s)", migration.Version, migration.Name))
+		}
+	}
+	if len(versions) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %s", domain.ErrDirtyMigration, strings.Join(versions, ", "))
+}
+
+// ResolveMigration - вручную устанавливает состояние миграции и снимает отметку dirty.
+func (mc *MigrateCore) ResolveMigration(ctx context.Context, version uint64, status domain.MigrationStatus) error {
+	return mc.storage.ResolveMigration(ctx, version, status)
+}
+
+// FailMigration - переводит миграцию, транзакция которой была отменена, в состояние failed.
+// Если dirty (миграция выполнялась без транзакции), миграция блокирует дальнейшие накаты до ручного разрешения.
+func (mc *MigrateCore) FailMigration(ctx context.Context, migration domain.Migration, dirty bool) {
+	if err := mc.storage.FailMigration(ctx, migration, dirty); err != nil {
+		mc.logger.Error(fmt.Sprintf("failed to mark migration %d as failed: %s", migration.Version, err))
+	}
+}
+
+// RecordExecution - записывает выполнение миграции в журнал.
+// Ошибка записи журнала не прерывает миграцию, а только логируется.
+func (mc *MigrateCore) RecordExecution(
+	ctx context.Context,
+	migration domain.Migration,
+	direction bool,
+	startedAt time.Time,
+	errMigration error,
+) {
+	finishedAt := time.Now()
+	execution := domain.Execution{
+		Version:     migration.Version,
+		Name:        migration.Name,
+		Direction:   domain.DirectionDown,
+		StartedAt:   startedAt,
+		FinishedAt:  finishedAt,
+		Duration:    finishedAt.Sub(startedAt),
+		Outcome:     domain.OutcomeSuccess,
+		OSUser:      osUser(),
+		ToolVersion: config.AppVersion,
+	}
+	if direction {
+		execution.Direction = domain.DirectionUp
+	}
+	if errMigration != nil {
+		execution.Outcome = domain.OutcomeFailed
+		execution.Error = errMigration.Error()
+	}
+	execution.Hostname, _ = os.Hostname()
+
+	if err := mc.storage.RecordExecution(ctx, execution); err != nil {
+		mc.logger.Error(fmt.Sprintf("failed to record execution of migration %d: %s", migration.Version, err))
+	}
+}
+
+// GetExecutions - возвращает журнал выполнения миграций.
+func (mc *MigrateCore) GetExecutions(ctx context.Context, version uint64, limit int) ([]domain.Execution, error) {
+	return mc.storage.Executions(ctx, version, limit)
+}
+
+// GetMigrations - возвращает все миграции из БД и отмечает примененные миграции, файлы которых отсутствуют.
+// Если файлы миграций загрузить не удалось, миграции возвращаются без отметок.
 func (mc *MigrateCore) GetMigrations(ctx context.Context) ([]domain.Migration, error) {
-	return mc.storage.Stats(ctx)
+	filter, err := mc.tagFilter()
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := mc.storage.Stats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if mc.validateFormat(mc.config.Format) != nil {
+		return filterTags(filter, migrations), nil
+	}
+	rawMigrations, err := mc.loadAllMigrations(ctx)
+	if err != nil {
+		mc.logger.Warn(fmt.Sprintf("failed to check migration files: %s", err))
+		return filterTags(filter, migrations), nil
+	}
+
+	return filterTags(filter, fillTags(markMissing(migrations, rawMigrations), rawMigrations)), nil
 }
 
 // CreateTransactionalMigration - создает транзакционную миграцию в направлении вверх или вниз.
@@ -143,7 +835,7 @@ func (mc *MigrateCore) CreateTransactionalMigration(
 	ctx context.Context,
 	migration domain.Migration,
 	direction bool,
-) (pgx.Tx, error) {
+) (storage.Tx, error) {
 	tx, err := mc.storage.BeginTxMigration(ctx, migration, direction)
 	if err != nil {
 		return nil, err
@@ -152,7 +844,69 @@ func (mc *MigrateCore) CreateTransactionalMigration(
 	return tx, nil
 }
 
+// CreateNonTransactionalMigration - создает миграцию без транзакции в направлении вверх или вниз.
+func (mc *MigrateCore) CreateNonTransactionalMigration(
+	ctx context.Context,
+	migration domain.Migration,
+	direction bool,
+) (storage.Tx, error) {
+	tx, err := mc.storage.BeginNoTxMigration(ctx, migration, direction)
+	if err != nil {
+		return nil, err
+	}
+
+	return tx, nil
+}
+
+// RunMigrationFunc - выполняет функцию миграции в транзакции миграции (или без нее) с записью в журнал.
+// Возвращает false без ошибки, если миграция уже находится в нужном состоянии.
+func (mc *MigrateCore) RunMigrationFunc(
+	ctx context.Context,
+	migration domain.Migration,
+	direction bool,
+	noTransaction bool,
+	runFunc func(tx storage.Tx) error,
+) (bool, error) {
+	startedAt := time.Now()
+	createMigration := mc.CreateTransactionalMigration
+	if noTransaction {
+		createMigration = mc.CreateNonTransactionalMigration
+	}
+	tx, err := createMigration(ctx, migration, direction)
+	if err != nil {
+		if errors.Is(err, storage.ErrQueryNoAffectRows) {
+			return false, nil
+		}
+		mc.RecordExecution(ctx, migration, direction, startedAt, err)
+
+		return false, err
+	}
+	sDirection := "Down"
+	if direction {
+		sDirection = "Up"
+	}
+
+	mc.logger.Info(fmt.Sprintf("running %s migration with version %d (%s) ...",
+		migration.Name, migration.Version, sDirection))
+
+	if err := runFunc(tx); err != nil {
+		// функция миграции могла уже отменить транзакцию сама, поэтому ошибку отката не учитываем
+		_ = tx.Rollback(ctx)
+		mc.FailMigration(ctx, migration, noTransaction)
+		if noTransaction {
+			err = fmt.Errorf("%w: %w", err, domain.ErrDirtyMigration)
+		}
+		mc.RecordExecution(ctx, migration, direction, startedAt, err)
+
+		return false, err
+	}
+	mc.RecordExecution(ctx, migration, direction, startedAt, nil)
+
+	return true, nil
+}
+
 // CreateMigrationFile - создать файл миграции в зависимости от формата.
+// В формате mixed создаются sql-файлы (go-миграция создается с флагом формата golang).
 func (mc *MigrateCore) CreateMigrationFile(name string, version uint64) error {
 	if version == 0 {
 		return domain.ErrMigrateVersionIncorrect
@@ -180,12 +934,16 @@ func (mc *MigrateCore) CreateMigrationFile(name string, version uint64) error {
 			return fmt.Errorf("%w: %s", domain.ErrCreateMigrationFile, paths[0])
 		}
 		mc.logger.Info(fmt.Sprintf("%s created successfully", paths[0]))
-	case config.FormatSQL:
+	case config.FormatSQL, config.FormatMixed:
+		var content string
+		if len(paths) == 1 {
+			content = sqlSectionsSample
+		}
 		for _, filePath := range paths {
 			if fileutil.Exist(filePath) {
 				return fmt.Errorf("%w: %s", domain.ErrMigrationFileExists, filePath)
 			}
-			if err := util.CreateFile(filePath); err != nil {
+			if err := util.CreateFileWithContent(filePath, content); err != nil {
 				return fmt.Errorf("%w: %s", domain.ErrCreateMigrationFile, filePath)
 			}
 			mc.logger.Info(fmt.Sprintf("%s created successfully", filePath))
@@ -202,6 +960,10 @@ func (mc *MigrateCore) getFilePath(name string, version uint64) ([]string, error
 	if err := mc.validateFormat(mc.config.Format); err != nil {
 		return nil, err
 	}
+	// например, ни один glob-шаблон каталогов миграций не подошел
+	if mc.config.Path == "" {
+		return nil, loader.ErrMigrationPath
+	}
 	name = converter.SanitizeMigrationName(name)
 	fileName := fmt.Sprintf("%d_%s", version, strcase.ToDelimited(name, config.Separator))
 	var filePaths []string
@@ -209,7 +971,16 @@ func (mc *MigrateCore) getFilePath(name string, version uint64) ([]string, error
 	case config.FormatGolang:
 		fullName := fmt.Sprintf("%s%s", fileName, config.ExtGolang)
 		filePaths = append(filePaths, filepath.Join(mc.config.Path, fullName))
-	case config.FormatSQL:
+	case config.FormatSQL, config.FormatMixed:
+		switch mc.config.SQLLayout {
+		case "", config.SQLLayoutSplit:
+		case config.SQLLayoutSingle:
+			fullName := fmt.Sprintf("%s%s", fileName, config.ExtSQL)
+			return append(filePaths, filepath.Join(mc.config.Path, fullName)), nil
+		default:
+			return nil, fmt.Errorf("%w (allow %s or %s)",
+				domain.ErrInvalidSQLLayout, config.SQLLayoutSplit, config.SQLLayoutSingle)
+		}
 		for _, postfix := range []string{config.PostfixUp, config.PostfixDown} {
 			fullName := fmt.Sprintf("%s%s%s", fileName, postfix, config.ExtSQL)
 			filePaths = append(filePaths, filepath.Join(mc.config.Path, fullName))
@@ -238,15 +1009,24 @@ func (mc *MigrateCore) runSQLMigration(
 			continue
 		}
 
-		var tx pgx.Tx
-		tx, err = mc.CreateTransactionalMigration(ctx, domain.Migration{
-			Version: rawMigration.Version,
-			Name:    rawMigration.Name,
-		}, direction)
+		migration := domain.Migration{
+			Version:  rawMigration.Version,
+			Name:     rawMigration.Name,
+			Checksum: rawMigration.Checksum,
+			Tags:     rawMigration.Tags,
+		}
+		startedAt := time.Now()
+		var tx storage.Tx
+		if rawMigration.NoTransaction {
+			tx, err = mc.CreateNonTransactionalMigration(ctx, migration, direction)
+		} else {
+			tx, err = mc.CreateTransactionalMigration(ctx, migration, direction)
+		}
 		if err != nil {
 			if errors.Is(err, storage.ErrQueryNoAffectRows) {
 				continue
 			}
+			mc.RecordExecution(ctx, migration, direction, startedAt, err)
 			return count, err
 		}
 
@@ -257,12 +1037,22 @@ func (mc *MigrateCore) runSQLMigration(
 
 		mc.logger.Info(fmt.Sprintf("running %s migration with version %d (%s)...",
 			rawMigration.Name, rawMigration.Version, sDirection))
+		if rawMigration.NoTransaction {
+			mc.logger.Warn(fmt.Sprintf("migration with version %d runs without a transaction, "+
+				"if it fails it will be left dirty", rawMigration.Version))
+		}
 
 		var rowAffected int64
-		rowAffected, err = mc.exec(ctx, tx, query)
+		rowAffected, err = mc.execStatements(ctx, tx, rawMigration, direction)
 		if err != nil {
+			mc.FailMigration(ctx, migration, rawMigration.NoTransaction)
+			if rawMigration.NoTransaction {
+				err = fmt.Errorf("%w: %w", err, domain.ErrDirtyMigration)
+			}
+			mc.RecordExecution(ctx, migration, direction, startedAt, err)
 			return count, err
 		}
+		mc.RecordExecution(ctx, migration, direction, startedAt, nil)
 		mc.logger.Debug(fmt.Sprintf("%d row affected", rowAffected))
 		count++
 	}
@@ -275,18 +1065,132 @@ func (mc *MigrateCore) runGoMigration(
 	rawMigrations []loader.RawMigration,
 	direction bool,
 ) (int, error) {
-	mc.logger.Info("build a program for migrations...")
+	// программа миграций подключается к БД сама, пул или соединение приложения ей недоступны
+	if mc.config.DSN == "" {
+		return 0, domain.ErrGoMigrationsRequireDSN
+	}
+
+	program, err := mc.buildGoProgram(ctx, rawMigrations, direction)
+	if err != nil {
+		return 0, err
+	}
+
+	// строка подключения передается через среду, чтобы не сохранять ее в программе в кэше
+	env := append(command.Env{}, os.Environ()...)
+	env = append(env, template.ProgramDSNEnv+"="+mc.config.DSN)
+	mc.logger.Info("starting a program for migrations...")
+	if err := mc.command.RunWithGracefulShutdown(ctx, program, command.Args{}, "", env); err != nil {
+		return 0, fmt.Errorf("%w: %s", domain.ErrStartingProgramForMigrations, err.Error())
+	}
+
+	return len(rawMigrations), nil
+}
+
+// buildGoProgram - собирает программу миграций и возвращает путь к ней. Собранная программа хранится в кэше
+// по ключу из версии мигратора, toolchain, содержимого файлов программы и модуля мигратора, поэтому повторная
+// сборка пропускается. Программа собирается с локальным модулем мигратора без доступа к сети: если модуль
+// не найден, возвращается ошибка.
+func (mc *MigrateCore) buildGoProgram(
+	ctx context.Context,
+	rawMigrations []loader.RawMigration,
+	direction bool,
+) (string, error) {
+	module := mc.migratorModule()
+	if module.dir == "" {
+		return "", fmt.Errorf("%w: local %s module not found, set migrator.go.module",
+			domain.ErrBuildProgramForMigrations, migratorModulePath)
+	}
+
 	tmpPath, err := os.MkdirTemp(os.TempDir(), "migrator_*")
 	if err != nil {
-		return 0, fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+		return "", fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
 	}
 	defer os.RemoveAll(tmpPath)
 
+	if err := mc.prepareGoProgram(tmpPath, rawMigrations, direction, module); err != nil {
+		return "", err
+	}
+
+	// зависимости берутся из кэша модулей или каталога vendor, сеть и загрузка toolchain не используются
+	env := append(command.Env{}, os.Environ()...)
+	env = append(env, "GO111MODULE=on", "GOWORK=off", "GOPROXY=off", "GOTOOLCHAIN=local")
+	if module.vendor {
+		env = append(env, "GOFLAGS=-mod=vendor")
+	} else {
+		env = append(env, "GOFLAGS=-mod=mod")
+	}
+	toolchain, err := mc.command.Output(ctx, "go", command.Args{"env", "GOVERSION", "GOOS", "GOARCH"}, tmpPath, env)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+	}
+
+	key, err := programKey(tmpPath, module, toolchain)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+	}
+	cacheDir := mc.programCacheDir()
+	program := filepath.Join(cacheDir, "migration_"+key)
+	if fileutil.Exist(program) {
+		// время изменения - время последнего использования, по нему из кэша удаляются старые программы
+		now := time.Now()
+		_ = os.Chtimes(program, now, now)
+		mc.logger.Info(fmt.Sprintf("using the cached program for migrations %s", program))
+		return program, nil
+	}
+
+	mc.logger.Info("build a program for migrations...")
+	if module.vendor {
+		if err := util.CopyDir(filepath.Join(tmpPath, "vendor"), filepath.Join(module.dir, "vendor")); err != nil {
+			return "", fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+		}
+	} else if err := mc.command.Run(ctx, "go", command.Args{"mod", "tidy"}, tmpPath, env); err != nil {
+		return "", fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+	}
+
+	// программа собирается во временный файл кэша, чтобы параллельный запуск не взял недособранную программу
+	if err := os.MkdirAll(cacheDir, 0o700); err != nil {
+		return "", fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+	}
+	output, err := os.CreateTemp(cacheDir, "migration_*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+	}
+	output.Close()
+	defer os.Remove(output.Name())
+
+	args := command.Args{"build", "-o", output.Name(), "."}
+	if err := mc.command.Run(ctx, "go", args, tmpPath, env); err != nil {
+		return "", fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+	}
+	if err := os.Rename(output.Name(), program); err != nil {
+		return "", fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+	}
+	if err := pruneProgramCache(cacheDir, programCacheSize); err != nil {
+		mc.logger.Warn(fmt.Sprintf("failed to clean the cache of programs for migrations: %s", err.Error()))
+	}
+
+	return program, nil
+}
+
+// prepareGoProgram - копирует go-файлы миграций в каталог tmpPath, создает для них main.go и go.mod.
+// go.mod программы заменяет зависимость от мигратора каталогом module, а для сборки с vendor
+// повторяет go.mod проекта; go.sum копируется из каталога module.
+func (mc *MigrateCore) prepareGoProgram(
+	tmpPath string,
+	rawMigrations []loader.RawMigration,
+	direction bool,
+	module programModule,
+) error {
+	mc.loader.SetSource(mc.sources()...)
 	for _, rawMigration := range rawMigrations {
 		base := strings.ReplaceAll(rawMigration.GetPath(direction), `\\`, `\`)
 		base = path.Base(strings.ReplaceAll(base, `\`, `/`))
-		if err := util.CopyFile(filepath.Join(tmpPath, base), rawMigration.GetPath(direction)); err != nil {
-			return 0, fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+		content, err := mc.loader.ReadFile(rawMigration.GetPath(direction))
+		if err != nil {
+			return fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+		}
+		if err := util.CreateFileWithContent(filepath.Join(tmpPath, base), string(content)); err != nil {
+			return fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
 		}
 	}
 
@@ -295,54 +1199,182 @@ func (mc *MigrateCore) runGoMigration(
 		mc.config,
 		rawMigrations,
 		direction); err != nil {
-		return 0, fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+		return fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
 	}
 
-	var env command.Env
-	if err := mc.command.Run(ctx, "go", command.Args{"mod", "init", "go/migration"}, tmpPath, env); err != nil {
-		return 0, fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+	goMod := fmt.Sprintf("module %s\n\ngo 1.22\n\nrequire %s v0.0.0\n\nreplace %s => %q\n",
+		programModulePath, migratorModulePath, migratorModulePath, module.dir)
+	if module.vendor {
+		content, err := os.ReadFile(filepath.Join(module.dir, "go.mod"))
+		if err != nil {
+			return fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+		}
+		goMod = programGoMod(content, programModulePath)
 	}
+	if goSum, err := os.ReadFile(filepath.Join(module.dir, "go.sum")); err == nil {
+		if err := util.CreateFileWithContent(filepath.Join(tmpPath, "go.sum"), string(goSum)); err != nil {
+			return fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+		}
+	}
+	if err := util.CreateFileWithContent(filepath.Join(tmpPath, "go.mod"), goMod); err != nil {
+		return fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+	}
+
+	return nil
+}
 
-	if err := mc.command.Run(ctx, "go", command.Args{"mod", "tidy"}, tmpPath, env); err != nil {
-		return 0, fmt.Errorf("%w: %s", domain.ErrBuildProgramForMigrations, err.Error())
+// execStatements - выполняет запросы миграции по одному в транзакции миграции и фиксирует ее.
+// Ошибка запроса содержит путь к файлу, номер запроса и его строку и столбец в файле.
+func (mc *MigrateCore) execStatements(
+	ctx context.Context,
+	tx storage.Tx,
+	rawMigration loader.RawMigration,
+	direction bool,
+) (int64, error) {
+	var rowsAffected int64
+	statements := splitter.Split(rawMigration.GetQuery(direction), mc.storage.SplitOptions())
+	for idx, statement := range statements {
+		mc.logger.Debug(fmt.Sprintf("statement %d of %d:\n%s", idx+1, len(statements), statement.Query))
+		count, err := tx.Exec(ctx, statement.Query)
+		if err != nil {
+			errStatement := mc.statementError(rawMigration, direction, idx, statement, err)
+			if errRollback := tx.Rollback(ctx); errRollback != nil {
+				return 0, fmt.Errorf("%w: %w: %w", domain.ErrTransactionCancel, errStatement, errRollback)
+			}
+
+			return 0, errStatement
+		}
+		rowsAffected += count
 	}
-	env = append(env, os.Environ()...)
-	env = append(env, "GO111MODULE=on")
-	mc.logger.Info("starting a program for migrations...")
-	if err := mc.command.RunWithGracefulShutdown(ctx, "go", command.Args{"run", "./..."}, tmpPath, env); err != nil {
-		return 0, fmt.Errorf("%w: %s", domain.ErrStartingProgramForMigrations, err.Error())
+
+	if errCommit := tx.Commit(ctx); errCommit != nil {
+		return 0, fmt.Errorf("%w: %s", domain.ErrApplyingMigration, errCommit.Error())
 	}
 
-	return len(rawMigrations), nil
+	return rowsAffected, nil
 }
 
-func (mc *MigrateCore) exec(ctx context.Context, tx pgx.Tx, query string, args ...interface{}) (int64, error) {
-	var (
-		err    error
-		result pgconn.CommandTag
-	)
+// statementError - дополняет ошибку запроса его расположением в файле миграции.
+// Если Postgres сообщил позицию ошибки в запросе, указываются ее строка и столбец.
+func (mc *MigrateCore) statementError(
+	rawMigration loader.RawMigration,
+	direction bool,
+	idx int,
+	statement splitter.Statement,
+	err error,
+) error {
+	line, column := statement.Line, statement.Column
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Position > 0 {
+		line, column = statement.Location(int(pgErr.Position))
+	}
+
+	return fmt.Errorf("%w: %s: statement %d (line %d, column %d): %s",
+		domain.ErrApplyingMigration,
+		rawMigration.GetPath(direction),
+		idx+1,
+		line+rawMigration.GetLineOffset(direction),
+		column,
+		err.Error())
+}
+
+// sources - возвращает источники файлов миграций.
+func (mc *MigrateCore) sources() []loader.Source {
+	if mc.fsys != nil {
+		return []loader.Source{loader.FSSource(mc.fsys)}
+	}
 
-	result, err = tx.Exec(ctx, query, args...)
+	return loader.DirSources(mc.config.MigrationPaths()...)
+}
+
+// loadAllMigrations - загружает все файлы миграций без фильтра.
+func (mc *MigrateCore) loadAllMigrations(ctx context.Context) ([]loader.RawMigration, error) {
+	mc.loader.SetFormat(mc.config.Format)
+	mc.loader.SetVars(mc.config.Vars)
+	mc.loader.SetSource(mc.sources()...)
+	rawMigrations, err := mc.loader.LoadMigrations(ctx, loader.Filter{}, true)
 	if err != nil {
-		if errRollback := tx.Rollback(ctx); errRollback != nil {
-			return 0, fmt.Errorf("%w: %w: %w", domain.ErrTransactionCancel, domain.ErrApplyingMigration, errRollback)
+		return nil, fmt.Errorf("%w: %s", domain.ErrLoadMigrations, err.Error())
+	}
+
+	return rawMigrations, nil
+}
+
+// markMissing - отмечает примененные миграции, файлов которых (с той же версией и именем) нет среди rawMigrations.
+func markMissing(migrations []domain.Migration, rawMigrations []loader.RawMigration) []domain.Migration {
+	names := make(map[uint64]string, len(rawMigrations))
+	for _, rawMigration := range rawMigrations {
+		names[rawMigration.Version] = rawMigration.Name
+	}
+	for idx, migration := range migrations {
+		name, ok := names[migration.Version]
+		migrations[idx].Missing = migration.IsApplied && (!ok || name != migration.Name)
+	}
+
+	return migrations
+}
+
+// fillTags - дополняет теги миграций, не сохраненные в таблице миграций (например, у не примененных миграций),
+// тегами из их файлов.
+func fillTags(migrations []domain.Migration, rawMigrations []loader.RawMigration) []domain.Migration {
+	tags := make(map[uint64][]string, len(rawMigrations))
+	for _, rawMigration := range rawMigrations {
+		tags[rawMigration.Version] = rawMigration.Tags
+	}
+	for idx, migration := range migrations {
+		if len(migration.Tags) == 0 {
+			migrations[idx].Tags = tags[migration.Version]
 		}
+	}
+
+	return migrations
+}
 
-		return 0, fmt.Errorf("%w: %s", domain.ErrApplyingMigration, err.Error())
+// filterTags - возвращает миграции, прошедшие фильтр по тегам.
+func filterTags(filter loader.Filter, migrations []domain.Migration) []domain.Migration {
+	result := make([]domain.Migration, 0, len(migrations))
+	for _, migration := range migrations {
+		if filter.MatchTags(migration.Tags) {
+			result = append(result, migration)
+		}
 	}
 
-	if errCommit := tx.Commit(ctx); errCommit != nil {
-		return 0, fmt.Errorf("%w: %s", domain.ErrApplyingMigration, errCommit.Error())
+	return result
+}
+
+// tagFilter - возвращает фильтр миграций по тегам из конфигурации.
+func (mc *MigrateCore) tagFilter() (loader.Filter, error) {
+	tags, err := loader.NormalizeTags(mc.config.Tags)
+	if err != nil {
+		return loader.Filter{}, err
+	}
+	excludeTags, err := loader.NormalizeTags(mc.config.ExcludeTags)
+	if err != nil {
+		return loader.Filter{}, err
 	}
 
-	return result.RowsAffected(), nil
+	return loader.Filter{Tags: tags, ExcludeTags: excludeTags}, nil
+}
+
+// osUser - возвращает имя пользователя ОС, запустившего мигратор.
+func osUser() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+func (mc *MigrateCore) lockUID() uint32 {
+	schema, table := mc.config.MigrationsTable()
+	return util.GenerateUID(table, schema)
 }
 
 func (mc *MigrateCore) validateFormat(format string) error {
-	if format == config.FormatSQL || format == config.FormatGolang {
+	if format == config.FormatSQL || format == config.FormatGolang || format == config.FormatMixed {
 		return nil
 	}
 
-	return fmt.Errorf("%w (allow %s or %s)",
-		domain.ErrInvalidFormat, config.FormatSQL, config.FormatGolang)
+	return fmt.Errorf("%w (allow %s, %s or %s)",
+		domain.ErrInvalidFormat, config.FormatSQL, config.FormatGolang, config.FormatMixed)
 }
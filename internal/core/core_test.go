@@ -2,20 +2,27 @@ package core_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"testing/fstest"
+	"time"
 
-	"github.com/BashMS/SQL_migrator/internal/command" //nolint:depguard
-	"github.com/BashMS/SQL_migrator/internal/core"    //nolint:depguard
-	"github.com/BashMS/SQL_migrator/internal/loader"  //nolint:depguard
-	"github.com/BashMS/SQL_migrator/internal/storage" //nolint:depguard
-	"github.com/BashMS/SQL_migrator/pkg/config"       //nolint:depguard
-	"github.com/BashMS/SQL_migrator/pkg/domain"       //nolint:depguard
-	"github.com/BashMS/SQL_migrator/pkg/migrate"      //nolint:depguard
-	"github.com/BashMS/SQL_migrator/test"             //nolint:depguard
-	"github.com/jackc/pgconn"                         //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/command"  //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/core"     //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/loader"   //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/splitter" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/storage"  //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/config"        //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"        //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/migrate"       //nolint:depguard
+	"github.com/BashMS/SQL_migrator/test"              //nolint:depguard
+	"github.com/DATA-DOG/go-sqlmock"                   //nolint:depguard
+	"github.com/jackc/pgconn"                          //nolint:depguard
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"go.uber.org/zap/zaptest" //nolint:depguard
@@ -34,6 +41,7 @@ func TestMigrateCore_CreateMigrationFile(t *testing.T) {
 	tCases := []struct {
 		name          string
 		format        string
+		sqlLayout     string
 		giveName      string
 		giveVersion   uint64
 		expectedFiles []string
@@ -49,6 +57,24 @@ func TestMigrateCore_CreateMigrationFile(t *testing.T) {
 				filepath.Join(tmpDir, "1_bad_name________1.down.sql"),
 			},
 		},
+		{
+			name:        "single sql file",
+			format:      config.FormatSQL,
+			sqlLayout:   config.SQLLayoutSingle,
+			giveName:    "single file",
+			giveVersion: 2,
+			expectedFiles: []string{
+				filepath.Join(tmpDir, "2_single_file.sql"),
+			},
+		},
+		{
+			name:        "unknown sql layout",
+			format:      config.FormatSQL,
+			sqlLayout:   "unknown",
+			giveName:    "unknown layout",
+			giveVersion: 3,
+			expectedErr: domain.ErrInvalidSQLLayout,
+		},
 		{
 			name:        "bad go name",
 			format:      config.FormatGolang,
@@ -73,17 +99,22 @@ func TestMigrateCore_CreateMigrationFile(t *testing.T) {
 	for _, tCase := range tCases {
 		t.Run(tCase.name, func(t *testing.T) {
 			config.Format = tCase.format
+			config.SQLLayout = tCase.sqlLayout
 			err := migrateCore.CreateMigrationFile(tCase.giveName, tCase.giveVersion)
 			if tCase.expectedErr == nil {
 				assert.NoError(t, err)
 			} else {
-				assert.Equal(t, err, tCase.expectedErr)
+				assert.ErrorIs(t, err, tCase.expectedErr)
 			}
 			for _, expectedFile := range tCase.expectedFiles {
 				assert.FileExists(t, expectedFile)
 			}
 		})
 	}
+
+	// каталог для новых файлов не определен
+	config.Path = ""
+	assert.ErrorIs(t, migrateCore.CreateMigrationFile("no path", 4), loader.ErrMigrationPath)
 }
 
 func TestNewMigrateCore_CreateGoTemplate(t *testing.T) {
@@ -131,6 +162,7 @@ func TestMigrateCore_LoadMigrations(t *testing.T) {
 	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationDown).
 		Return(map[uint64]domain.Migration{}, nil)
 	mockStorage.On("RecentMigration", mock.Anything).Return(test.GetMigrationByVersion(2, true), nil)
+	mockStorage.On("Stats", mock.Anything).Return([]domain.Migration{dbMigrations[1], dbMigrations[2]}, nil)
 
 	tCases := []struct {
 		name                  string
@@ -194,6 +226,273 @@ func TestMigrateCore_LoadMigrations(t *testing.T) {
 	}
 }
 
+func TestMigrateCore_LoadMigrations_OutOfOrder(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockCommand := command.MockCommand{}
+
+	// миграции 2 и 3 не применены, хотя последняя примененная - 4
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+		Return(map[uint64]domain.Migration{
+			1: test.GetMigrationByVersion(1, true),
+			4: test.GetMigrationByVersion(4, true),
+		}, nil)
+	mockStorage.On("RecentMigration", mock.Anything).Return(test.GetMigrationByVersion(4, true), nil)
+
+	tCases := []struct {
+		name                  string
+		requestToVersion      uint64
+		allowOutOfOrder       bool
+		ci                    bool
+		expectedRawMigrations func(cfg *config.Config) []loader.RawMigration
+		expectedErr           error
+	}{
+		{
+			name: "skipped with warning",
+			expectedRawMigrations: func(cfg *config.Config) []loader.RawMigration {
+				return test.RawSQLMigrations(cfg, migrate.MigrationUp)[4:]
+			},
+		},
+		{
+			name:        "fail in CI mode",
+			ci:          true,
+			expectedErr: domain.ErrOutOfOrderMigrations,
+		},
+		{
+			name:            "applied in version order",
+			allowOutOfOrder: true,
+			ci:              true,
+			expectedRawMigrations: func(cfg *config.Config) []loader.RawMigration {
+				rawMigrations := test.RawSQLMigrations(cfg, migrate.MigrationUp)
+				return []loader.RawMigration{rawMigrations[1], rawMigrations[2], rawMigrations[4]}
+			},
+		},
+		{
+			name:             "up to version: skipped with warning",
+			requestToVersion: 5,
+			expectedRawMigrations: func(cfg *config.Config) []loader.RawMigration {
+				return test.RawSQLMigrations(cfg, migrate.MigrationUp)[4:5]
+			},
+		},
+		{
+			name:             "up to version: fail in CI mode",
+			requestToVersion: 5,
+			ci:               true,
+			expectedErr:      domain.ErrOutOfOrderMigrations,
+		},
+		{
+			name:             "up to version: applied in version order",
+			requestToVersion: 5,
+			allowOutOfOrder:  true,
+			ci:               true,
+			expectedRawMigrations: func(cfg *config.Config) []loader.RawMigration {
+				rawMigrations := test.RawSQLMigrations(cfg, migrate.MigrationUp)
+				return []loader.RawMigration{rawMigrations[1], rawMigrations[2], rawMigrations[4]}
+			},
+		},
+		{
+			name:             "up to an out-of-order version",
+			requestToVersion: 2,
+			ci:               true,
+			expectedErr:      domain.ErrOutOfOrderMigrations,
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			cfg := createConfig(t, defaultMigratePath)
+			cfg.AllowOutOfOrder = tCase.allowOutOfOrder
+			cfg.CI = tCase.ci
+			migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+			rawMigrations, err := migrateCore.LoadMigrations(context.Background(), tCase.requestToVersion,
+				migrate.MigrationUp)
+			if tCase.expectedErr != nil {
+				assert.ErrorIs(t, err, tCase.expectedErr)
+				assert.ErrorContains(t, err, "2 (testCreateSecondTable)")
+				return
+			}
+			assert.NoError(t, err)
+			assert.EqualValues(t, tCase.expectedRawMigrations(cfg), rawMigrations)
+		})
+	}
+}
+
+func TestMigrateCore_LoadMigrations_SQLSections(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+		Return(map[uint64]domain.Migration{}, nil)
+	mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+	mockCommand := command.MockCommand{}
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	cfg := createConfig(t, tmpDir)
+	cfg.SQLLayout = config.SQLLayoutSingle
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+	assert.NoError(t, migrateCore.CreateMigrationFile("sections", 1))
+
+	content := `-- создание таблицы пользователей
+-- +migrate Up
+CREATE TABLE users (id INTEGER);
+
+-- +migrate Down
+DROP TABLE users;
+`
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "1_sections.sql"), []byte(content), 0o600))
+
+	rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.NoError(t, err)
+	if assert.Len(t, rawMigrations, 1) {
+		assert.Equal(t, "sections", rawMigrations[0].Name)
+		assert.Equal(t, "CREATE TABLE users (id INTEGER);", rawMigrations[0].QueryUp)
+		assert.Equal(t, "DROP TABLE users;", rawMigrations[0].QueryDown)
+		assert.Equal(t, rawMigrations[0].PathUp, rawMigrations[0].PathDown)
+	}
+
+	// одно направление в двух файлах
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "1_sections.up.sql"), []byte("SELECT 1;"), 0o600))
+	_, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.ErrorContains(t, err, loader.ErrMigrationVersionUnique.Error())
+	assert.NoError(t, os.Remove(filepath.Join(tmpDir, "1_sections.up.sql")))
+
+	// миграция без транзакции
+	content = "-- +migrate NoTransaction\n-- +migrate Up\nCREATE INDEX CONCURRENTLY idx ON users (id);\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "1_sections.sql"), []byte(content), 0o600))
+	rawMigrations, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.NoError(t, err)
+	if assert.Len(t, rawMigrations, 1) {
+		assert.True(t, rawMigrations[0].NoTransaction)
+		assert.Equal(t, "CREATE INDEX CONCURRENTLY idx ON users (id);", rawMigrations[0].QueryUp)
+		assert.Empty(t, rawMigrations[0].QueryDown)
+	}
+
+	// запрос вне секций
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "2_outside.sql"), []byte("SELECT 1;\n-- +migrate Up\n"), 0o600))
+	_, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.ErrorContains(t, err, loader.ErrStatementOutsideSection.Error())
+}
+
+func TestMigrateCore_LoadMigrations_FS(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+		Return(map[uint64]domain.Migration{}, nil)
+	mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+	mockCommand := command.MockCommand{}
+
+	// каталог migrator.path не существует: миграции берутся только из fsys
+	cfg := createConfig(t, filepath.Join(os.TempDir(), "migrator-not-exists"))
+	cfg.Format = config.FormatSQL
+	fsys := fstest.MapFS{
+		"2_second.up.sql":           {Data: []byte("CREATE TABLE second (id INTEGER);")},
+		"2_second.down.sql":         {Data: []byte("DROP TABLE second;")},
+		"nested/1_first.sql":        {Data: []byte("-- +migrate Up\nCREATE TABLE first (id INTEGER);\n")},
+		"nested/R_view.sql":         {Data: []byte("CREATE OR REPLACE VIEW v AS SELECT 1;")},
+		"nested/readme.txt":         {Data: []byte("not a migration")},
+		"nested/deeper/3_third.sql": {Data: []byte("-- +migrate Up\nSELECT 3;\n")},
+	}
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+	_, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.ErrorContains(t, err, loader.ErrMigrationPath.Error())
+
+	migrateCore.SetFS(fsys)
+	rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.NoError(t, err)
+	if assert.Len(t, rawMigrations, 3) {
+		assert.Equal(t, "nested/1_first.sql", rawMigrations[0].PathUp)
+		assert.Equal(t, "CREATE TABLE first (id INTEGER);", rawMigrations[0].QueryUp)
+		assert.Equal(t, "2_second.up.sql", rawMigrations[1].PathUp)
+		assert.Equal(t, "2_second.down.sql", rawMigrations[1].PathDown)
+		assert.Equal(t, "DROP TABLE second;", rawMigrations[1].QueryDown)
+		assert.Equal(t, "nested/deeper/3_third.sql", rawMigrations[2].PathUp)
+	}
+
+	repeatable, err := migrateCore.LoadRepeatableMigrations(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, repeatable, 1) {
+		assert.Equal(t, "view", repeatable[0].Name)
+	}
+
+	problems, err := migrateCore.ValidateMigrations(context.Background())
+	assert.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestMigrateCore_LoadMigrations_MultiplePaths(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+		Return(map[uint64]domain.Migration{}, nil)
+	mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+	mockCommand := command.MockCommand{}
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	coreDir := filepath.Join(tmpDir, "core")
+	billingDir := filepath.Join(tmpDir, "modules", "billing", "migrations")
+	usersDir := filepath.Join(tmpDir, "modules", "users", "migrations")
+	files := map[string]string{
+		filepath.Join(coreDir, "1_init.sql"):          "-- +migrate Up\nCREATE TABLE core (id INTEGER);\n",
+		filepath.Join(coreDir, "4_core_index.sql"):    "-- +migrate Up\nCREATE INDEX idx ON core (id);\n",
+		filepath.Join(billingDir, "3_invoices.sql"):   "-- +migrate Up\nCREATE TABLE invoices (id INTEGER);\n",
+		filepath.Join(usersDir, "2_users.up.sql"):     "CREATE TABLE users (id INTEGER);",
+		filepath.Join(usersDir, "2_users.down.sql"):   "DROP TABLE users;",
+		filepath.Join(tmpDir, "modules", "readme.md"): "not a migration directory",
+	}
+	for path, content := range files {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+
+	cfg := createConfig(t, "")
+	cfg.Paths = []string{coreDir, filepath.Join(tmpDir, "modules", "*", "migrations"), coreDir}
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+	rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.NoError(t, err)
+	if assert.Len(t, rawMigrations, 4) {
+		assert.Equal(t, filepath.Join(coreDir, "1_init.sql"), rawMigrations[0].PathUp)
+		assert.Equal(t, filepath.Join(usersDir, "2_users.down.sql"), rawMigrations[1].PathDown)
+		assert.Equal(t, filepath.Join(billingDir, "3_invoices.sql"), rawMigrations[2].PathUp)
+		assert.Equal(t, filepath.Join(coreDir, "4_core_index.sql"), rawMigrations[3].PathUp)
+	}
+
+	// одна версия в разных каталогах
+	conflict := filepath.Join(billingDir, "4_payments.sql")
+	assert.NoError(t, os.WriteFile(conflict, []byte("-- +migrate Up\nSELECT 1;\n"), 0o600))
+	_, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.ErrorContains(t, err, filepath.Join(coreDir, "4_core_index.sql"))
+	assert.ErrorContains(t, err, conflict)
+
+	problems, err := migrateCore.ValidateMigrations(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, problems, 1) {
+		assert.ErrorContains(t, problems[0], conflict)
+	}
+	assert.NoError(t, os.Remove(conflict))
+
+	// файлы наката и отката одной версии в разных каталогах
+	ordersUp := filepath.Join(usersDir, "5_orders.up.sql")
+	ordersDown := filepath.Join(billingDir, "5_orders.down.sql")
+	assert.NoError(t, os.WriteFile(ordersUp, []byte("CREATE TABLE orders (id INTEGER);"), 0o600))
+	assert.NoError(t, os.WriteFile(ordersDown, []byte("DROP TABLE orders;"), 0o600))
+	_, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.ErrorContains(t, err, loader.ErrMigrationDifferentDirs.Error())
+	assert.ErrorContains(t, err, ordersUp)
+	assert.ErrorContains(t, err, ordersDown)
+
+	// шаблон без подходящих каталогов
+	cfg.Paths = []string{coreDir, filepath.Join(tmpDir, "plugins", "*")}
+	_, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.ErrorContains(t, err, loader.ErrMigrationPath.Error())
+	assert.ErrorContains(t, err, filepath.Join(tmpDir, "plugins", "*"))
+}
+
 func TestMigrateCore_StartMigrate_FormatGolang(t *testing.T) { //nolint:gocognit
 	zLogger := zaptest.NewLogger(t)
 	cfg := createConfig(t, defaultMigratePath)
@@ -260,15 +559,16 @@ func TestMigrateCore_StartMigrate_FormatGolang(t *testing.T) { //nolint:gocognit
 				returnErr = fmt.Errorf("error")
 			}
 
+			cfg.GoCacheDir = t.TempDir()
 			mockCommand := command.MockCommand{}
 			mockCommand.On(
-				"Run",
+				"Output",
 				mock.Anything,
 				"go",
-				command.Args{"mod", "init", "go/migration"},
+				command.Args{"env", "GOVERSION", "GOOS", "GOARCH"},
 				mock.Anything,
 				mock.Anything).
-				Return(nil)
+				Return([]byte("go1.22.3\nlinux\namd64\n"), nil)
 			mockCommand.On(
 				"Run",
 				mock.Anything,
@@ -279,10 +579,13 @@ func TestMigrateCore_StartMigrate_FormatGolang(t *testing.T) { //nolint:gocognit
 				Return(nil)
 
 			mockCommand.On(
-				"RunWithGracefulShutdown",
+				"Run",
 				mock.Anything,
 				"go",
-				command.Args{"run", "./..."}, mock.Anything,
+				mock.MatchedBy(func(args command.Args) bool {
+					return len(args) > 0 && args[0] == "build"
+				}),
+				mock.Anything,
 				mock.Anything).
 				Run(func(args mock.Arguments) {
 					if len(args) < 5 {
@@ -294,6 +597,16 @@ func TestMigrateCore_StartMigrate_FormatGolang(t *testing.T) { //nolint:gocognit
 						t.Fatal("in command.Run command, temporary directory is empty")
 					}
 
+					// программа собирается с локальным модулем мигратора
+					goMod, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+					assert.NoError(t, err)
+					moduleDir, err := filepath.Abs("./../..")
+					assert.NoError(t, err)
+					assert.Contains(t, string(goMod), fmt.Sprintf("replace github.com/BashMS/SQL_migrator => %q", moduleDir))
+					assert.Contains(t, args[4], "GOPROXY=off")
+					assert.Contains(t, args[4], "GOTOOLCHAIN=local")
+					assert.Contains(t, args[4], "GOFLAGS=-mod=mod")
+
 					for _, expectedFile := range tCase.expectedFiles {
 						newFile := filepath.Join(dir, expectedFile)
 						if !assert.FileExists(t, newFile) {
@@ -312,7 +625,20 @@ func TestMigrateCore_StartMigrate_FormatGolang(t *testing.T) { //nolint:gocognit
 							assertCompareFiles(t, originalFile, newFile)
 						}
 					}
-				}).Return(returnErr)
+				}).Return(nil)
+
+			mockCommand.On(
+				"RunWithGracefulShutdown",
+				mock.Anything,
+				mock.MatchedBy(func(program string) bool {
+					return filepath.Dir(program) == cfg.GoCacheDir
+				}),
+				command.Args{},
+				mock.Anything,
+				mock.MatchedBy(func(env command.Env) bool {
+					return env[len(env)-1] == "MIGRATOR_PROGRAM_DSN=dsn"
+				})).
+				Return(returnErr)
 
 			migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
 			count, err := migrateCore.StartMigrate(context.Background(), tCase.giveNeededMigrations, tCase.giveDirection)
@@ -323,6 +649,11 @@ func TestMigrateCore_StartMigrate_FormatGolang(t *testing.T) { //nolint:gocognit
 			}
 
 			assert.Equal(t, tCase.expectedCount, count)
+
+			// повторный запуск тех же миграций берет программу из кэша
+			_, _ = migrateCore.StartMigrate(context.Background(), tCase.giveNeededMigrations, tCase.giveDirection)
+			mockCommand.AssertNumberOfCalls(t, "Run", 2)
+			mockCommand.AssertNumberOfCalls(t, "RunWithGracefulShutdown", 2)
 		})
 	}
 }
@@ -382,6 +713,7 @@ func TestMigrateCore_StartMigrate_FormatSQL(t *testing.T) {
 				}).Return(pgconn.CommandTag{}, nil)
 
 			mockStorage := storage.MockMigrateStorage{}
+			mockStorage.On("SplitOptions").Return(splitter.Options{})
 			mockStorage.On("BeginTxMigration", mock.Anything, mock.Anything, tCase.giveDirection).
 				Run(func(args mock.Arguments) {
 					if len(args) < 3 {
@@ -392,7 +724,10 @@ func TestMigrateCore_StartMigrate_FormatSQL(t *testing.T) {
 					if !ok {
 						t.Fatal("failed to get current migration")
 					}
-				}).Return(&mockTx, nil)
+				}).Return(storage.NewPgxTx(&mockTx), nil)
+			mockStorage.On("RecordExecution", mock.Anything, mock.MatchedBy(func(execution domain.Execution) bool {
+				return execution.Outcome == domain.OutcomeSuccess
+			})).Return(nil)
 
 			migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
 			count, err := migrateCore.StartMigrate(context.Background(), tCase.giveNeededMigrations, tCase.giveDirection)
@@ -402,6 +737,145 @@ func TestMigrateCore_StartMigrate_FormatSQL(t *testing.T) {
 	}
 }
 
+func TestMigrateCore_Lock(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockCommand := command.MockCommand{}
+
+	tCases := []struct {
+		name            string
+		giveLockTimeout time.Duration
+		giveLockErr     error
+		expectedTimeout time.Duration
+	}{
+		{
+			name:            "default timeout",
+			giveLockTimeout: 0,
+			expectedTimeout: config.DefaultLockTimeout,
+		},
+		{
+			name:            "configured timeout",
+			giveLockTimeout: 5 * time.Second,
+			expectedTimeout: 5 * time.Second,
+		},
+		{
+			name:            "lock is held by another process",
+			giveLockTimeout: time.Second,
+			giveLockErr:     fmt.Errorf("%w: the lock is held by backend with pid 42", storage.ErrLock),
+			expectedTimeout: time.Second,
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			cfg := createConfig(t, defaultMigratePath)
+			cfg.LockTimeout = tCase.giveLockTimeout
+
+			mockStorage := storage.MockMigrateStorage{}
+			mockStorage.On("Lock", mock.Anything, mock.Anything, tCase.expectedTimeout).Return(tCase.giveLockErr)
+			mockStorage.On("UnLock", mock.Anything).Return(nil)
+
+			migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+			unlockFunc, err := migrateCore.Lock(context.Background())
+			if tCase.giveLockErr != nil {
+				assert.ErrorIs(t, err, storage.ErrLock)
+				assert.Nil(t, unlockFunc)
+				mockStorage.AssertNotCalled(t, "UnLock", mock.Anything)
+				return
+			}
+
+			assert.NoError(t, err)
+			unlockFunc()
+			mockStorage.AssertCalled(t, "UnLock", mock.Anything)
+		})
+	}
+}
+
+func TestMigrateCore_VerifyMigrations(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	cfg := createConfig(t, defaultMigratePath)
+	mockCommand := command.MockCommand{}
+
+	intact := test.GetMigrationByVersion(1, true)
+	intact.Checksum = test.RawSQLMigrations(cfg, migrate.MigrationUp)[0].Checksum
+	modified := test.GetMigrationByVersion(2, true)
+	modified.Checksum = "0000000000000000000000000000000000000000000000000000000000000000"
+	withoutChecksum := test.GetMigrationByVersion(3, true)
+	notApplied := test.GetMigrationByVersion(4, false)
+	notApplied.Checksum = modified.Checksum
+
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("Stats", mock.Anything).
+		Return([]domain.Migration{intact, modified, withoutChecksum, notApplied}, nil)
+
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+	migrations, err := migrateCore.VerifyMigrations(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.Migration{modified}, migrations)
+
+	err = migrateCore.CheckModified(context.Background())
+	assert.ErrorIs(t, err, domain.ErrMigrationsModified)
+}
+
+func TestMigrateCore_CheckDirty(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	cfg := createConfig(t, defaultMigratePath)
+	mockCommand := command.MockCommand{}
+
+	dirty := test.GetMigrationByVersion(2, false)
+	dirty.Status = domain.StatusRunning
+	dirty.Dirty = true
+
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("Stats", mock.Anything).
+		Return([]domain.Migration{test.GetMigrationByVersion(1, true), dirty}, nil).Once()
+	mockStorage.On("Stats", mock.Anything).
+		Return([]domain.Migration{test.GetMigrationByVersion(1, true)}, nil).Once()
+
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+	assert.ErrorIs(t, migrateCore.CheckDirty(context.Background()), domain.ErrDirtyMigration)
+	assert.NoError(t, migrateCore.CheckDirty(context.Background()))
+}
+
+func TestMigrateCore_StartMigrate_FailedSQL(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	cfg := createConfig(t, defaultMigratePath)
+	cfg.Format = config.FormatSQL
+	mockCommand := command.MockCommand{}
+
+	rawMigration := test.GetRawMigrationByVersion(5)
+	migration := domain.Migration{
+		Version:  rawMigration.Version,
+		Name:     rawMigration.Name,
+		Checksum: rawMigration.Checksum,
+	}
+
+	mockTx := test.MockTx{}
+	mockTx.On("Exec", mock.Anything, rawMigration.QueryUp, mock.Anything).
+		Return(pgconn.CommandTag{}, fmt.Errorf("syntax error"))
+	mockTx.On("Rollback", mock.Anything).Return(nil)
+
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("SplitOptions").Return(splitter.Options{})
+	mockStorage.On("BeginTxMigration", mock.Anything, migration, migrate.MigrationUp).Return(storage.NewPgxTx(&mockTx), nil)
+	mockStorage.On("FailMigration", mock.Anything, migration, false).Return(nil)
+	mockStorage.On("RecordExecution", mock.Anything, mock.MatchedBy(func(execution domain.Execution) bool {
+		return execution.Version == migration.Version &&
+			execution.Direction == domain.DirectionUp &&
+			execution.Outcome == domain.OutcomeFailed &&
+			execution.Error != ""
+	})).Return(nil)
+
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+	count, err := migrateCore.StartMigrate(
+		context.Background(),
+		[]loader.RawMigration{rawMigration},
+		migrate.MigrationUp)
+	assert.ErrorIs(t, err, domain.ErrApplyingMigration)
+	assert.Equal(t, 0, count)
+	mockStorage.AssertCalled(t, "FailMigration", mock.Anything, migration, false)
+	mockStorage.AssertNumberOfCalls(t, "RecordExecution", 1)
+}
+
 func assertCompareFiles(t *testing.T, originalFile, newFile string) {
 	t.Helper()
 	assert.EqualValues(t, fileGetContents(t, originalFile), fileGetContents(t, newFile))
@@ -439,3 +913,807 @@ func createConfig(t *testing.T, migratePath string) *config.Config {
 
 	return &config
 }
+
+func TestMigrateCore_StartMigrate_GolangWithoutDSN(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	cfg := createConfig(t, defaultMigratePath)
+	cfg.Format = config.FormatGolang
+	cfg.DSN = ""
+	mockStorage := storage.MockMigrateStorage{}
+	mockCommand := command.MockCommand{}
+
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+	count, err := migrateCore.StartMigrate(context.Background(),
+		test.RawGoMigrations(cfg, migrate.MigrationUp), migrate.MigrationUp)
+	assert.ErrorIs(t, err, domain.ErrGoMigrationsRequireDSN)
+	assert.Equal(t, 0, count)
+	mockCommand.AssertExpectations(t)
+}
+
+func TestMigrateCore_StartMigrate_StatementError(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	cfg := createConfig(t, defaultMigratePath)
+	mockCommand := command.MockCommand{}
+
+	rawMigration := loader.RawMigration{
+		Version:      7,
+		Name:         "twoStatements",
+		PathUp:       "/migrations/7_two_statements.sql",
+		PathDown:     "/migrations/7_two_statements.sql",
+		Format:       config.FormatSQL,
+		QueryUp:      "CREATE TABLE a (id INT);\nSELECT 1 FORM a;",
+		LineOffsetUp: 3,
+	}
+	migration := domain.Migration{Version: rawMigration.Version, Name: rawMigration.Name}
+
+	mockTx := test.MockTx{}
+	mockTx.On("Exec", mock.Anything, "CREATE TABLE a (id INT);", mock.Anything).
+		Return(pgconn.CommandTag{}, nil)
+	mockTx.On("Exec", mock.Anything, "SELECT 1 FORM a;", mock.Anything).
+		Return(pgconn.CommandTag{}, &pgconn.PgError{Severity: "ERROR", Code: "42601", Message: "syntax error", Position: 10})
+	mockTx.On("Rollback", mock.Anything).Return(nil)
+
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("SplitOptions").Return(splitter.Options{})
+	mockStorage.On("BeginTxMigration", mock.Anything, migration, migrate.MigrationUp).Return(storage.NewPgxTx(&mockTx), nil)
+	mockStorage.On("FailMigration", mock.Anything, migration, false).Return(nil)
+	mockStorage.On("RecordExecution", mock.Anything, mock.Anything).Return(nil)
+
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+	count, err := migrateCore.StartMigrate(context.Background(), []loader.RawMigration{rawMigration}, migrate.MigrationUp)
+	assert.ErrorIs(t, err, domain.ErrApplyingMigration)
+	assert.ErrorContains(t, err, "/migrations/7_two_statements.sql: statement 2 (line 5, column 10)")
+	assert.Equal(t, 0, count)
+	mockTx.AssertNumberOfCalls(t, "Exec", 2)
+	mockTx.AssertNotCalled(t, "Commit", mock.Anything)
+}
+
+func TestMigrateCore_StartMigrate_MySQLWithDB(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	// пул передан приложением (migrate.WithDB): DSN нет, особенности разбора берутся из диалекта хранилища
+	cfg := &config.Config{Format: config.FormatSQL}
+	db, sqlMock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	rawMigration := loader.RawMigration{
+		Version:  9,
+		Name:     "mysqlStrings",
+		PathUp:   "/migrations/9_mysql_strings.sql",
+		PathDown: "/migrations/9_mysql_strings.sql",
+		Format:   config.FormatSQL,
+		QueryUp: "# users can't; be empty\n" +
+			"INSERT INTO users (name) VALUES ('it\\'s; fine'); # the quote ' and ; in a comment\n" +
+			"INSERT INTO users (name) VALUES (\"a;b\");\n",
+	}
+
+	sqlMock.ExpectExec(regexp.QuoteMeta("INSERT IGNORE INTO `tmigration`")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec("UPDATE `tmigration`\\s+SET status").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectBegin()
+	// запросы сравниваются целиком: комментарий не должен попасть в запрос, а строка - разбиться
+	sqlMock.ExpectExec("^" + regexp.QuoteMeta("INSERT INTO users (name) VALUES ('it\\'s; fine');") + "$").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec("^" + regexp.QuoteMeta(`INSERT INTO users (name) VALUES ("a;b");`) + "$").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectExec("UPDATE `tmigration`\\s+SET is_applied").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	sqlMock.ExpectCommit()
+	sqlMock.ExpectExec(regexp.QuoteMeta("INSERT INTO `tmigration_history`")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	migrateStorage := storage.NewStorageWithDB(zLogger, cfg, db, migrate.DialectMySQL)
+	migrateCore := core.NewMigrateCore(migrateStorage, &command.MockCommand{}, zLogger, cfg)
+	count, err := migrateCore.StartMigrate(context.Background(), []loader.RawMigration{rawMigration}, migrate.MigrationUp)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.NoError(t, sqlMock.ExpectationsWereMet())
+}
+
+func TestMigrateCore_StartMigrate_NoTransaction(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	cfg := createConfig(t, defaultMigratePath)
+	mockCommand := command.MockCommand{}
+
+	rawMigration := loader.RawMigration{
+		Version:       8,
+		Name:          "concurrentIndex",
+		PathUp:        "/migrations/8_concurrent_index.sql",
+		PathDown:      "/migrations/8_concurrent_index.sql",
+		Format:        config.FormatSQL,
+		QueryUp:       "CREATE INDEX CONCURRENTLY idx_a ON a (id);\nCREATE INDEX CONCURRENTLY idx_b ON b (id);",
+		NoTransaction: true,
+	}
+	migration := domain.Migration{Version: rawMigration.Version, Name: rawMigration.Name}
+
+	mockTx := test.MockTx{}
+	mockTx.On("Exec", mock.Anything, "CREATE INDEX CONCURRENTLY idx_a ON a (id);", mock.Anything).
+		Return(pgconn.CommandTag{}, nil)
+	mockTx.On("Exec", mock.Anything, "CREATE INDEX CONCURRENTLY idx_b ON b (id);", mock.Anything).
+		Return(pgconn.CommandTag{}, fmt.Errorf("relation \"b\" does not exist"))
+	mockTx.On("Rollback", mock.Anything).Return(nil)
+
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("SplitOptions").Return(splitter.Options{})
+	mockStorage.On("BeginNoTxMigration", mock.Anything, migration, migrate.MigrationUp).
+		Return(storage.NewPgxTx(&mockTx), nil)
+	mockStorage.On("FailMigration", mock.Anything, migration, true).Return(nil)
+	mockStorage.On("RecordExecution", mock.Anything, mock.Anything).Return(nil)
+
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+	count, err := migrateCore.StartMigrate(context.Background(), []loader.RawMigration{rawMigration}, migrate.MigrationUp)
+	assert.ErrorIs(t, err, domain.ErrApplyingMigration)
+	assert.ErrorIs(t, err, domain.ErrDirtyMigration)
+	assert.Equal(t, 0, count)
+	mockStorage.AssertNotCalled(t, "BeginTxMigration", mock.Anything, mock.Anything, mock.Anything)
+	mockStorage.AssertCalled(t, "FailMigration", mock.Anything, migration, true)
+}
+
+func TestMigrateCore_LoadMigrations_Vars(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+		Return(map[uint64]domain.Migration{}, nil)
+	mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+	mockCommand := command.MockCommand{}
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	content := "-- +migrate Template\n-- +migrate Up\nGRANT SELECT ON users TO {{ .Vars.app_role }};\n" +
+		"-- +migrate Down\nREVOKE SELECT ON users FROM {{ .Vars.app_role }};\n"
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "1_grant.sql"), []byte(content), 0o600))
+	// без директивы Template запросы не являются шаблоном
+	literal := "INSERT INTO matrix (value) VALUES ('{{1,2},{3,4}}');"
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "2_matrix.up.sql"), []byte(literal), 0o600))
+
+	cfg := createConfig(t, tmpDir)
+	assert.NoError(t, cfg.SetVars([]string{"APP_ROLE=reader"}))
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+	rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.NoError(t, err)
+	if !assert.Len(t, rawMigrations, 2) {
+		return
+	}
+	assert.Equal(t, "GRANT SELECT ON users TO reader;", rawMigrations[0].QueryUp)
+	assert.Equal(t, "REVOKE SELECT ON users FROM reader;", rawMigrations[0].QueryDown)
+	assert.Equal(t, literal, rawMigrations[1].QueryUp)
+	checksum := rawMigrations[0].Checksum
+
+	// контрольная сумма не зависит от значений переменных
+	cfg.Vars["app_role"] = "writer"
+	rawMigrations, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.NoError(t, err)
+	if assert.Len(t, rawMigrations, 2) {
+		assert.Equal(t, "GRANT SELECT ON users TO writer;", rawMigrations[0].QueryUp)
+		assert.Equal(t, checksum, rawMigrations[0].Checksum)
+	}
+
+	// неизвестная переменная
+	delete(cfg.Vars, "app_role")
+	_, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.ErrorContains(t, err, loader.ErrRenderTemplate.Error())
+
+	assert.ErrorIs(t, cfg.SetVars([]string{"without_value"}), config.ErrInvalidVar)
+}
+
+func TestMigrateCore_RepeatableMigrations(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockCommand := command.MockCommand{}
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"1_create_users.sql": "-- +migrate Up\nCREATE TABLE users (id INT);\n-- +migrate Down\nDROP TABLE users;\n",
+		"R_users_view.sql":   "CREATE OR REPLACE VIEW users_view AS SELECT id FROM users;\n",
+		"R_grants.sql":       "GRANT SELECT ON users_view TO reader;\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o600))
+	}
+	cfg := createConfig(t, tmpDir)
+
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+		Return(map[uint64]domain.Migration{}, nil)
+	mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+	// повторяемые миграции не попадают в версионные
+	rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.NoError(t, err)
+	if assert.Len(t, rawMigrations, 1) {
+		assert.Equal(t, uint64(1), rawMigrations[0].Version)
+	}
+
+	repeatableMigrations, err := migrateCore.LoadRepeatableMigrations(context.Background())
+	assert.NoError(t, err)
+	if !assert.Len(t, repeatableMigrations, 2) {
+		return
+	}
+	grants, usersView := repeatableMigrations[0], repeatableMigrations[1]
+	assert.Equal(t, "grants", grants.Name)
+	assert.Equal(t, "usersView", usersView.Name)
+	assert.True(t, usersView.Repeatable)
+	assert.NotEmpty(t, usersView.Checksum)
+
+	// накатывается только миграция, контрольная сумма которой изменилась
+	appliedAt := time.Now()
+	mockStorage.On("RepeatableMigrations", mock.Anything).Return([]domain.RepeatableMigration{
+		{Name: grants.Name, Checksum: grants.Checksum, Status: domain.StatusApplied, AppliedAt: appliedAt},
+		{Name: usersView.Name, Checksum: "outdated", Status: domain.StatusApplied, AppliedAt: appliedAt},
+	}, nil)
+	mockTx := test.MockTx{}
+	mockTx.On("Exec", mock.Anything, "CREATE OR REPLACE VIEW users_view AS SELECT id FROM users;", mock.Anything).
+		Return(pgconn.CommandTag{}, nil)
+	mockTx.On("Commit", mock.Anything).Return(nil)
+	mockStorage.On("SplitOptions").Return(splitter.Options{})
+	mockStorage.On("BeginTxRepeatableMigration", mock.Anything,
+		domain.RepeatableMigration{Name: usersView.Name, Checksum: usersView.Checksum}).
+		Return(storage.NewPgxTx(&mockTx), nil)
+	mockStorage.On("RecordExecution", mock.Anything, mock.Anything).Return(nil)
+
+	count, err := migrateCore.StartRepeatableMigrate(context.Background(), repeatableMigrations)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	mockStorage.AssertNumberOfCalls(t, "BeginTxRepeatableMigration", 1)
+	mockTx.AssertCalled(t, "Commit", mock.Anything)
+
+	// статус
+	statuses, err := migrateCore.GetRepeatableMigrations(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []domain.RepeatableMigration{
+		{Name: grants.Name, Checksum: grants.Checksum, Status: domain.StatusApplied, AppliedAt: appliedAt},
+		{Name: usersView.Name, Checksum: usersView.Checksum, Status: domain.StatusOutdated, AppliedAt: appliedAt},
+	}, statuses)
+
+	// одинаковые имена
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "R_usersView.sql"), []byte("SELECT 1;"), 0o600))
+	_, err = migrateCore.LoadRepeatableMigrations(context.Background())
+	assert.ErrorContains(t, err, loader.ErrRepeatableNameUnique.Error())
+}
+
+func TestMigrateCore_MissingMigrations(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockCommand := command.MockCommand{}
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	// файл миграции 2 удален, у миграции 3 нет файла отката
+	files := map[string]string{
+		"1_first.sql":    "-- +migrate Up\nCREATE TABLE first (id INT);\n-- +migrate Down\nDROP TABLE first;\n",
+		"3_third.up.sql": "CREATE TABLE third (id INT);",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o600))
+	}
+	cfg := createConfig(t, tmpDir)
+
+	dbMigrations := []domain.Migration{
+		{Version: 3, Name: "third", IsApplied: true, Status: domain.StatusApplied},
+		{Version: 2, Name: "second", IsApplied: true, Status: domain.StatusApplied},
+		{Version: 1, Name: "first", IsApplied: true, Status: domain.StatusApplied},
+	}
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("Stats", mock.Anything).Return(func(context.Context) []domain.Migration {
+		return append([]domain.Migration(nil), dbMigrations...)
+	}, nil)
+	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationDown).
+		Return(map[uint64]domain.Migration{}, nil)
+	mockStorage.On("RecentMigration", mock.Anything).Return(dbMigrations[0], nil)
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+	missing, err := migrateCore.MissingMigrations(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, missing, 1) {
+		assert.Equal(t, uint64(2), missing[0].Version)
+	}
+
+	migrations, err := migrateCore.GetMigrations(context.Background())
+	assert.NoError(t, err)
+	if assert.Len(t, migrations, 3) {
+		assert.False(t, migrations[0].Missing)
+		assert.True(t, migrations[1].Missing)
+		assert.False(t, migrations[2].Missing)
+	}
+
+	// откат через отсутствующие файлы запрещен
+	_, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationDown)
+	assert.ErrorIs(t, err, domain.ErrMissingDownMigration)
+	assert.ErrorContains(t, err, "2 (second): file is missing")
+	assert.ErrorContains(t, err, "3 (third): down file is missing")
+
+	// откат до версии 3 не затрагивает миграцию 2, но у миграции 3 нет файла отката
+	_, err = migrateCore.LoadMigrations(context.Background(), 3, migrate.MigrationDown)
+	assert.ErrorIs(t, err, domain.ErrMissingDownMigration)
+	assert.NotContains(t, err.Error(), "second")
+
+	// с Force миграции без файлов откатываются без выполнения запросов
+	cfg.Force = true
+	rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationDown)
+	assert.NoError(t, err)
+	versions := make([]uint64, 0, len(rawMigrations))
+	for _, rawMigration := range rawMigrations {
+		versions = append(versions, rawMigration.Version)
+	}
+	assert.Equal(t, []uint64{3, 2, 1}, versions)
+	if assert.Len(t, rawMigrations, 3) {
+		assert.Empty(t, rawMigrations[1].QueryDown)
+		assert.Equal(t, "second", rawMigrations[1].Name)
+	}
+}
+
+func TestMigrateCore_LoadMigrations_Dependencies(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockCommand := command.MockCommand{}
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	// миграция 2 из другой ветки зависит от более поздней миграции 4
+	files := map[string]string{
+		"1_first.sql":       "-- +migrate Up\nSELECT 1;\n-- +migrate Down\nSELECT -1;\n",
+		"2_second.up.sql":   "-- +migrate Requires 4\n-- +migrate Tags legacy\nSELECT 2;",
+		"2_second.down.sql": "SELECT -2;",
+		"3_third.sql":       "-- +migrate Up\nSELECT 3;\n-- +migrate Down\nSELECT -3;\n",
+		"4_fourth.sql":      "-- +migrate Requires 1, 3\n-- +migrate Up\nSELECT 4;\n-- +migrate Down\nSELECT -4;\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o600))
+	}
+	cfg := createConfig(t, tmpDir)
+	versionsOf := func(rawMigrations []loader.RawMigration) []uint64 {
+		versions := make([]uint64, 0, len(rawMigrations))
+		for _, rawMigration := range rawMigrations {
+			versions = append(versions, rawMigration.Version)
+		}
+		return versions
+	}
+
+	t.Run("up in topological order", func(t *testing.T) {
+		mockStorage := storage.MockMigrateStorage{}
+		mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+			Return(map[uint64]domain.Migration{}, nil)
+		mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+		migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+		rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{1, 3, 4, 2}, versionsOf(rawMigrations))
+		if assert.Len(t, rawMigrations, 4) {
+			assert.Equal(t, []uint64{1, 3}, rawMigrations[2].Requires)
+		}
+
+		// миграция 2 требует миграцию 4, которая не накатывается
+		_, err = migrateCore.LoadMigrations(context.Background(), 2, migrate.MigrationUp)
+		assert.ErrorIs(t, err, domain.ErrDependencyNotApplied)
+		assert.ErrorContains(t, err, "2 (second) requires 4")
+	})
+
+	t.Run("down in reverse topological order", func(t *testing.T) {
+		dbMigrations := []domain.Migration{
+			{Version: 2, Name: "second", IsApplied: true, Status: domain.StatusApplied},
+			{Version: 4, Name: "fourth", IsApplied: true, Status: domain.StatusApplied},
+			{Version: 3, Name: "third", IsApplied: true, Status: domain.StatusApplied},
+			{Version: 1, Name: "first", IsApplied: true, Status: domain.StatusApplied},
+		}
+		mockStorage := storage.MockMigrateStorage{}
+		mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationDown).
+			Return(map[uint64]domain.Migration{}, nil)
+		// хранилище возвращает примененную миграцию с наибольшей версией
+		mockStorage.On("RecentMigration", mock.Anything).Return(dbMigrations[1], nil)
+		mockStorage.On("Stats", mock.Anything).Return(dbMigrations, nil)
+		migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+		// миграции накатывались в порядке 1, 3, 4, 2, поэтому последней откатывается 2, а не 4
+		migration, err := migrateCore.GetLastAppliedMigration(context.Background())
+		assert.NoError(t, err)
+		if assert.NotNil(t, migration) {
+			assert.Equal(t, uint64(2), migration.Version)
+		}
+		for requestToVersion, expected := range map[uint64][]uint64{
+			2: {2},
+			4: {2, 4},
+			3: {2, 4, 3},
+			0: {2, 4, 3, 1},
+		} {
+			rawMigrations, err := migrateCore.LoadMigrations(context.Background(), requestToVersion, migrate.MigrationDown)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, versionsOf(rawMigrations), "down to %d", requestToVersion)
+		}
+
+		// миграция 2 не откатывается из-за фильтра по тегам, но зависит от миграции 4
+		cfg.ExcludeTags = []string{"legacy"}
+		defer func() { cfg.ExcludeTags = nil }()
+		_, err = migrateCore.LoadMigrations(context.Background(), 4, migrate.MigrationDown)
+		assert.ErrorIs(t, err, domain.ErrDependentMigrations)
+		assert.ErrorContains(t, err, "4 is required by 2 (second)")
+	})
+
+	t.Run("missing parents and cycles", func(t *testing.T) {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "5_fifth.sql"),
+			[]byte("-- +migrate Requires 6 99\n-- +migrate Up\nSELECT 5;\n"), 0o600))
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "6_sixth.sql"),
+			[]byte("-- +migrate Requires 5\n-- +migrate Up\nSELECT 6;\n"), 0o600))
+		mockStorage := storage.MockMigrateStorage{}
+		mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+			Return(map[uint64]domain.Migration{}, nil)
+		mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+		migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+		_, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+		assert.ErrorContains(t, err, loader.ErrDependencyCycle.Error())
+		assert.ErrorContains(t, err, "5 (fifth) requires 6 (sixth) requires 5 (fifth)")
+
+		problems, err := migrateCore.ValidateMigrations(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, containsError(problems, loader.ErrDependencyNotFound))
+		assert.True(t, containsError(problems, loader.ErrDependencyCycle))
+	})
+}
+
+func TestMigrateCore_ValidateMigrations(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockStorage := storage.MockMigrateStorage{}
+
+	t.Run("sql", func(t *testing.T) {
+		tmpDir := createTempDir(t)
+		defer os.RemoveAll(tmpDir)
+
+		files := map[string]string{
+			"1_first.up.sql":    "CREATE TABLE first (id INT);",
+			"1_second.down.sql": "DROP TABLE first;",
+			"2_dup.sql":         "-- +migrate Up\nCREATE TABLE dup (id INT);\n-- +migrate Down\nDROP TABLE dup;\n",
+			"2_dup.up.sql":      "CREATE TABLE dup (id INT);",
+			"3_no_down.up.sql":  "CREATE TABLE no_down (id INT);",
+			"4_empty.up.sql":    "-- nothing to do\n",
+			"4_empty.down.sql":  "SELECT 1;",
+			"5_ok.sql":          "-- +migrate Up\nCREATE TABLE ok (id INT);\n-- +migrate Down\nDROP TABLE ok;\n",
+			"bad.sql":           "-- +migrate Up\nSELECT 1;\n",
+			"x_bad.sql":         "-- +migrate Up\nSELECT 1;\n",
+		}
+		for name, content := range files {
+			assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o600))
+		}
+
+		mockCommand := command.MockCommand{}
+		migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, createConfig(t, tmpDir))
+		problems, err := migrateCore.ValidateMigrations(context.Background())
+		assert.NoError(t, err)
+		for _, expected := range []error{
+			loader.ErrMigrationsSameName,
+			loader.ErrMigrationVersionUnique,
+			loader.ErrDownFileNotFound,
+			loader.ErrEmptyUp,
+			loader.ErrSeparatorNotFound,
+			loader.ErrMigrateVersionFile,
+		} {
+			assert.Truef(t, containsError(problems, expected), "problem %q not found in %v", expected, problems)
+		}
+		for _, problem := range problems {
+			assert.NotContains(t, problem.Error(), "5_ok.sql")
+		}
+	})
+
+	t.Run("go", func(t *testing.T) {
+		tmpDir := createTempDir(t)
+		defer os.RemoveAll(tmpDir)
+
+		content, err := os.ReadFile(filepath.Join(defaultMigratePath, "1_test_create_first_table.go"))
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "1_test_create_first_table.go"), content, 0o600))
+
+		cfg := createConfig(t, tmpDir)
+		cfg.Format = config.FormatGolang
+		cfg.GoCacheDir = t.TempDir()
+		mockCommand := command.MockCommand{}
+		mockCommand.On("Output", mock.Anything, "go", mock.Anything, mock.Anything, mock.Anything).
+			Return([]byte("go1.22.3\nlinux\namd64\n"), nil)
+		mockCommand.On("Run", mock.Anything, "go", command.Args{"mod", "tidy"}, mock.Anything, mock.Anything).
+			Return(nil)
+		mockCommand.On("Run", mock.Anything, "go", mock.MatchedBy(func(args command.Args) bool {
+			return len(args) > 0 && args[0] == "build"
+		}), mock.Anything, mock.Anything).Return(fmt.Errorf("exit status 1"))
+		migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+		// программа собирается, только если go-файлы разобраны без ошибок
+		problems, err := migrateCore.ValidateMigrations(context.Background())
+		assert.NoError(t, err)
+		if assert.Len(t, problems, 1) {
+			assert.ErrorIs(t, problems[0], domain.ErrBuildProgramForMigrations)
+		}
+
+		broken := "package main\n\nfunc Up2broken(ctx context.Context, tx pgx.Tx) error {\n\treturn nil\n"
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "2_broken.go"), []byte(broken), 0o600))
+		problems, err = migrateCore.ValidateMigrations(context.Background())
+		assert.NoError(t, err)
+		if assert.Len(t, problems, 1) {
+			assert.ErrorIs(t, problems[0], loader.ErrGoParse)
+		}
+		mockCommand.AssertNumberOfCalls(t, "Run", 2)
+	})
+}
+
+func containsError(errs []error, target error) bool {
+	for _, err := range errs {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestMigrateCore_LoadMigrations_Tags(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+	mockCommand := command.MockCommand{}
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"1_first.sql":       "-- +migrate Up\nSELECT 1;\n-- +migrate Down\nSELECT -1;\n",
+		"2_seed.up.sql":     "-- +migrate Tags Dev, seed\nSELECT 2;",
+		"2_seed.down.sql":   "SELECT -2;",
+		"3_analytics.sql":   "-- +migrate Tags analytics\n-- +migrate Up\nSELECT 3;\n-- +migrate Down\nSELECT -3;\n",
+		"4_dev_reports.sql": "-- +migrate Tags dev analytics\n-- +migrate Up\nSELECT 4;\n-- +migrate Down\nSELECT -4;\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o600))
+	}
+	versionsOf := func(rawMigrations []loader.RawMigration) []uint64 {
+		versions := make([]uint64, 0, len(rawMigrations))
+		for _, rawMigration := range rawMigrations {
+			versions = append(versions, rawMigration.Version)
+		}
+		return versions
+	}
+	loadUp := func(t *testing.T, tags, excludeTags []string) ([]loader.RawMigration, error) {
+		t.Helper()
+		cfg := createConfig(t, tmpDir)
+		cfg.Tags = tags
+		cfg.ExcludeTags = excludeTags
+		mockStorage := storage.MockMigrateStorage{}
+		mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+			Return(map[uint64]domain.Migration{}, nil)
+		mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+		migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+		return migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	}
+
+	t.Run("up filters by tags", func(t *testing.T) {
+		rawMigrations, err := loadUp(t, nil, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2, 3, 4}, versionsOf(rawMigrations))
+		if assert.Len(t, rawMigrations, 4) {
+			assert.Equal(t, []string{"dev", "seed"}, rawMigrations[1].Tags)
+		}
+
+		// миграции без тегов накатываются всегда
+		rawMigrations, err = loadUp(t, []string{"dev"}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2, 4}, versionsOf(rawMigrations))
+
+		rawMigrations, err = loadUp(t, nil, []string{"ANALYTICS"})
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{1, 2}, versionsOf(rawMigrations))
+
+		rawMigrations, err = loadUp(t, []string{"dev", "analytics"}, []string{"seed"})
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{1, 3, 4}, versionsOf(rawMigrations))
+
+		_, err = loadUp(t, []string{"dev prod"}, nil)
+		assert.ErrorIs(t, err, loader.ErrInvalidTags)
+	})
+
+	t.Run("down and status skip excluded tags", func(t *testing.T) {
+		// файл миграции 5 удален, ее теги сохранены в таблице миграций
+		dbMigrations := []domain.Migration{
+			{Version: 5, Name: "legacy", IsApplied: true, Status: domain.StatusApplied, Tags: []string{"analytics"}},
+			{Version: 3, Name: "analytics", IsApplied: true, Status: domain.StatusApplied},
+			{Version: 2, Name: "seed", IsApplied: true, Status: domain.StatusApplied, Tags: []string{"dev", "seed"}},
+			{Version: 1, Name: "first", IsApplied: true, Status: domain.StatusApplied},
+		}
+		cfg := createConfig(t, tmpDir)
+		cfg.ExcludeTags = []string{"analytics"}
+		mockStorage := storage.MockMigrateStorage{}
+		mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationDown).
+			Return(map[uint64]domain.Migration{}, nil)
+		mockStorage.On("RecentMigration", mock.Anything).Return(dbMigrations[0], nil)
+		mockStorage.On("Stats", mock.Anything).Return(dbMigrations, nil)
+		migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+		rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 1, migrate.MigrationDown)
+		assert.NoError(t, err)
+		assert.Equal(t, []uint64{2, 1}, versionsOf(rawMigrations))
+
+		migrations, err := migrateCore.GetMigrations(context.Background())
+		assert.NoError(t, err)
+		versions := make([]uint64, 0, len(migrations))
+		for _, migration := range migrations {
+			versions = append(versions, migration.Version)
+		}
+		assert.Equal(t, []uint64{2, 1}, versions)
+	})
+}
+
+func TestMigrateCore_StartMigrate_FormatMixed(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	goMigration := func(version int, name string) string {
+		return fmt.Sprintf("package main\n\nfunc Up%[1]d%[2]s() error { return nil }\n\n"+
+			"func Down%[1]d%[2]s() error { return nil }\n", version, name)
+	}
+	files := map[string]string{
+		"1_schema.sql":     "-- +migrate Up\nSELECT 1;\n-- +migrate Down\nSELECT -1;\n",
+		"2_backfill.go":    goMigration(2, "backfill"),
+		"3_index.up.sql":   "SELECT 3;",
+		"3_index.down.sql": "SELECT -3;",
+		"4_copy.go":        goMigration(4, "copy"),
+		"5_cleanup.go":     goMigration(5, "cleanup"),
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o600))
+	}
+	cfg := createConfig(t, tmpDir)
+	cfg.Format = config.FormatMixed
+
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+		Return(map[uint64]domain.Migration{}, nil)
+	mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+
+	// порядок выполнения: sql-миграции по версиям, go-миграции - по файлам программы миграций
+	var runs []string
+	mockTx := test.MockTx{}
+	mockTx.On("Exec", mock.Anything, mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil)
+	mockTx.On("Commit", mock.Anything).Return(nil)
+	mockStorage.On("SplitOptions").Return(splitter.Options{})
+	mockStorage.On("BeginTxMigration", mock.Anything, mock.Anything, migrate.MigrationUp).
+		Run(func(args mock.Arguments) {
+			runs = append(runs, fmt.Sprintf("sql %d", args[1].(domain.Migration).Version))
+		}).Return(storage.NewPgxTx(&mockTx), nil)
+	mockStorage.On("RecordExecution", mock.Anything, mock.Anything).Return(nil)
+
+	cfg.GoCacheDir = t.TempDir()
+	mockCommand := command.MockCommand{}
+	mockCommand.On("Output", mock.Anything, "go", mock.Anything, mock.Anything, mock.Anything).
+		Return([]byte("go1.22.3\nlinux\namd64\n"), nil)
+	mockCommand.On("Run", mock.Anything, "go", command.Args{"mod", "tidy"}, mock.Anything, mock.Anything).
+		Return(nil)
+	var built []string
+	mockCommand.On("Run", mock.Anything, "go", mock.MatchedBy(func(args command.Args) bool {
+		return len(args) > 0 && args[0] == "build"
+	}), mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			names, err := filepath.Glob(filepath.Join(args[3].(string), "*_*.go"))
+			assert.NoError(t, err)
+			for idx := range names {
+				names[idx] = filepath.Base(names[idx])
+			}
+			built = append(built, strings.Join(names, " "))
+		}).Return(nil)
+	mockCommand.On("RunWithGracefulShutdown", mock.Anything, mock.Anything, command.Args{}, mock.Anything, mock.Anything).
+		Run(func(mock.Arguments) {
+			runs = append(runs, "go "+built[len(built)-1])
+		}).Return(nil)
+	migrateCore := core.NewMigrateCore(&mockStorage, &mockCommand, zLogger, cfg)
+
+	rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.NoError(t, err)
+	formats := make([]string, 0, len(rawMigrations))
+	for _, rawMigration := range rawMigrations {
+		formats = append(formats, fmt.Sprintf("%d %s", rawMigration.Version, rawMigration.Format))
+	}
+	assert.Equal(t, []string{"1 sql", "2 golang", "3 sql", "4 golang", "5 golang"}, formats)
+
+	count, err := migrateCore.StartMigrate(context.Background(), rawMigrations, migrate.MigrationUp)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count)
+	assert.Equal(t, []string{"sql 1", "go 2_backfill.go", "sql 3", "go 4_copy.go 5_cleanup.go"}, runs)
+
+	// версия уникальна среди миграций обоих форматов
+	assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, "4_copy.up.sql"), []byte("SELECT 4;"), 0o600))
+	_, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.ErrorContains(t, err, loader.ErrMigrationVersionUnique.Error())
+}
+
+func TestMigrateCore_RegisteredMigrations(t *testing.T) {
+	zLogger := zaptest.NewLogger(t)
+
+	tmpDir := createTempDir(t)
+	defer os.RemoveAll(tmpDir)
+
+	files := map[string]string{
+		"1_schema.sql": "-- +migrate Up\nSELECT 1;\n-- +migrate Down\nSELECT -1;\n",
+		"3_index.sql":  "-- +migrate Up\nSELECT 3;\n-- +migrate Down\nSELECT -3;\n",
+	}
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(tmpDir, name), []byte(content), 0o600))
+	}
+	cfg := createConfig(t, tmpDir)
+
+	var runs []string
+	migrationFunc := func(run string) core.MigrationFunc {
+		return func(ctx context.Context, tx storage.Tx) error {
+			runs = append(runs, run)
+			return tx.Commit(ctx)
+		}
+	}
+	registered := []core.RegisteredMigration{
+		{Version: 2, Name: "Backfill data", Up: migrationFunc("up 2"), Down: migrationFunc("down 2")},
+		{Version: 4, Name: "seed", Up: migrationFunc("up 4")},
+	}
+
+	mockTx := test.MockTx{}
+	mockTx.On("Exec", mock.Anything, mock.Anything, mock.Anything).Return(pgconn.CommandTag{}, nil)
+	mockTx.On("Commit", mock.Anything).Return(nil)
+	mockStorage := storage.MockMigrateStorage{}
+	mockStorage.On("GetMigrationsByDirection", mock.Anything, migrate.MigrationUp).
+		Return(map[uint64]domain.Migration{}, nil)
+	mockStorage.On("RecentMigration", mock.Anything).Return(domain.Migration{}, storage.ErrNoAppliedMigrations)
+	mockStorage.On("SplitOptions").Return(splitter.Options{})
+	mockStorage.On("BeginTxMigration", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			runs = append(runs, fmt.Sprintf("begin %d", args[1].(domain.Migration).Version))
+		}).Return(storage.NewPgxTx(&mockTx), nil)
+	mockStorage.On("RecordExecution", mock.Anything, mock.MatchedBy(func(execution domain.Execution) bool {
+		return execution.Outcome == domain.OutcomeSuccess
+	})).Return(nil)
+	mockStorage.On("Stats", mock.Anything).Return([]domain.Migration{
+		{Version: 4, Name: "seed", IsApplied: true, Status: domain.StatusApplied},
+		{Version: 3, Name: "index", IsApplied: true, Status: domain.StatusApplied},
+		{Version: 2, Name: "backfillData", IsApplied: true, Status: domain.StatusApplied},
+		{Version: 1, Name: "schema", IsApplied: true, Status: domain.StatusApplied},
+	}, nil)
+	// программа миграций не собирается: вызов MockCommand без ожиданий завершил бы тест
+	migrateCore := core.NewMigrateCore(&mockStorage, &command.MockCommand{}, zLogger, cfg)
+	migrateCore.SetRegistered(registered)
+
+	rawMigrations, err := migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.NoError(t, err)
+	formats := make([]string, 0, len(rawMigrations))
+	for _, rawMigration := range rawMigrations {
+		formats = append(formats, fmt.Sprintf("%d %s %s", rawMigration.Version, rawMigration.Name, rawMigration.Format))
+	}
+	assert.Equal(t, []string{
+		"1 schema sql",
+		"2 backfillData registered",
+		"3 index sql",
+		"4 seed registered",
+	}, formats)
+
+	// зарегистрированные миграции выполняются в процессе вместе с sql-миграциями в порядке версий
+	count, err := migrateCore.StartMigrate(context.Background(), rawMigrations, migrate.MigrationUp)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, []string{"begin 1", "begin 2", "up 2", "begin 3", "begin 4", "up 4"}, runs)
+
+	// без функции отката откат только отмечается в таблице миграций
+	runs = nil
+	reversed := []loader.RawMigration{rawMigrations[3], rawMigrations[2], rawMigrations[1], rawMigrations[0]}
+	count, err = migrateCore.StartMigrate(context.Background(), reversed, migrate.MigrationDown)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, count)
+	assert.Equal(t, []string{"begin 4", "begin 3", "begin 2", "down 2", "begin 1"}, runs)
+
+	// зарегистрированные миграции не считаются миграциями без файлов
+	migrations, err := migrateCore.GetMigrations(context.Background())
+	assert.NoError(t, err)
+	for _, migration := range migrations {
+		assert.False(t, migration.Missing, migration.Name)
+	}
+
+	// версия уникальна среди файлов и зарегистрированных миграций
+	migrateCore.SetRegistered(append(registered, core.RegisteredMigration{Version: 3, Name: "index"}))
+	_, err = migrateCore.LoadMigrations(context.Background(), 0, migrate.MigrationUp)
+	assert.ErrorContains(t, err, loader.ErrMigrationVersionUnique.Error())
+	assert.ErrorContains(t, err, "registered migration 3 (index)")
+}
@@ -0,0 +1,366 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/BashMS/SQL_migrator/pkg/config" //nolint:depguard
+)
+
+const (
+	// migratorModulePath - путь модуля мигратора, от которого зависит программа go-миграций.
+	migratorModulePath = "github.com/BashMS/SQL_migrator"
+	// programModulePath - путь модуля программы go-миграций.
+	programModulePath = "go/migration"
+	// programCacheName - каталог кэша программ go-миграций в пользовательском кэше ОС.
+	programCacheName = "sql_migrator"
+	// programCacheSize - количество собранных программ go-миграций, которые хранятся в кэше.
+	programCacheSize = 10
+	// programTmpTTL - время, после которого недособранная программа (например, после падения сборки) удаляется из кэша.
+	programTmpTTL = 24 * time.Hour
+)
+
+// programModule - модуль мигратора, с которым собирается программа go-миграций.
+type programModule struct {
+	// dir - каталог модуля мигратора или, если vendor, каталог проекта с копией мигратора в vendor.
+	dir string
+	// vendor - программа собирается с каталогом vendor проекта (-mod=vendor).
+	vendor bool
+}
+
+// migratorModule - возвращает модуль мигратора, с которым программа go-миграций собирается
+// без доступа к сети: GoModule из конфигурации или каталог, найденный по ближайшему go.mod вверх
+// от каталогов миграций и рабочего каталога. Пустой каталог - модуль не найден.
+func (mc *MigrateCore) migratorModule() programModule {
+	if mc.config.GoModule != "" {
+		return programModule{dir: mc.config.GoModule, vendor: hasVendoredMigrator(mc.config.GoModule)}
+	}
+
+	dirs := mc.config.MigrationPaths()
+	if wd, err := os.Getwd(); err == nil {
+		dirs = append(dirs, wd)
+	}
+	for _, dir := range dirs {
+		if module := findMigratorModule(dir); module.dir != "" {
+			return module
+		}
+	}
+
+	return programModule{}
+}
+
+// programCacheDir - возвращает каталог кэша собранных программ go-миграций.
+func (mc *MigrateCore) programCacheDir() string {
+	if mc.config.GoCacheDir != "" {
+		return mc.config.GoCacheDir
+	}
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, programCacheName)
+	}
+
+	return filepath.Join(os.TempDir(), programCacheName)
+}
+
+// findMigratorModule - ищет ближайший к dir файл go.mod и возвращает модуль мигратора:
+// каталог самого go.mod, если это модуль мигратора, а если проект зависит от мигратора - каталог проекта
+// с копией мигратора в vendor (как и go, vendor используется, если он есть), каталог из replace
+// или копию мигратора в кэше модулей.
+func findMigratorModule(dir string) programModule {
+	for {
+		content, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			goMod := parseGoMod(content)
+			switch {
+			case goMod.module == migratorModulePath:
+				return programModule{dir: dir}
+			case goMod.requires[migratorModulePath] != "" && hasVendoredMigrator(dir):
+				return programModule{dir: dir, vendor: true}
+			case goMod.replaces[migratorModulePath] != "":
+				replace := goMod.replaces[migratorModulePath]
+				if !filepath.IsAbs(replace) {
+					replace = filepath.Join(dir, replace)
+				}
+				return programModule{dir: existingDir(replace)}
+			case goMod.requires[migratorModulePath] != "":
+				return programModule{dir: existingDir(moduleCacheDir(migratorModulePath, goMod.requires[migratorModulePath]))}
+			}
+
+			return programModule{}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return programModule{}
+		}
+		dir = parent
+	}
+}
+
+// hasVendoredMigrator - проверяет, что vendor/modules.txt проекта в каталоге dir содержит модуль мигратора.
+func hasVendoredMigrator(dir string) bool {
+	content, err := os.ReadFile(filepath.Join(dir, "vendor", "modules.txt"))
+	if err != nil {
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "#" && fields[1] == migratorModulePath {
+			return true
+		}
+	}
+
+	return false
+}
+
+// programGoMod - возвращает go.mod программы go-миграций, собираемой с каталогом vendor проекта:
+// go.mod проекта с другим именем модуля, чтобы требования совпадали с vendor/modules.txt.
+func programGoMod(content []byte, module string) string {
+	lines := strings.SplitAfter(string(content), "\n")
+	for idx, line := range lines {
+		if fields := goModFields(line); len(fields) != 0 && fields[0] == "module" {
+			lines[idx] = "module " + module + "\n"
+			break
+		}
+	}
+
+	return strings.Join(lines, "")
+}
+
+// goModFile - сведения из go.mod, нужные для поиска модуля мигратора.
+type goModFile struct {
+	module string
+	// requires - версии зависимостей по путям модулей.
+	requires map[string]string
+	// replaces - локальные каталоги замен по путям модулей.
+	replaces map[string]string
+}
+
+// parseGoMod - разбирает директивы module, require и replace файла go.mod (в том числе в блоках).
+func parseGoMod(content []byte) goModFile {
+	goMod := goModFile{requires: make(map[string]string), replaces: make(map[string]string)}
+
+	var block string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		fields := goModFields(scanner.Text())
+		switch {
+		case len(fields) == 0:
+		case block != "" && fields[0] == ")":
+			block = ""
+		case block != "":
+			goMod.apply(block, fields)
+		case len(fields) == 2 && fields[1] == "(":
+			block = fields[0]
+		default:
+			goMod.apply(fields[0], fields[1:])
+		}
+	}
+
+	return goMod
+}
+
+// apply - учитывает директиву go.mod с аргументами fields.
+func (g *goModFile) apply(directive string, fields []string) {
+	switch directive {
+	case "module":
+		if len(fields) != 0 {
+			g.module = fields[0]
+		}
+	case "require":
+		if len(fields) >= 2 {
+			g.requires[fields[0]] = fields[1]
+		}
+	case "replace":
+		// замена без версии - локальный каталог
+		for idx, field := range fields {
+			if field == "=>" && idx+2 == len(fields) {
+				g.replaces[fields[0]] = fields[idx+1]
+			}
+		}
+	}
+}
+
+// goModFields - возвращает аргументы строки go.mod без комментария и кавычек.
+func goModFields(line string) []string {
+	if idx := strings.Index(line, "//"); idx >= 0 {
+		line = line[:idx]
+	}
+	fields := strings.Fields(line)
+	for idx := range fields {
+		if unquoted, err := strconv.Unquote(fields[idx]); err == nil {
+			fields[idx] = unquoted
+		}
+	}
+
+	return fields
+}
+
+// moduleCacheDir - возвращает каталог версии модуля в кэше модулей Go.
+func moduleCacheDir(path, version string) string {
+	cache := os.Getenv("GOMODCACHE")
+	if cache == "" {
+		gopath := filepath.SplitList(os.Getenv("GOPATH"))
+		if len(gopath) == 0 || gopath[0] == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return ""
+			}
+			gopath = []string{filepath.Join(home, "go")}
+		}
+		cache = filepath.Join(gopath[0], "pkg", "mod")
+	}
+
+	return filepath.Join(cache, filepath.FromSlash(escapeModulePath(path))+"@"+escapeModulePath(version))
+}
+
+// escapeModulePath - экранирует путь модуля для кэша модулей: заглавная буква заменяется на `!` и строчную.
+func escapeModulePath(path string) string {
+	var builder strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			builder.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		builder.WriteRune(r)
+	}
+
+	return builder.String()
+}
+
+// existingDir - возвращает dir, если такой каталог существует, иначе пустую строку.
+func existingDir(dir string) string {
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		return dir
+	}
+
+	return ""
+}
+
+// programKey - возвращает ключ кэша программы go-миграций: хеш версии мигратора, сведений о toolchain
+// (версия Go, GOOS и GOARCH), содержимого файлов программы (миграций, main.go, go.mod и go.sum)
+// в каталоге dir и исходного кода модуля мигратора, с которым она собирается.
+func programKey(dir string, module programModule, toolchain []byte) (string, error) {
+	hash := sha256.New()
+	hash.Write([]byte(config.AppVersion))
+	hash.Write([]byte{0})
+	hash.Write(toolchain)
+	if err := hashFiles(hash, dir, false); err != nil {
+		return "", err
+	}
+
+	// копия мигратора в vendor определяется vendor/modules.txt и исходным кодом в vendor
+	moduleDir := module.dir
+	if module.vendor {
+		if err := hashFile(hash, filepath.Join(module.dir, "vendor", "modules.txt")); err != nil {
+			return "", err
+		}
+		moduleDir = filepath.Join(module.dir, "vendor", filepath.FromSlash(migratorModulePath))
+	}
+	if err := hashFiles(hash, moduleDir, true); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// hashFiles - добавляет в digest имена и содержимое файлов каталога dir (с подкаталогами, если recursive):
+// go-файлов, go.mod и go.sum. Каталоги vendor, testdata и скрытые каталоги пропускаются.
+func hashFiles(digest io.Writer, dir string, recursive bool) error {
+	// filepath.WalkDir обходит файлы в лексическом порядке
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		name := entry.Name()
+		if entry.IsDir() {
+			if path != dir && (!recursive || name == "vendor" || name == "testdata" ||
+				strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !entry.Type().IsRegular() || (filepath.Ext(name) != ".go" && name != "go.mod" && name != "go.sum") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		digest.Write([]byte{0})
+		digest.Write([]byte(filepath.ToSlash(rel)))
+		return hashFile(digest, path)
+	})
+}
+
+// hashFile - добавляет в digest содержимое файла path.
+func hashFile(digest io.Writer, path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	digest.Write([]byte{0})
+	digest.Write(content)
+
+	return nil
+}
+
+// pruneProgramCache - удаляет из кэша cacheDir программы go-миграций, кроме size последних использованных,
+// и недособранные программы старше programTmpTTL.
+func pruneProgramCache(cacheDir string, size int) error {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return err
+	}
+
+	type cachedProgram struct {
+		path    string
+		modTime time.Time
+	}
+	var programs []cachedProgram
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, "migration_") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			// файл удален параллельным запуском
+			continue
+		}
+		path := filepath.Join(cacheDir, name)
+		if strings.HasSuffix(name, ".tmp") {
+			if time.Since(info.ModTime()) > programTmpTTL {
+				_ = os.Remove(path)
+			}
+			continue
+		}
+		programs = append(programs, cachedProgram{path: path, modTime: info.ModTime()})
+	}
+	if len(programs) <= size {
+		return nil
+	}
+
+	sort.Slice(programs, func(i, j int) bool {
+		return programs[i].modTime.After(programs[j].modTime)
+	})
+	for _, program := range programs[size:] {
+		if err := os.Remove(program.path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
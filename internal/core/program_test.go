@@ -0,0 +1,237 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"  //nolint:depguard
+	"github.com/stretchr/testify/mock"    //nolint:depguard
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap/zaptest"             //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/command" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/config"       //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"       //nolint:depguard
+)
+
+// writeFiles - создает в каталоге dir файлы с содержимым по относительным путям.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	}
+}
+
+func TestFindMigratorModule(t *testing.T) {
+	modCache := t.TempDir()
+	t.Setenv("GOMODCACHE", modCache)
+	writeFiles(t, modCache, map[string]string{
+		"github.com/!bash!m!s/!s!q!l_migrator@v1.2.0/go.mod": "module github.com/BashMS/SQL_migrator\n",
+	})
+
+	tCases := []struct {
+		name     string
+		files    map[string]string
+		expected func(root string) programModule
+	}{
+		{
+			name:  "migrator module",
+			files: map[string]string{"go.mod": "module github.com/BashMS/SQL_migrator\n"},
+			expected: func(root string) programModule {
+				return programModule{dir: root}
+			},
+		},
+		{
+			name: "relative replace",
+			files: map[string]string{
+				"go.mod": "module example.com/app\n\nrequire github.com/BashMS/SQL_migrator v1.2.0\n\n" +
+					"replace github.com/BashMS/SQL_migrator => ../migrator // local copy\n",
+				"../migrator/go.mod": "module github.com/BashMS/SQL_migrator\n",
+			},
+			expected: func(root string) programModule {
+				return programModule{dir: filepath.Join(filepath.Dir(root), "migrator")}
+			},
+		},
+		{
+			name: "module cache",
+			files: map[string]string{
+				"go.mod": "module example.com/app\n\nrequire (\n\tgithub.com/BashMS/SQL_migrator v1.2.0\n)\n",
+			},
+			expected: func(string) programModule {
+				return programModule{dir: filepath.Join(modCache, "github.com", "!bash!m!s", "!s!q!l_migrator@v1.2.0")}
+			},
+		},
+		{
+			name: "vendor",
+			files: map[string]string{
+				"go.mod":             "module example.com/app\n\nrequire github.com/BashMS/SQL_migrator v1.2.0\n",
+				"vendor/modules.txt": "# github.com/BashMS/SQL_migrator v1.2.0\n## explicit; go 1.22\n",
+			},
+			expected: func(root string) programModule {
+				return programModule{dir: root, vendor: true}
+			},
+		},
+		{
+			name: "vendor without the migrator",
+			files: map[string]string{
+				"go.mod":             "module example.com/app\n\nrequire github.com/BashMS/SQL_migrator v1.2.0\n",
+				"vendor/modules.txt": "# github.com/jackc/pgx/v4 v4.18.3\n## explicit; go 1.17\n",
+			},
+			expected: func(string) programModule {
+				return programModule{dir: filepath.Join(modCache, "github.com", "!bash!m!s", "!s!q!l_migrator@v1.2.0")}
+			},
+		},
+		{
+			name: "version missing in the module cache",
+			files: map[string]string{
+				"go.mod": "module example.com/app\n\nrequire github.com/BashMS/SQL_migrator v1.3.0\n",
+			},
+			expected: func(string) programModule {
+				return programModule{}
+			},
+		},
+		{
+			name:  "project without the migrator",
+			files: map[string]string{"go.mod": "module example.com/app\n"},
+			expected: func(string) programModule {
+				return programModule{}
+			},
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			root := filepath.Join(t.TempDir(), "app")
+			writeFiles(t, root, tCase.files)
+			migrations := filepath.Join(root, "db", "migrations")
+			require.NoError(t, os.MkdirAll(migrations, 0o755))
+
+			assert.Equal(t, tCase.expected(root), findMigratorModule(migrations))
+		})
+	}
+}
+
+func TestProgramGoMod(t *testing.T) {
+	goMod := "// app\nmodule example.com/app // main\n\ngo 1.22\n\nrequire github.com/BashMS/SQL_migrator v1.2.0\n"
+	assert.Equal(t,
+		"// app\nmodule go/migration\n\ngo 1.22\n\nrequire github.com/BashMS/SQL_migrator v1.2.0\n",
+		programGoMod([]byte(goMod), programModulePath))
+}
+
+func TestProgramKey(t *testing.T) {
+	tCases := []struct {
+		name      string
+		vendor    bool
+		change    map[string]string
+		toolchain string
+		expected  bool
+	}{
+		{name: "same sources", expected: true},
+		{name: "migration changed", change: map[string]string{"program/1_init.go": "package main\n\n// changed\n"}},
+		{name: "toolchain changed", toolchain: "go1.23.0\nlinux\namd64\n"},
+		{name: "target platform changed", toolchain: "go1.22.3\ndarwin\narm64\n"},
+		{name: "module source changed", change: map[string]string{"migrator/pkg/migrate/migrate.go": "package migrate\n\n"}},
+		{name: "module dependencies changed", change: map[string]string{"migrator/go.sum": "example.com/dep v1.0.1 h1:\n"}},
+		{name: "new module package", change: map[string]string{"migrator/pkg/util/util.go": "package util\n"}},
+		{name: "module test data changed", change: map[string]string{"migrator/testdata/1_init.go": "package main\n"},
+			expected: true},
+		{name: "module readme changed", change: map[string]string{"migrator/README.md": "changed"}, expected: true},
+		{name: "vendored module changed", vendor: true,
+			change: map[string]string{"project/vendor/github.com/BashMS/SQL_migrator/pkg/migrate/migrate.go": "package x\n"}},
+		{name: "vendored dependencies changed", vendor: true,
+			change: map[string]string{"project/vendor/modules.txt": "# github.com/BashMS/SQL_migrator v1.2.1\n"}},
+		{name: "other vendored module", vendor: true,
+			change: map[string]string{"project/vendor/example.com/dep/dep.go": "package dep\n"}, expected: true},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			root := t.TempDir()
+			writeFiles(t, root, map[string]string{
+				"program/1_init.go":                "package main\n",
+				"program/go.mod":                   "module go/migration\n",
+				"migrator/go.mod":                  "module github.com/BashMS/SQL_migrator\n",
+				"migrator/go.sum":                  "example.com/dep v1.0.0 h1:\n",
+				"migrator/pkg/migrate/migrate.go":  "package migrate\n",
+				"migrator/testdata/1_init.go":      "package main\n",
+				"migrator/README.md":               "readme",
+				"project/vendor/modules.txt":       "# github.com/BashMS/SQL_migrator v1.2.0\n",
+				"project/vendor/example.com/dep/x": "package dep\n",
+				"project/vendor/github.com/BashMS/SQL_migrator/pkg/migrate/migrate.go": "package migrate\n",
+			})
+			module := programModule{dir: filepath.Join(root, "migrator")}
+			if tCase.vendor {
+				module = programModule{dir: filepath.Join(root, "project"), vendor: true}
+			}
+			toolchain := "go1.22.3\nlinux\namd64\n"
+
+			key, err := programKey(filepath.Join(root, "program"), module, []byte(toolchain))
+			require.NoError(t, err)
+
+			writeFiles(t, root, tCase.change)
+			if tCase.toolchain != "" {
+				toolchain = tCase.toolchain
+			}
+			changedKey, err := programKey(filepath.Join(root, "program"), module, []byte(toolchain))
+			require.NoError(t, err)
+			assert.Equal(t, tCase.expected, key == changedKey)
+		})
+	}
+}
+
+func TestPruneProgramCache(t *testing.T) {
+	cacheDir := t.TempDir()
+	now := time.Now()
+	files := []struct {
+		name    string
+		age     time.Duration
+		removed bool
+	}{
+		{name: "migration_a", age: time.Minute},
+		{name: "migration_b", age: 3 * time.Hour, removed: true},
+		{name: "migration_c", age: time.Hour},
+		{name: "migration_d", age: 2 * time.Hour, removed: true},
+		{name: "migration_1.tmp", age: time.Minute},
+		{name: "migration_2.tmp", age: 2 * programTmpTTL, removed: true},
+		{name: "other", age: 2 * programTmpTTL},
+	}
+	for _, file := range files {
+		path := filepath.Join(cacheDir, file.name)
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		require.NoError(t, os.Chtimes(path, now.Add(-file.age), now.Add(-file.age)))
+	}
+
+	require.NoError(t, pruneProgramCache(cacheDir, 2))
+	for _, file := range files {
+		if file.removed {
+			assert.NoFileExists(t, filepath.Join(cacheDir, file.name))
+		} else {
+			assert.FileExists(t, filepath.Join(cacheDir, file.name))
+		}
+	}
+}
+
+func TestMigrateCore_BuildGoProgram_ModuleNotFound(t *testing.T) {
+	// рабочий каталог и каталог миграций вне модуля мигратора и проектов, зависящих от него
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	defer func() {
+		require.NoError(t, os.Chdir(wd))
+	}()
+
+	cfg := &config.Config{Path: t.TempDir(), Format: config.FormatGolang, GoCacheDir: t.TempDir()}
+	mockCommand := command.MockCommand{}
+	migrateCore := NewMigrateCore(nil, &mockCommand, zaptest.NewLogger(t), cfg)
+
+	// без модуля мигратора программа не собирается, зависимости из сети не загружаются
+	_, err = migrateCore.buildGoProgram(context.Background(), nil, true)
+	assert.ErrorIs(t, err, domain.ErrBuildProgramForMigrations)
+	assert.ErrorContains(t, err, "migrator.go.module")
+	mockCommand.AssertNotCalled(t, "Run", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iancoleman/strcase" //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/converter" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/loader"    //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/storage"   //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"         //nolint:depguard
+)
+
+type (
+	// MigrationFunc - функция миграции, зарегистрированной в приложении, выполняемая в транзакции миграции tx.
+	MigrationFunc func(ctx context.Context, tx storage.Tx) error
+
+	// RegisteredMigration - миграция на Go, скомпилированная в приложение и выполняемая в процессе мигратора.
+	RegisteredMigration struct {
+		Version uint64
+		Name    string
+		Up      MigrationFunc
+		// Down - функция отката; если она не задана, откат только отмечается в таблице миграций.
+		Down MigrationFunc
+	}
+)
+
+// SetRegistered - устанавливает миграции, зарегистрированные в приложении. Они загружаются вместе
+// с файлами миграций (версия уникальна среди всех миграций) и выполняются без сборки программы миграций.
+func (mc *MigrateCore) SetRegistered(migrations []RegisteredMigration) {
+	mc.registered = make(map[uint64]RegisteredMigration, len(migrations))
+	rawMigrations := make([]loader.RawMigration, 0, len(migrations))
+	for _, migration := range migrations {
+		migration.Name = converter.SanitizeMigrationName(strcase.ToLowerCamel(migration.Name))
+		mc.registered[migration.Version] = migration
+		rawMigrations = append(rawMigrations, loader.RawMigration{
+			Version: migration.Version,
+			Name:    migration.Name,
+			Format:  loader.FormatRegistered,
+		})
+	}
+	mc.loader.SetRegistered(rawMigrations)
+}
+
+// runRegisteredMigration - выполняет зарегистрированные в приложении миграции в процессе мигратора.
+func (mc *MigrateCore) runRegisteredMigration(
+	ctx context.Context,
+	rawMigrations []loader.RawMigration,
+	direction bool,
+) (int, error) {
+	var count int
+	for _, rawMigration := range rawMigrations {
+		registered, ok := mc.registered[rawMigration.Version]
+		if !ok {
+			return count, fmt.Errorf("%w: %d (%s)", domain.ErrMigrationNotRegistered, rawMigration.Version, rawMigration.Name)
+		}
+		migrateFunc := registered.Down
+		if direction {
+			migrateFunc = registered.Up
+		}
+
+		migration := domain.Migration{
+			Version:  rawMigration.Version,
+			Name:     rawMigration.Name,
+			Checksum: rawMigration.Checksum,
+			Tags:     rawMigration.Tags,
+		}
+		applied, err := mc.RunMigrationFunc(ctx, migration, direction, false, func(tx storage.Tx) error {
+			if migrateFunc == nil {
+				return tx.Commit(ctx)
+			}
+
+			return migrateFunc(ctx, tx)
+		})
+		if err != nil {
+			return count, err
+		}
+		if applied {
+			count++
+		}
+	}
+
+	return count, nil
+}
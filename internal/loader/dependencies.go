@@ -0,0 +1,246 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BashMS/SQL_migrator/internal/converter" //nolint:depguard
+)
+
+// DirectiveRequires - версии миграций, которые должны быть применены раньше
+// (заголовок sql-файла `-- +migrate Requires 1700000123 1700000124`).
+const DirectiveRequires = "Requires"
+
+// GoRequiresPrefix - префикс переменной go-файла со списком версий миграций, которые должны быть применены раньше
+// (`var Requires<версия><имя> = []uint64{1700000123}`).
+const GoRequiresPrefix = "Requires"
+
+var (
+	// ErrInvalidRequires - неверный список зависимостей миграции.
+	ErrInvalidRequires = errors.New("invalid migration dependencies")
+	// ErrDependencyNotFound - миграция зависит от миграции, файла которой нет.
+	ErrDependencyNotFound = errors.New("required migration not found")
+	// ErrDependencyCycle - зависимости миграций образуют цикл.
+	ErrDependencyCycle = errors.New("migration dependencies form a cycle")
+)
+
+// sqlRequires - возвращает версии из заголовка sql-файла.
+func sqlRequires(content string) ([]uint64, error) {
+	var requires []uint64
+	for _, field := range headerValues(content, DirectiveRequires) {
+		version, err := converter.VersionToUint(field)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidRequires, field)
+		}
+		requires = append(requires, version)
+	}
+
+	return mergeRequires(requires), nil
+}
+
+// goRequires - возвращает версии из переменной go-файла name (Requires<версия><имя>).
+func goRequires(path string, content []byte, name string) ([]uint64, error) {
+	value, err := goVarValue(path, content, GoRequiresPrefix, name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidRequires, err.Error())
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	requires, err := literalVersions(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrInvalidRequires, name, err.Error())
+	}
+
+	return mergeRequires(requires), nil
+}
+
+// literalVersions - возвращает версии из литерала вида []uint64{1700000123, 1700000124}.
+func literalVersions(expr ast.Expr) ([]uint64, error) {
+	literal, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil, errors.New("must be a []uint64 literal")
+	}
+
+	versions := make([]uint64, 0, len(literal.Elts))
+	for _, elt := range literal.Elts {
+		basic, ok := elt.(*ast.BasicLit)
+		if !ok || basic.Kind != token.INT {
+			return nil, errors.New("must contain only integer versions")
+		}
+		version, err := strconv.ParseUint(strings.ReplaceAll(basic.Value, "_", ""), 0, 64)
+		if err != nil || version == 0 {
+			return nil, fmt.Errorf("has invalid version %s", basic.Value)
+		}
+		versions = append(versions, version)
+	}
+
+	return versions, nil
+}
+
+// mergeRequires - объединяет списки версий без повторов (в порядке возрастания).
+func mergeRequires(requires ...[]uint64) []uint64 {
+	seen := make(map[uint64]bool)
+	var result []uint64
+	for _, list := range requires {
+		for _, version := range list {
+			if !seen[version] {
+				seen[version] = true
+				result = append(result, version)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i] < result[j]
+	})
+
+	return result
+}
+
+// CheckDependencies - проверяет граф зависимостей миграций: все требуемые версии есть среди migrations,
+// и зависимости не образуют циклов.
+func CheckDependencies(migrations []RawMigration) []error {
+	var (
+		problems  []error
+		byVersion = make(map[uint64]RawMigration, len(migrations))
+	)
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+	for _, migration := range migrations {
+		for _, version := range migration.Requires {
+			if _, ok := byVersion[version]; !ok {
+				problems = append(problems, fmt.Errorf("%w: %d (%s) requires %d, declared in %s",
+					ErrDependencyNotFound, migration.Version, migration.Name, version, migration.PathUp))
+			}
+		}
+	}
+	if cycle := findCycle(migrations); cycle != nil {
+		problems = append(problems, cycleError(cycle))
+	}
+
+	return problems
+}
+
+// SortByDependencies - упорядочивает миграции топологически: миграция следует за теми, от которых зависит,
+// а среди независимых друг от друга миграций раньше идет меньшая версия. Зависимости от версий,
+// которых нет среди migrations (например, уже примененных), считаются выполненными.
+func SortByDependencies(migrations []RawMigration) ([]RawMigration, error) {
+	index := make(map[uint64]int, len(migrations))
+	for idx, migration := range migrations {
+		index[migration.Version] = idx
+	}
+
+	var (
+		degree     = make([]int, len(migrations))
+		dependents = make([][]int, len(migrations))
+		ready      []int
+		sorted     = make([]RawMigration, 0, len(migrations))
+	)
+	for idx, migration := range migrations {
+		for _, version := range migration.Requires {
+			if parent, ok := index[version]; ok {
+				degree[idx]++
+				dependents[parent] = append(dependents[parent], idx)
+			}
+		}
+	}
+	less := func(i, j int) bool {
+		return migrations[ready[i]].Version < migrations[ready[j]].Version
+	}
+	for idx := range migrations {
+		if degree[idx] == 0 {
+			ready = append(ready, idx)
+		}
+	}
+	for len(ready) != 0 {
+		sort.Slice(ready, less)
+		current := ready[0]
+		ready = ready[1:]
+		sorted = append(sorted, migrations[current])
+		for _, dependent := range dependents[current] {
+			if degree[dependent]--; degree[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if len(sorted) != len(migrations) {
+		return nil, cycleError(findCycle(migrations))
+	}
+
+	return sorted, nil
+}
+
+// findCycle - возвращает миграции, образующие цикл зависимостей (первая повторяется в конце), или nil.
+func findCycle(migrations []RawMigration) []RawMigration {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	var (
+		byVersion = make(map[uint64]RawMigration, len(migrations))
+		state     = make(map[uint64]int, len(migrations))
+		stack     []RawMigration
+		visit     func(migration RawMigration) []RawMigration
+	)
+	for _, migration := range migrations {
+		byVersion[migration.Version] = migration
+	}
+	visit = func(migration RawMigration) []RawMigration {
+		state[migration.Version] = visiting
+		stack = append(stack, migration)
+		for _, version := range migration.Requires {
+			parent, ok := byVersion[version]
+			if !ok {
+				continue
+			}
+			switch state[version] {
+			case visiting:
+				for idx := range stack {
+					if stack[idx].Version == version {
+						return append(append([]RawMigration(nil), stack[idx:]...), parent)
+					}
+				}
+			case unvisited:
+				if cycle := visit(parent); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[migration.Version] = visited
+
+		return nil
+	}
+
+	sorted := append([]RawMigration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].Version < sorted[j].Version
+	})
+	for _, migration := range sorted {
+		if state[migration.Version] == unvisited {
+			if cycle := visit(migration); cycle != nil {
+				return cycle
+			}
+		}
+	}
+
+	return nil
+}
+
+// cycleError - возвращает ошибку с цепочкой миграций цикла.
+func cycleError(cycle []RawMigration) error {
+	chain := make([]string, 0, len(cycle))
+	for _, migration := range cycle {
+		chain = append(chain, fmt.Sprintf("%d (%s)", migration.Version, migration.Name))
+	}
+
+	return fmt.Errorf("%w: %s", ErrDependencyCycle, strings.Join(chain, " requires "))
+}
@@ -7,6 +7,13 @@ type Filter struct {
 	Exclude          map[uint64]domain.Migration
 	Recent           domain.Migration
 	RequestToVersion uint64
+	// AllowOutOfOrder - не отбрасывать при накате миграции с версией не выше последней примененной.
+	AllowOutOfOrder bool
+	// Tags - загружать из миграций с тегами только миграции хотя бы с одним из этих тегов
+	// (миграции без тегов загружаются всегда).
+	Tags []string
+	// ExcludeTags - не загружать миграции хотя бы с одним из этих тегов.
+	ExcludeTags []string
 }
 
 // IsExcluded - проверяет, была ли миграция добавлена ​​в исключенные.
@@ -19,17 +26,31 @@ func (f *Filter) IsExcluded(migration RawMigration) bool {
 	return false
 }
 
+// MatchTags - проверяет, что миграция с тегами tags проходит фильтр по тегам.
+func (f *Filter) MatchTags(tags []string) bool {
+	if hasAnyTag(tags, f.ExcludeTags) {
+		return false
+	}
+
+	return len(tags) == 0 || len(f.Tags) == 0 || hasAnyTag(tags, f.Tags)
+}
+
 // AllowUp - проверяет, разрешено ли накатывать версию миграции.
 func (f *Filter) AllowUp(migration RawMigration) bool {
 	if f.RequestToVersion != 0 && migration.Version > f.RequestToVersion {
 		return false
-	} else if f.Recent.Version != 0 && migration.Version <= f.Recent.Version {
+	} else if f.IsOutOfOrder(migration) && !f.AllowOutOfOrder {
 		return false
 	}
 
 	return true
 }
 
+// IsOutOfOrder - проверяет, что версия миграции не выше последней примененной.
+func (f *Filter) IsOutOfOrder(migration RawMigration) bool {
+	return f.Recent.Version != 0 && migration.Version <= f.Recent.Version
+}
+
 // AllowDown - проверяет, разрешен ли откат версии миграции.
 func (f *Filter) AllowDown(migration RawMigration) bool {
 	if f.RequestToVersion != 0 && migration.Version < f.RequestToVersion {
@@ -2,17 +2,19 @@ package loader
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/BashMS/SQL_migrator/internal/converter" //nolint:depguard
 	"github.com/BashMS/SQL_migrator/pkg/config"         //nolint:depguard
 	"github.com/BashMS/SQL_migrator/pkg/domain"         //nolint:depguard
-	"github.com/coreos/etcd/pkg/fileutil"               //nolint:depguard
 	"github.com/iancoleman/strcase"                     //nolint:depguard
 	"go.uber.org/zap"                                   //nolint:depguard
 )
@@ -22,112 +24,288 @@ var (
 	ErrMigrationPath = errors.New("migration path is not specified or it is incorrect")
 	// ErrPostfix - постфикс для миграции не найден (.down или .up).
 	ErrPostfix = errors.New("postfix not found for migration (.down or .up)")
+	// ErrSectionUpNotFound - в sql-файле без постфикса нет секции наката.
+	ErrSectionUpNotFound = errors.New(
+		"no '-- +migrate Up' section found in a migration file without postfix (.down or .up)")
+	// ErrUnknownDirective - неизвестная директива в sql-файле миграции.
+	ErrUnknownDirective = errors.New("unknown '-- +migrate' directive")
+	// ErrDuplicateSection - секция повторяется в sql-файле миграции.
+	ErrDuplicateSection = errors.New("duplicate '-- +migrate' section")
+	// ErrStatementOutsideSection - запрос вне секций Up и Down в sql-файле миграции.
+	ErrStatementOutsideSection = errors.New("statement outside of '-- +migrate Up' and '-- +migrate Down' sections")
 	// ErrSeparatorNotFound - не найден разделитель.
 	ErrSeparatorNotFound = errors.New("no separator found")
 	// ErrMigrationsSameName - миграции sql (down и up) должны иметь одинаковое имя.
 	ErrMigrationsSameName = errors.New("sql migrations (down and up) must have the same name")
+	// ErrMigrationDifferentDirs - файлы наката и отката миграции должны быть в одном каталоге.
+	ErrMigrationDifferentDirs = errors.New("up and down migration files must be in the same directory")
 	// ErrMigrationVersionUnique - версия миграции должна быть уникальной.
 	ErrMigrationVersionUnique = errors.New("migration version must be unique")
+	// ErrRepeatableNameUnique - имя повторяемой миграции должно быть уникальным.
+	ErrRepeatableNameUnique = errors.New("repeatable migration name must be unique")
 	// ErrReadFile - ошибка чтения файла.
 	ErrReadFile = errors.New("error reading file")
 	// ErrSkipFile - пропустить этот файл.
 	ErrSkipFile = errors.New("skip this file")
+	// ErrRenderTemplate - не удалось подставить переменные в шаблон sql-миграции.
+	ErrRenderTemplate = errors.New("failed to render migration template")
 	// ErrMigrateVersionFile - версия должна быть больше 0 в файле миграции.
 	ErrMigrateVersionFile = errors.New("version must be greater than 0 in the migration file")
 )
 
+// FormatRegistered - формат миграций, зарегистрированных в приложении (без файлов, выполняются в процессе).
+const FormatRegistered = "registered"
+
 // Loader.
 type Loader struct {
 	logger         *zap.Logger
-	allowExt       string
 	format         string
 	listMigrations []RawMigration
 	hash           map[uint64]int
+	vars           map[string]string
+	sources        []Source
+	registered     []RawMigration
 }
 
 // NewLoader конструктор.
 func NewLoader(logger *zap.Logger) Loader {
-	return Loader{logger: logger, allowExt: config.ExtSQL, format: config.FormatSQL}
+	return Loader{logger: logger, format: config.FormatSQL}
 }
 
-// SetFormat - устанавливает формат миграции.
+// SetFormat - устанавливает формат миграции. Для формата config.FormatMixed загружаются и sql-, и go-файлы.
 func (l *Loader) SetFormat(format string) {
 	l.format = format
-	switch format {
-	case config.FormatSQL:
-		l.allowExt = config.ExtSQL
-	case config.FormatGolang:
-		l.allowExt = config.ExtGolang
+}
+
+// fileFormat - возвращает формат миграции в файле с расширением ext
+// или false, если файлы с таким расширением не загружаются.
+func (l *Loader) fileFormat(ext string) (string, bool) {
+	switch {
+	case ext == config.ExtSQL && (l.format == config.FormatSQL || l.format == config.FormatMixed):
+		return config.FormatSQL, true
+	case ext == config.ExtGolang && (l.format == config.FormatGolang || l.format == config.FormatMixed):
+		return config.FormatGolang, true
+	}
+
+	return "", false
+}
+
+// SetVars - устанавливает переменные шаблонов sql-миграций.
+func (l *Loader) SetVars(vars map[string]string) {
+	l.vars = vars
+}
+
+// SetSource - устанавливает источники файлов миграций. Миграции всех источников
+// объединяются в один план, упорядоченный по версиям.
+func (l *Loader) SetSource(sources ...Source) {
+	l.sources = sources
+}
+
+// SetRegistered - устанавливает миграции, зарегистрированные в приложении (формат FormatRegistered).
+// Они загружаются вместе с миграциями источников, версия уникальна среди всех миграций.
+func (l *Loader) SetRegistered(migrations []RawMigration) {
+	l.registered = migrations
+}
+
+// ReadFile - читает файл миграции по его пути (RawMigration.PathUp или RawMigration.PathDown)
+// в источнике, к которому он относится.
+func (l *Loader) ReadFile(path string) ([]byte, error) {
+	for _, source := range l.sources {
+		if name, ok := source.contains(path); ok {
+			return fs.ReadFile(source.fsys, name)
+		}
 	}
+
+	return nil, fmt.Errorf("%w %s", ErrReadFile, path)
 }
 
 // LoadMigrations - загружает все миграции (с фильтром).
 func (l *Loader) LoadMigrations(
 	ctx context.Context,
 	filter Filter,
-	path string,
 	direction bool,
 ) ([]RawMigration, error) {
 	l.resetMigrations()
 
-	if !fileutil.Exist(path) {
-		return nil, ErrMigrationPath
+	add := func(migration RawMigration) error {
+		// повторяемые миграции загружаются отдельно (LoadRepeatableMigrations)
+		if migration.Repeatable {
+			return nil
+		}
+
+		if filter.IsExcluded(migration) ||
+			(direction && !filter.AllowUp(migration)) ||
+			(!direction && !filter.AllowDown(migration)) {
+			l.logger.Debug(fmt.Sprintf("%s not loaded", migration.location(direction)))
+			return nil
+		}
+
+		return l.addMigration(migration)
 	}
+	if err := l.walk(ctx, add); err != nil {
+		return nil, err
+	}
+	for _, migration := range l.registered {
+		if err := add(migration); err != nil {
+			return nil, err
+		}
+	}
+	// теги файлов наката и отката объединяются, поэтому фильтр по тегам применяется после загрузки
+	l.filterTags(filter)
 
-	err := filepath.Walk(path, func(filePath string, info os.FileInfo, err error) error {
-		select {
-		case <-ctx.Done():
-			return context.DeadlineExceeded
-		default:
+	if len(l.listMigrations) == 0 {
+		return l.listMigrations, nil
+	}
+
+	var err error
+	for idx := range l.listMigrations {
+		// контрольная сумма вычисляется по шаблону, чтобы не зависеть от значений переменных окружения
+		if l.listMigrations[idx].Checksum, err = l.checksum(l.listMigrations[idx]); err != nil {
+			return nil, err
 		}
+		if err = l.render(&l.listMigrations[idx]); err != nil {
+			return nil, err
+		}
+	}
 
-		if err != nil {
-			return err
+	sort.Sort(l)
+	sorted, err := SortByDependencies(l.listMigrations)
+	if err != nil {
+		return nil, err
+	}
+	if !direction {
+		// зависимые миграции откатываются раньше тех, от которых зависят
+		for i, j := 0, len(sorted)-1; i < j; i, j = i+1, j-1 {
+			sorted[i], sorted[j] = sorted[j], sorted[i]
 		}
+	}
 
-		if info.IsDir() {
+	return sorted, nil
+}
+
+// LoadRepeatableMigrations - загружает повторяемые sql-миграции (R_<имя>.sql), отсортированные по имени.
+func (l *Loader) LoadRepeatableMigrations(ctx context.Context) ([]RawMigration, error) {
+	var (
+		migrations []RawMigration
+		paths      = make(map[string]string)
+	)
+	err := l.walk(ctx, func(migration RawMigration) error {
+		if !migration.Repeatable {
 			return nil
 		}
+		if existing, ok := paths[migration.Name]; ok {
+			return fmt.Errorf("%w: %s and %s", ErrRepeatableNameUnique, existing, migration.PathUp)
+		}
+		paths[migration.Name] = migration.PathUp
+		migrations = append(migrations, migration)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for idx := range migrations {
+		if migrations[idx].Checksum, err = l.checksum(migrations[idx]); err != nil {
+			return nil, err
+		}
+		if err = l.render(&migrations[idx]); err != nil {
+			return nil, err
+		}
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Name < migrations[j].Name
+	})
 
-		migration, err := l.parseFile(filePath)
+	return migrations, nil
+}
+
+// walk - разбирает файлы миграций источника и передает их в handle.
+func (l *Loader) walk(ctx context.Context, handle func(migration RawMigration) error) error {
+	return l.walkFiles(ctx, func(source Source, name string) error {
+		migration, err := l.parseFile(source, name)
 		if errors.Is(err, ErrSkipFile) {
-			l.logger.Debug(fmt.Sprintf("skipped %s file", filePath))
+			l.logger.Debug(fmt.Sprintf("skipped %s file", source.path(name)))
 			return nil
 		} else if err != nil {
 			return err
 		}
 
-		if filter.IsExcluded(migration) ||
-			(direction && !filter.AllowUp(migration)) ||
-			(!direction && !filter.AllowDown(migration)) {
-			l.logger.Debug(fmt.Sprintf("%s file not loaded", filePath))
+		return handle(migration)
+	})
+}
+
+// walkFiles - передает в handle имена всех файлов источников (включая вложенные каталоги).
+// Файл, попавший в несколько источников (например, вложенные каталоги), передается один раз.
+func (l *Loader) walkFiles(ctx context.Context, handle func(source Source, name string) error) error {
+	if len(l.sources) == 0 {
+		// у приложения могут быть только зарегистрированные миграции без файлов
+		if len(l.registered) != 0 {
 			return nil
 		}
-
-		return l.addMigration(migration)
-	})
-	if err != nil {
-		return nil, err
+		return ErrMigrationPath
 	}
 
-	if len(l.listMigrations) == 0 {
-		return l.listMigrations, nil
+	seen := make(map[string]bool)
+	for _, source := range l.sources {
+		if err := l.walkSource(ctx, source, func(name string) error {
+			path := source.path(name)
+			if seen[path] {
+				return nil
+			}
+			seen[path] = true
+
+			return handle(source, name)
+		}); err != nil {
+			return err
+		}
 	}
 
-	if direction {
-		sort.Sort(l)
-	} else {
-		sort.Sort(sort.Reverse(l))
+	return nil
+}
+
+// walkSource - передает в handle имена всех файлов источника source.
+func (l *Loader) walkSource(ctx context.Context, source Source, handle func(name string) error) error {
+	if source.fsys == nil || !isDir(source.fsys) {
+		if source.root != "" {
+			return fmt.Errorf("%w: %s", ErrMigrationPath, source.root)
+		}
+		return ErrMigrationPath
 	}
 
-	return l.listMigrations, nil
+	return fs.WalkDir(source.fsys, ".", func(name string, entry fs.DirEntry, err error) error {
+		select {
+		case <-ctx.Done():
+			return context.DeadlineExceeded
+		default:
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		return handle(name)
+	})
+}
+
+// isDir - сообщает, что корень fsys существует и является каталогом.
+func isDir(fsys fs.FS) bool {
+	info, err := fs.Stat(fsys, ".")
+	return err == nil && info.IsDir()
 }
 
 func (l *Loader) addMigration(migration RawMigration) error {
 	idx, ok := l.hash[migration.Version]
 	if ok {
-		if l.listMigrations[idx].Format == config.FormatGolang {
-			return ErrMigrationVersionUnique
+		// версия уникальна и среди миграций разных форматов
+		existing := l.listMigrations[idx]
+		if existing.Format == config.FormatGolang || existing.Format == FormatRegistered ||
+			existing.Format != migration.Format {
+			return fmt.Errorf("%w: %s and %s", ErrMigrationVersionUnique, existing.location(true), migration.location(true))
 		}
 		if err := l.mergeMigration(idx, migration); err != nil {
 			return err
@@ -142,6 +320,23 @@ func (l *Loader) addMigration(migration RawMigration) error {
 	return nil
 }
 
+// filterTags - отбрасывает загруженные миграции, не прошедшие фильтр по тегам.
+func (l *Loader) filterTags(filter Filter) {
+	migrations := l.listMigrations[:0]
+	for _, migration := range l.listMigrations {
+		if !filter.MatchTags(migration.Tags) {
+			l.logger.Debug(fmt.Sprintf("%d (%s) migration skipped by tags", migration.Version, migration.Name))
+			continue
+		}
+		migrations = append(migrations, migration)
+	}
+	l.listMigrations = migrations
+	l.hash = make(map[uint64]int, len(migrations))
+	for idx, migration := range migrations {
+		l.hash[migration.Version] = idx
+	}
+}
+
 func (l *Loader) resetMigrations() {
 	l.listMigrations = []RawMigration{}
 	l.hash = make(map[uint64]int)
@@ -150,65 +345,172 @@ func (l *Loader) resetMigrations() {
 func (l *Loader) mergeMigration(idx int, migration RawMigration) error {
 	if l.listMigrations[idx].Format == config.FormatSQL && l.listMigrations[idx].Name != migration.Name {
 		return fmt.Errorf(
-			"%w: %s and %s are different names for version %d",
+			"%w: %s and %s are different names for version %d (%s and %s)",
 			ErrMigrationsSameName,
 			l.listMigrations[idx].Name,
 			migration.Name, migration.Version,
+			l.listMigrations[idx].GetPath(l.listMigrations[idx].PathUp != ""),
+			migration.GetPath(migration.PathUp != ""),
 		)
 	}
 
+	// одно направление описано в двух файлах (например, 1_name.sql и 1_name.up.sql)
+	existing := l.listMigrations[idx]
+	if (existing.PathUp != "" && migration.PathUp != "") || (existing.PathDown != "" && migration.PathDown != "") {
+		return fmt.Errorf("%w: %s and %s",
+			ErrMigrationVersionUnique, existing.GetPath(migration.PathUp != ""), migration.GetPath(migration.PathUp != ""))
+	}
+	// файлы одной версии из разных каталогов (например, modules/*/migrations) - разные миграции
+	existingPath, path := existing.GetPath(existing.PathUp != ""), migration.GetPath(migration.PathUp != "")
+	if filepath.Dir(existingPath) != filepath.Dir(path) {
+		return fmt.Errorf("%w: %s and %s", ErrMigrationDifferentDirs, existingPath, path)
+	}
+
 	if l.listMigrations[idx].PathDown == "" {
 		l.listMigrations[idx].PathDown = migration.PathDown
+		l.listMigrations[idx].TemplateDown = migration.TemplateDown
+	}
+
+	// директива в файле любого направления относится ко всей миграции
+	if migration.NoTransaction {
+		l.listMigrations[idx].NoTransaction = true
+	}
+	if len(migration.Requires) != 0 {
+		l.listMigrations[idx].Requires = mergeRequires(l.listMigrations[idx].Requires, migration.Requires)
+	}
+	if len(migration.Tags) != 0 {
+		tags, _ := NormalizeTags(append(append([]string(nil), l.listMigrations[idx].Tags...), migration.Tags...))
+		l.listMigrations[idx].Tags = tags
 	}
 
 	if l.listMigrations[idx].PathUp == "" {
 		l.listMigrations[idx].PathUp = migration.PathUp
+		l.listMigrations[idx].TemplateUp = migration.TemplateUp
 	}
 
 	if l.listMigrations[idx].QueryUp == "" {
 		l.listMigrations[idx].QueryUp = migration.QueryUp
+		l.listMigrations[idx].LineOffsetUp = migration.LineOffsetUp
 	}
 
 	if l.listMigrations[idx].QueryDown == "" {
 		l.listMigrations[idx].QueryDown = migration.QueryDown
+		l.listMigrations[idx].LineOffsetDown = migration.LineOffsetDown
 	}
 
 	return nil
 }
 
-func (l *Loader) parseFile(path string) (RawMigration, error) {
+// checksum - вычисляет SHA-256 содержимого миграции (оба направления).
+func (l *Loader) checksum(migration RawMigration) (string, error) {
+	// у зарегистрированной миграции нет файлов, ее изменения не отслеживаются
+	if migration.Format == FormatRegistered {
+		return "", nil
+	}
+
+	hash := sha256.New()
+	switch migration.Format {
+	case config.FormatGolang:
+		content, err := l.ReadFile(migration.PathUp)
+		if err != nil {
+			return "", fmt.Errorf("%w %s", ErrReadFile, migration.PathUp)
+		}
+		hash.Write(content)
+	case config.FormatSQL:
+		hash.Write([]byte(migration.QueryUp))
+		hash.Write([]byte{0})
+		hash.Write([]byte(migration.QueryDown))
+		// директивы файла с секциями не входят в запросы, но меняют способ их выполнения
+		if migration.NoTransaction && migration.PathUp == migration.PathDown {
+			hash.Write([]byte{0})
+			hash.Write([]byte(DirectiveNoTransaction))
+		}
+		if migration.TemplateUp && migration.PathUp == migration.PathDown {
+			hash.Write([]byte{0})
+			hash.Write([]byte(DirectiveTemplate))
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// parseFile - разбирает файл миграции с именем fileName в источнике source.
+func (l *Loader) parseFile(source Source, fileName string) (RawMigration, error) {
 	var (
 		migration    RawMigration
 		idxDirection int
+		goContent    []byte
 		err          error
 	)
+	path := source.path(fileName)
 	name := filepath.Base(path)
 
 	ext := filepath.Ext(name)
-	if ext != l.allowExt {
+	format, ok := l.fileFormat(ext)
+	if !ok {
 		return migration, ErrSkipFile
 	}
-	migration.Format = l.format
+	migration.Format = format
 
 	switch migration.Format {
 	case config.FormatGolang:
+		content, err := fs.ReadFile(source.fsys, fileName)
+		if err != nil {
+			return migration, fmt.Errorf("%w %s", ErrReadFile, path)
+		}
+
 		idxDirection = strings.LastIndex(name, ext)
 		migration.PathUp = path
 		migration.PathDown = path
+		migration.NoTransaction = hasDirective(string(content), DirectiveNoTransaction, goDirectiveRegexp)
+		goContent = content
 	case config.FormatSQL:
-		query, err := os.ReadFile(path)
+		query, err := fs.ReadFile(source.fsys, fileName)
 		if err != nil {
 			return migration, fmt.Errorf("%w %s", ErrReadFile, path)
 		}
 
+		if migration.Requires, err = sqlRequires(string(query)); err != nil {
+			return migration, fmt.Errorf("%w (%s)", err, path)
+		}
+		if migration.Tags, err = sqlTags(string(query)); err != nil {
+			return migration, fmt.Errorf("%w (%s)", err, path)
+		}
+
+		if strings.HasPrefix(name, config.RepeatablePrefix) {
+			migration.Repeatable = true
+			migration.PathUp = path
+			migration.QueryUp = string(query)
+			migration.TemplateUp = hasDirective(migration.QueryUp, DirectiveTemplate, directiveRegexp)
+			migration.Name = converter.SanitizeMigrationName(
+				strcase.ToLowerCamel(name[len(config.RepeatablePrefix):strings.LastIndex(name, ext)]))
+
+			return migration, nil
+		}
+
 		if idxDirection = strings.LastIndex(name, config.PostfixUp); idxDirection > 0 {
 			migration.PathUp = path
 			migration.QueryUp = string(query)
+			migration.NoTransaction = hasDirective(migration.QueryUp, DirectiveNoTransaction, directiveRegexp)
+			migration.TemplateUp = hasDirective(migration.QueryUp, DirectiveTemplate, directiveRegexp)
 		} else if idxDirection = strings.LastIndex(name, config.PostfixDown); idxDirection > 0 {
 			migration.PathDown = path
 			migration.QueryDown = string(query)
+			migration.NoTransaction = hasDirective(migration.QueryDown, DirectiveNoTransaction, directiveRegexp)
+			migration.TemplateDown = hasDirective(migration.QueryDown, DirectiveTemplate, directiveRegexp)
 		} else {
-			return migration, ErrPostfix
+			// один файл с секциями `-- +migrate Up` и `-- +migrate Down`
+			idxDirection = strings.LastIndex(name, ext)
+			migration.PathUp = path
+			migration.PathDown = path
+			sections, err := parseSQLSections(string(query))
+			if err != nil {
+				return migration, fmt.Errorf("%w (%s)", err, path)
+			}
+			migration.QueryUp, migration.LineOffsetUp = sections.up, sections.lineOffsetUp
+			migration.QueryDown, migration.LineOffsetDown = sections.down, sections.lineOffsetDown
+			migration.NoTransaction = sections.noTransaction
+			migration.TemplateUp, migration.TemplateDown = sections.template, sections.template
 		}
 	default:
 		return migration, fmt.Errorf("%w %s", domain.ErrInvalidFormat, path)
@@ -216,7 +518,7 @@ func (l *Loader) parseFile(path string) (RawMigration, error) {
 
 	idx := strings.Index(name, string(config.Separator))
 	if idx < 0 {
-		return migration, ErrSeparatorNotFound
+		return migration, fmt.Errorf("%w (%s)", ErrSeparatorNotFound, path)
 	}
 
 	migration.Name = converter.SanitizeMigrationName(strcase.ToLowerCamel(name[idx+1 : idxDirection]))
@@ -225,6 +527,17 @@ func (l *Loader) parseFile(path string) (RawMigration, error) {
 		return migration, fmt.Errorf("%w (%s)", ErrMigrateVersionFile, path)
 	}
 
+	// переменные go-файла относятся к миграции по точному имени, например, Requires1700000200addOrders
+	if migration.Format == config.FormatGolang {
+		declName := strconv.FormatUint(migration.Version, 10) + migration.Name
+		if migration.Requires, err = goRequires(path, goContent, GoRequiresPrefix+declName); err != nil {
+			return migration, fmt.Errorf("%w (%s)", err, path)
+		}
+		if migration.Tags, err = goTags(path, goContent, GoTagsPrefix+declName); err != nil {
+			return migration, fmt.Errorf("%w (%s)", err, path)
+		}
+	}
+
 	return migration, nil
 }
 
@@ -0,0 +1,370 @@
+package loader_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"  //nolint:depguard
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap/zaptest"             //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/loader" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/config"      //nolint:depguard
+)
+
+func TestLoader_LoadMigrations(t *testing.T) {
+	tCases := []struct {
+		name   string
+		format string
+		files  map[string]string
+		vars   map[string]string
+		// check - сравнивает только выбранные поля загруженных миграций
+		check       func(t *testing.T, migrations []loader.RawMigration)
+		expectedErr error
+	}{
+		{
+			name: "literal braces without the template directive",
+			files: map[string]string{
+				"1_matrix.up.sql":   "INSERT INTO matrix (value) VALUES ('{{1,2},{3,4}}');",
+				"1_matrix.down.sql": `DELETE FROM events WHERE payload = '{"a": {"b": 1}}' AND tpl = '{{ .Vars.x }}';`,
+			},
+			check: func(t *testing.T, migrations []loader.RawMigration) {
+				t.Helper()
+				assert.Equal(t, "INSERT INTO matrix (value) VALUES ('{{1,2},{3,4}}');", migrations[0].QueryUp)
+				assert.Equal(t, `DELETE FROM events WHERE payload = '{"a": {"b": 1}}' AND tpl = '{{ .Vars.x }}';`,
+					migrations[0].QueryDown)
+			},
+		},
+		{
+			name: "template directive in one direction",
+			files: map[string]string{
+				"1_grant.up.sql":   "-- +migrate Template\nGRANT SELECT ON users TO {{ .Vars.app_role }};",
+				"1_grant.down.sql": "REVOKE SELECT ON users FROM {{ .Vars.app_role }};",
+			},
+			vars: map[string]string{"app_role": "reader"},
+			check: func(t *testing.T, migrations []loader.RawMigration) {
+				t.Helper()
+				assert.Equal(t, "-- +migrate Template\nGRANT SELECT ON users TO reader;", migrations[0].QueryUp)
+				assert.Equal(t, "REVOKE SELECT ON users FROM {{ .Vars.app_role }};", migrations[0].QueryDown)
+			},
+		},
+		{
+			name: "template with an unknown variable",
+			files: map[string]string{
+				"1_grant.sql": "-- +migrate Template\n-- +migrate Up\nGRANT SELECT ON users TO {{ .Vars.app_role }};\n",
+			},
+			expectedErr: loader.ErrRenderTemplate,
+		},
+		{
+			name: "sql header tags",
+			files: map[string]string{
+				"1_seed.up.sql":   "-- +migrate Tags Seed, dev\n-- +migrate Tags dev qa\nINSERT INTO users VALUES (1);",
+				"1_seed.down.sql": "-- +migrate Tags cleanup\nDELETE FROM users;",
+				"2_schema.sql":    "-- +migrate Up\nCREATE TABLE t (id INT);\n-- +migrate Tags late\n",
+			},
+			check: func(t *testing.T, migrations []loader.RawMigration) {
+				t.Helper()
+				assert.Equal(t, []string{"cleanup", "dev", "qa", "seed"}, migrations[0].Tags)
+				// директива после первого запроса не относится к заголовку
+				assert.Empty(t, migrations[1].Tags)
+			},
+		},
+		{
+			name: "invalid sql tag",
+			files: map[string]string{
+				"1_seed.up.sql": "-- +migrate Tags dev/seed\nSELECT 1;",
+			},
+			expectedErr: loader.ErrInvalidTags,
+		},
+		{
+			name:   "go variables with the exact migration name",
+			format: config.FormatGolang,
+			files: map[string]string{
+				"1_create_users.go": "package main\n",
+				"2_add_orders.go": "package main\n\n" +
+					"var Requires2addOrders = []uint64{1}\n\n" +
+					"var Tags2addOrders = []string{\"Dev\", \"seed\"}\n\n" +
+					"var RequiresCleanup = []int{42}\n",
+			},
+			check: func(t *testing.T, migrations []loader.RawMigration) {
+				t.Helper()
+				assert.Equal(t, "addOrders", migrations[1].Name)
+				assert.Equal(t, []uint64{1}, migrations[1].Requires)
+				assert.Equal(t, []string{"dev", "seed"}, migrations[1].Tags)
+			},
+		},
+		{
+			name:   "go requires variable of another migration",
+			format: config.FormatGolang,
+			files: map[string]string{
+				"1_create_users.go": "package main\n",
+				"2_add_orders.go":   "package main\n\nvar Requires1createUsers = []uint64{1}\n",
+			},
+			expectedErr: loader.ErrInvalidRequires,
+		},
+		{
+			name:   "go tags variable of another migration",
+			format: config.FormatGolang,
+			files: map[string]string{
+				"2_add_orders.go": "package main\n\nvar Tags2addOrder = []string{\"dev\"}\n",
+			},
+			expectedErr: loader.ErrInvalidTags,
+		},
+		{
+			name: "dependency cycle",
+			files: map[string]string{
+				"1_first.sql":  "-- +migrate Requires 2\n-- +migrate Up\nSELECT 1;\n",
+				"2_second.sql": "-- +migrate Requires 1\n-- +migrate Up\nSELECT 2;\n",
+			},
+			expectedErr: loader.ErrDependencyCycle,
+		},
+		{
+			name: "up and down files in different directories",
+			files: map[string]string{
+				"billing/1_orders.up.sql": "CREATE TABLE orders (id INT);",
+				"users/1_orders.down.sql": "DROP TABLE orders;",
+			},
+			expectedErr: loader.ErrMigrationDifferentDirs,
+		},
+		{
+			name: "up and down files in one nested directory",
+			files: map[string]string{
+				"billing/1_orders.up.sql":   "CREATE TABLE orders (id INT);",
+				"billing/1_orders.down.sql": "DROP TABLE orders;",
+			},
+			check: func(t *testing.T, migrations []loader.RawMigration) {
+				t.Helper()
+				assert.Equal(t, "billing/1_orders.up.sql", migrations[0].PathUp)
+				assert.Equal(t, "billing/1_orders.down.sql", migrations[0].PathDown)
+			},
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			fsys := make(fstest.MapFS, len(tCase.files))
+			for name, content := range tCase.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(content)}
+			}
+			migrationLoader := loader.NewLoader(zaptest.NewLogger(t))
+			if tCase.format != "" {
+				migrationLoader.SetFormat(tCase.format)
+			}
+			migrationLoader.SetVars(tCase.vars)
+			migrationLoader.SetSource(loader.FSSource(fsys))
+
+			migrations, err := migrationLoader.LoadMigrations(context.Background(), loader.Filter{}, true)
+			if tCase.expectedErr != nil {
+				assert.ErrorIs(t, err, tCase.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.NotEmpty(t, migrations)
+			tCase.check(t, migrations)
+		})
+	}
+}
+
+func TestDirSources(t *testing.T) {
+	tmpDir := t.TempDir()
+	files := []string{
+		"core/1_init.up.sql",
+		"modules/billing/migrations/2_invoices.up.sql",
+		"modules/users/migrations/3_users.up.sql",
+		"modules/readme/migrations",
+	}
+	for _, name := range files {
+		path := filepath.Join(tmpDir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("SELECT 1;"), 0o600))
+	}
+	join := func(name string) string {
+		return filepath.Join(tmpDir, filepath.FromSlash(name))
+	}
+
+	tCases := []struct {
+		name        string
+		paths       []string
+		expected    []string
+		expectedErr error
+	}{
+		{
+			name:     "directory",
+			paths:    []string{join("core")},
+			expected: []string{join("core/1_init.up.sql")},
+		},
+		{
+			name:  "glob matches only directories",
+			paths: []string{join("modules/*/migrations")},
+			expected: []string{
+				join("modules/billing/migrations/2_invoices.up.sql"),
+				join("modules/users/migrations/3_users.up.sql"),
+			},
+		},
+		{
+			name:  "repeated and overlapping paths",
+			paths: []string{join("core"), join("modules/*/migrations"), join("core"), join("modules/users/migrations")},
+			expected: []string{
+				join("core/1_init.up.sql"),
+				join("modules/billing/migrations/2_invoices.up.sql"),
+				join("modules/users/migrations/3_users.up.sql"),
+			},
+		},
+		{
+			name:        "glob without directories",
+			paths:       []string{join("core"), join("plugins/*")},
+			expectedErr: loader.ErrMigrationPath,
+		},
+		{
+			name:        "missing directory",
+			paths:       []string{join("missing")},
+			expectedErr: loader.ErrMigrationPath,
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			migrationLoader := loader.NewLoader(zaptest.NewLogger(t))
+			migrationLoader.SetSource(loader.DirSources(tCase.paths...)...)
+
+			migrations, err := migrationLoader.LoadMigrations(context.Background(), loader.Filter{}, true)
+			if tCase.expectedErr != nil {
+				assert.ErrorIs(t, err, tCase.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			paths := make([]string, 0, len(migrations))
+			for _, migration := range migrations {
+				paths = append(paths, migration.PathUp)
+			}
+			assert.Equal(t, tCase.expected, paths)
+		})
+	}
+}
+
+func TestSortByDependencies(t *testing.T) {
+	tCases := []struct {
+		name        string
+		migrations  []loader.RawMigration
+		expected    []uint64
+		expectedErr error
+	}{
+		{
+			name:       "version order without dependencies",
+			migrations: []loader.RawMigration{{Version: 1}, {Version: 2}, {Version: 3}},
+			expected:   []uint64{1, 2, 3},
+		},
+		{
+			name: "dependency on a later version",
+			migrations: []loader.RawMigration{
+				{Version: 1}, {Version: 2, Requires: []uint64{4}}, {Version: 3}, {Version: 4, Requires: []uint64{1, 3}},
+			},
+			expected: []uint64{1, 3, 4, 2},
+		},
+		{
+			name:       "dependency on a version outside of the list",
+			migrations: []loader.RawMigration{{Version: 2, Requires: []uint64{1}}, {Version: 3}},
+			expected:   []uint64{2, 3},
+		},
+		{
+			name: "cycle",
+			migrations: []loader.RawMigration{
+				{Version: 1}, {Version: 2, Requires: []uint64{3}}, {Version: 3, Requires: []uint64{2}},
+			},
+			expectedErr: loader.ErrDependencyCycle,
+		},
+		{
+			name:        "self dependency",
+			migrations:  []loader.RawMigration{{Version: 1, Requires: []uint64{1}}},
+			expectedErr: loader.ErrDependencyCycle,
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			sorted, err := loader.SortByDependencies(tCase.migrations)
+			if tCase.expectedErr != nil {
+				assert.ErrorIs(t, err, tCase.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			versions := make([]uint64, 0, len(sorted))
+			for _, migration := range sorted {
+				versions = append(versions, migration.Version)
+			}
+			assert.Equal(t, tCase.expected, versions)
+		})
+	}
+}
+
+func TestCheckDependencies(t *testing.T) {
+	tCases := []struct {
+		name       string
+		migrations []loader.RawMigration
+		expected   []string
+	}{
+		{
+			name: "satisfied",
+			migrations: []loader.RawMigration{
+				{Version: 1, Name: "first"}, {Version: 2, Name: "second", Requires: []uint64{1}},
+			},
+		},
+		{
+			name: "missing requirement",
+			migrations: []loader.RawMigration{
+				{Version: 1, Name: "first"},
+				{Version: 2, Name: "second", PathUp: "2_second.up.sql", Requires: []uint64{1, 7}},
+			},
+			expected: []string{loader.ErrDependencyNotFound.Error() + ": 2 (second) requires 7, declared in 2_second.up.sql"},
+		},
+		{
+			name: "cycle",
+			migrations: []loader.RawMigration{
+				{Version: 1, Name: "first", Requires: []uint64{2}},
+				{Version: 2, Name: "second", Requires: []uint64{1}},
+			},
+			expected: []string{loader.ErrDependencyCycle.Error() + ": 1 (first) requires 2 (second) requires 1 (first)"},
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			problems := loader.CheckDependencies(tCase.migrations)
+			messages := make([]string, 0, len(problems))
+			for _, problem := range problems {
+				messages = append(messages, problem.Error())
+			}
+			assert.ElementsMatch(t, tCase.expected, messages)
+		})
+	}
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tCases := []struct {
+		name        string
+		tags        []string
+		expected    []string
+		expectedErr error
+	}{
+		{name: "empty", tags: nil, expected: nil},
+		{name: "lower case, sorted, without repeats", tags: []string{"Seed", " dev ", "seed", ""},
+			expected: []string{"dev", "seed"}},
+		{name: "allowed characters", tags: []string{"v1.2_beta-3"}, expected: []string{"v1.2_beta-3"}},
+		{name: "invalid character", tags: []string{"dev/seed"}, expectedErr: loader.ErrInvalidTags},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			tags, err := loader.NormalizeTags(tCase.tags)
+			if tCase.expectedErr != nil {
+				assert.ErrorIs(t, err, tCase.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tCase.expected, tags)
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package loader
 
+import "fmt"
+
 // RawMigration.
 type RawMigration struct {
 	Version   uint64
@@ -9,6 +11,22 @@ type RawMigration struct {
 	Format    string
 	QueryUp   string
 	QueryDown string
+	// LineOffsetUp, LineOffsetDown - число строк файла перед запросом (для файла с секциями).
+	LineOffsetUp   int
+	LineOffsetDown int
+	// Repeatable - повторяемая миграция (R_<имя>.sql): без версии и отката,
+	// накатывается заново при изменении контрольной суммы.
+	Repeatable bool
+	// NoTransaction - миграция выполняется без транзакции (директива NoTransaction).
+	NoTransaction bool
+	// TemplateUp, TemplateDown - запросы являются шаблоном (директива Template в файле направления).
+	TemplateUp   bool
+	TemplateDown bool
+	// Requires - версии миграций, которые должны быть применены раньше этой.
+	Requires []uint64
+	// Tags - теги миграции (в нижнем регистре, отсортированы).
+	Tags     []string
+	Checksum string
 }
 
 // GetPath - возвращает путь в зависимости от направления миграции.
@@ -20,6 +38,16 @@ func (rm *RawMigration) GetPath(direction bool) string {
 	return rm.PathDown
 }
 
+// location - возвращает путь миграции в зависимости от направления для сообщений
+// (для зарегистрированной миграции - ее версию и имя).
+func (rm *RawMigration) location(direction bool) string {
+	if rm.Format == FormatRegistered {
+		return fmt.Sprintf("registered migration %d (%s)", rm.Version, rm.Name)
+	}
+
+	return rm.GetPath(direction)
+}
+
 // GetQuery - возвращает запрос в зависимости от направления.
 func (rm *RawMigration) GetQuery(direction bool) string {
 	if direction {
@@ -28,3 +56,12 @@ func (rm *RawMigration) GetQuery(direction bool) string {
 
 	return rm.QueryDown
 }
+
+// GetLineOffset - возвращает число строк файла перед запросом в зависимости от направления.
+func (rm *RawMigration) GetLineOffset(direction bool) int {
+	if direction {
+		return rm.LineOffsetUp
+	}
+
+	return rm.LineOffsetDown
+}
@@ -0,0 +1,51 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/BashMS/SQL_migrator/pkg/config" //nolint:depguard
+)
+
+// templateData - данные шаблона sql-миграции.
+type templateData struct {
+	Vars map[string]string
+}
+
+// render - подставляет переменные в запросы sql-миграции вида {{ .Vars.app_role }},
+// если файл направления помечен директивой Template.
+func (l *Loader) render(migration *RawMigration) error {
+	if migration.Format != config.FormatSQL {
+		return nil
+	}
+
+	var err error
+	if migration.TemplateUp {
+		if migration.QueryUp, err = l.renderQuery(migration.PathUp, "up", migration.QueryUp); err != nil {
+			return err
+		}
+	}
+	if migration.TemplateDown {
+		if migration.QueryDown, err = l.renderQuery(migration.PathDown, "down", migration.QueryDown); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *Loader) renderQuery(path, direction, query string) (string, error) {
+	tpl, err := template.New(path).Option("missingkey=error").Parse(query)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", ErrRenderTemplate, err.Error())
+	}
+
+	var builder strings.Builder
+	if err := tpl.Execute(&builder, templateData{Vars: l.vars}); err != nil {
+		return "", fmt.Errorf("%w: %s", ErrRenderTemplate, err.Error())
+	}
+	l.logger.Debug(fmt.Sprintf("rendered %s (%s):\n%s", path, direction, builder.String()))
+
+	return builder.String(), nil
+}
@@ -0,0 +1,202 @@
+package loader
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const (
+	// DirectiveUp - начало секции наката в sql-файле миграции.
+	DirectiveUp = "Up"
+	// DirectiveDown - начало секции отката в sql-файле миграции.
+	DirectiveDown = "Down"
+	// DirectiveNoTransaction - миграция выполняется без транзакции (для sql-файла `-- +migrate NoTransaction`,
+	// для go-файла `// +migrate NoTransaction`).
+	DirectiveNoTransaction = "NoTransaction"
+	// DirectiveTemplate - запросы sql-файла являются шаблоном text/template с переменными {{ .Vars.<имя> }}
+	// (`-- +migrate Template`). Без директивы текст вида {{ ... }} выполняется как есть.
+	DirectiveTemplate = "Template"
+)
+
+var (
+	// directiveRegexp - строка-директива sql-файла вида `-- +migrate Up`.
+	directiveRegexp = regexp.MustCompile(`^\s*--\s*\+migrate\s+(\S+)\s*$`)
+	// goDirectiveRegexp - строка-директива go-файла вида `// +migrate NoTransaction`.
+	goDirectiveRegexp = regexp.MustCompile(`^\s*//\s*\+migrate\s+(\S+)\s*$`)
+	// headerDirectiveRegexp - строка-директива со значениями вида `-- +migrate Requires 1700000123, 1700000124`.
+	headerDirectiveRegexp = regexp.MustCompile(`^\s*--\s*\+migrate\s+(\S+)\s+(.+?)\s*$`)
+)
+
+// sqlSection - секция sql-файла миграции.
+type sqlSection struct {
+	builder strings.Builder
+	// line - номер строки файла с директивой секции.
+	line int
+}
+
+// sqlSections - результат разбора sql-файла миграции с секциями.
+type sqlSections struct {
+	up, down                     string
+	lineOffsetUp, lineOffsetDown int
+	noTransaction                bool
+	template                     bool
+}
+
+// query - возвращает запрос секции без пустых строк в начале и пробелов в конце
+// и число строк файла перед запросом.
+func (s *sqlSection) query() (string, int) {
+	query := strings.TrimRightFunc(s.builder.String(), unicode.IsSpace)
+	offset := s.line
+	for {
+		line, rest, found := strings.Cut(query, "\n")
+		if !found || strings.TrimSpace(line) != "" {
+			break
+		}
+		query = rest
+		offset++
+	}
+	if strings.TrimSpace(query) == "" {
+		return "", 0
+	}
+
+	return query, offset
+}
+
+// parseSQLSections - разбирает sql-файл миграции с секциями `-- +migrate Up` и `-- +migrate Down`.
+// До первой секции допускаются только комментарии и пустые строки.
+func parseSQLSections(content string) (sqlSections, error) {
+	var (
+		up, down      sqlSection
+		current       *sqlSection
+		noTransaction bool
+		isTemplate    bool
+		seen          = make(map[string]bool)
+	)
+	for number, line := range strings.SplitAfter(content, "\n") {
+		if match := directiveRegexp.FindStringSubmatch(strings.TrimRight(line, "\r\n")); match != nil {
+			var directive string
+			switch {
+			case strings.EqualFold(match[1], DirectiveUp):
+				directive, current = DirectiveUp, &up
+			case strings.EqualFold(match[1], DirectiveDown):
+				directive, current = DirectiveDown, &down
+			case strings.EqualFold(match[1], DirectiveNoTransaction):
+				noTransaction = true
+				continue
+			case strings.EqualFold(match[1], DirectiveTemplate):
+				isTemplate = true
+				continue
+			default:
+				return sqlSections{}, fmt.Errorf("%w: %q (line %d)", ErrUnknownDirective, match[1], number+1)
+			}
+			if seen[directive] {
+				return sqlSections{}, fmt.Errorf("%w: %s (line %d)", ErrDuplicateSection, directive, number+1)
+			}
+			seen[directive] = true
+			current.line = number + 1
+
+			continue
+		}
+
+		if current == nil {
+			trimmed := strings.TrimSpace(line)
+			if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return sqlSections{}, fmt.Errorf("%w (line %d)", ErrStatementOutsideSection, number+1)
+			}
+
+			continue
+		}
+		current.builder.WriteString(line)
+	}
+
+	if !seen[DirectiveUp] {
+		return sqlSections{}, ErrSectionUpNotFound
+	}
+
+	sections := sqlSections{noTransaction: noTransaction, template: isTemplate}
+	sections.up, sections.lineOffsetUp = up.query()
+	sections.down, sections.lineOffsetDown = down.query()
+
+	return sections, nil
+}
+
+// hasDirective - сообщает, есть ли в файле строка-директива directive.
+func hasDirective(content, directive string, re *regexp.Regexp) bool {
+	for _, line := range strings.Split(content, "\n") {
+		if match := re.FindStringSubmatch(strings.TrimRight(line, "\r")); match != nil &&
+			strings.EqualFold(match[1], directive) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// headerValues - возвращает значения директивы directive из заголовка sql-файла (комментариев до первого запроса).
+// Значения разделяются запятыми или пробелами; директива может повторяться.
+func headerValues(content, directive string) []string {
+	var values []string
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, "\r")
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+			break
+		}
+		match := headerDirectiveRegexp.FindStringSubmatch(line)
+		if match == nil || !strings.EqualFold(match[1], directive) {
+			continue
+		}
+		values = append(values, strings.FieldsFunc(match[2], func(r rune) bool {
+			return r == ',' || unicode.IsSpace(r)
+		})...)
+	}
+
+	return values
+}
+
+// goVarValue - возвращает значение переменной go-файла name вида <prefix><версия><имя> или nil, если ее нет.
+// Переменная с тем же префиксом и другой версией или именем (например, скопированная из другой миграции) - ошибка.
+// Синтаксические ошибки файла здесь не сообщаются: они будут найдены при сборке программы миграций.
+func goVarValue(path string, content []byte, prefix, name string) (ast.Expr, error) {
+	if !strings.Contains(string(content), prefix) {
+		return nil, nil
+	}
+	file, _ := parser.ParseFile(token.NewFileSet(), path, content, parser.SkipObjectResolution)
+	if file == nil {
+		return nil, nil
+	}
+
+	var value ast.Expr
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			valueSpec, ok := spec.(*ast.ValueSpec)
+			if !ok {
+				continue
+			}
+			for idx, ident := range valueSpec.Names {
+				suffix, ok := strings.CutPrefix(ident.Name, prefix)
+				if !ok || suffix == "" || !unicode.IsDigit(rune(suffix[0])) {
+					continue
+				}
+				if ident.Name != name {
+					return nil, fmt.Errorf("%s does not match the migration, expected %s", ident.Name, name)
+				}
+				if idx >= len(valueSpec.Values) {
+					return nil, fmt.Errorf("%s has no value", ident.Name)
+				}
+				value = valueSpec.Values[idx]
+			}
+		}
+	}
+
+	return value, nil
+}
@@ -0,0 +1,110 @@
+package loader
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Source - источник файлов миграций: каталог ОС или любая fs.FS (например, embed.FS).
+type Source struct {
+	fsys fs.FS
+	// root - каталог ОС, к которому относятся имена файлов fsys (пустой для произвольной fs.FS).
+	root string
+}
+
+// DirSource - источник миграций в каталоге ОС path.
+// Пути файлов миграций указываются относительно path так же, как в файловой системе ОС.
+func DirSource(path string) Source {
+	if path == "" {
+		return Source{}
+	}
+
+	return Source{fsys: os.DirFS(path), root: path}
+}
+
+// DirSources - источники миграций в каталогах ОС paths. Путь может быть glob-шаблоном
+// (например, modules/*/migrations), который заменяется всеми подходящими каталогами.
+// Повторяющиеся каталоги пропускаются; шаблон без подходящих каталогов дает источник,
+// загрузка из которого завершается ошибкой ErrMigrationPath.
+func DirSources(paths ...string) []Source {
+	var (
+		sources []Source
+		seen    = make(map[string]bool)
+	)
+	add := func(path string) {
+		if clean := filepath.Clean(path); !seen[clean] {
+			seen[clean] = true
+			sources = append(sources, DirSource(path))
+		}
+	}
+	for _, path := range paths {
+		if !isGlob(path) {
+			add(path)
+			continue
+		}
+
+		var found bool
+		matches, _ := filepath.Glob(path)
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				found = true
+				add(match)
+			}
+		}
+		if !found {
+			sources = append(sources, Source{root: path})
+		}
+	}
+
+	return sources
+}
+
+// isGlob - сообщает, что путь является glob-шаблоном.
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// FSSource - источник миграций в fsys. Файлы ищутся во всех каталогах fsys, начиная с корня,
+// поэтому для embed.FS с каталогом migrations следует передать fs.Sub(fsys, "migrations").
+// Пути файлов миграций - имена файлов в fsys (например, "1_init.up.sql").
+func FSSource(fsys fs.FS) Source {
+	return Source{fsys: fsys}
+}
+
+// contains - сообщает, что файл с путем path относится к источнику, и возвращает его имя в источнике.
+func (s Source) contains(path string) (string, bool) {
+	if s.fsys == nil {
+		return "", false
+	}
+	name, err := s.name(path)
+	if err != nil || name == ".." || strings.HasPrefix(name, "../") {
+		return "", false
+	}
+
+	return name, true
+}
+
+// path - возвращает путь файла name источника, под которым он указывается в миграциях и сообщениях.
+func (s Source) path(name string) string {
+	if s.root == "" {
+		return name
+	}
+
+	return filepath.Join(s.root, filepath.FromSlash(name))
+}
+
+// name - возвращает имя файла источника по его пути (обратное path).
+func (s Source) name(path string) (string, error) {
+	if s.root == "" {
+		return path, nil
+	}
+	rel, err := filepath.Rel(s.root, path)
+	if err != nil {
+		return "", fmt.Errorf("%w %s", ErrReadFile, path)
+	}
+
+	return filepath.ToSlash(rel), nil
+}
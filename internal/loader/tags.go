@@ -0,0 +1,105 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DirectiveTags - теги миграции (заголовок sql-файла `-- +migrate Tags dev, seed`).
+const DirectiveTags = "Tags"
+
+// GoTagsPrefix - префикс переменной go-файла с тегами миграции (`var Tags<версия><имя> = []string{"dev"}`).
+const GoTagsPrefix = "Tags"
+
+// ErrInvalidTags - неверный тег миграции.
+var ErrInvalidTags = errors.New("invalid migration tags (letters, digits, '_', '-' and '.' are allowed)")
+
+// tagRegexp - допустимый тег миграции.
+var tagRegexp = regexp.MustCompile(`^[a-z0-9_.-]+$`)
+
+// NormalizeTags - приводит теги к нижнему регистру, убирает повторы и сортирует их.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	var result []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if !tagRegexp.MatchString(tag) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidTags, tag)
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			result = append(result, tag)
+		}
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// sqlTags - возвращает теги из заголовка sql-файла.
+func sqlTags(content string) ([]string, error) {
+	return NormalizeTags(headerValues(content, DirectiveTags))
+}
+
+// goTags - возвращает теги из переменной go-файла name (Tags<версия><имя>).
+func goTags(path string, content []byte, name string) ([]string, error) {
+	value, err := goVarValue(path, content, GoTagsPrefix, name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidTags, err.Error())
+	}
+	if value == nil {
+		return nil, nil
+	}
+
+	tags, err := literalStrings(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s %s", ErrInvalidTags, name, err.Error())
+	}
+
+	return NormalizeTags(tags)
+}
+
+// literalStrings - возвращает строки из литерала вида []string{"dev", "seed"}.
+func literalStrings(expr ast.Expr) ([]string, error) {
+	literal, ok := expr.(*ast.CompositeLit)
+	if !ok {
+		return nil, errors.New("must be a []string literal")
+	}
+
+	strs := make([]string, 0, len(literal.Elts))
+	for _, elt := range literal.Elts {
+		basic, ok := elt.(*ast.BasicLit)
+		if !ok || basic.Kind != token.STRING {
+			return nil, errors.New("must contain only string literals")
+		}
+		str, err := strconv.Unquote(basic.Value)
+		if err != nil {
+			return nil, fmt.Errorf("has invalid string %s", basic.Value)
+		}
+		strs = append(strs, str)
+	}
+
+	return strs, nil
+}
+
+// hasAnyTag - сообщает, есть ли среди tags хотя бы один тег из wanted.
+func hasAnyTag(tags, wanted []string) bool {
+	for _, tag := range tags {
+		for _, want := range wanted {
+			if tag == want {
+				return true
+			}
+		}
+	}
+
+	return false
+}
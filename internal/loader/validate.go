@@ -0,0 +1,98 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"sort"
+
+	"github.com/BashMS/SQL_migrator/internal/splitter" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/config"        //nolint:depguard
+)
+
+var (
+	// ErrUpFileNotFound - у sql-миграции нет файла наката.
+	ErrUpFileNotFound = errors.New("up migration file not found")
+	// ErrDownFileNotFound - у sql-миграции нет файла отката.
+	ErrDownFileNotFound = errors.New("down migration file not found")
+	// ErrEmptyUp - в миграции нет запросов наката.
+	ErrEmptyUp = errors.New("up migration is empty")
+	// ErrGoParse - go-файл миграции не разбирается (синтаксические ошибки).
+	// Ошибки типов находит сборка программы миграций.
+	ErrGoParse = errors.New("go migration file cannot be parsed")
+)
+
+// Validate - проверяет файлы миграций источников без подключения к БД.
+// В отличие от LoadMigrations, проверка не останавливается на первой ошибке и возвращает все найденные проблемы:
+// неразбираемые имена и содержимое файлов, повторяющиеся версии, разные имена файлов наката и отката,
+// отсутствующие файлы наката и отката, пустые файлы наката, синтаксические ошибки go-файлов,
+// зависимости от отсутствующих миграций и циклы зависимостей.
+// Ошибка возвращается, только если каталог не удалось обойти.
+func (l *Loader) Validate(ctx context.Context) ([]error, error) {
+	l.resetMigrations()
+
+	var (
+		problems   []error
+		repeatable = make(map[string]string)
+	)
+	err := l.walkFiles(ctx, func(source Source, name string) error {
+		migration, err := l.parseFile(source, name)
+		switch {
+		case errors.Is(err, ErrSkipFile):
+			return nil
+		case err != nil:
+			problems = append(problems, err)
+			return nil
+		case migration.Repeatable:
+			if existing, ok := repeatable[migration.Name]; ok {
+				problems = append(problems, fmt.Errorf("%w: %s and %s", ErrRepeatableNameUnique, existing, migration.PathUp))
+			}
+			repeatable[migration.Name] = migration.PathUp
+			return nil
+		}
+
+		if migration.Format == config.FormatGolang {
+			content, err := fs.ReadFile(source.fsys, name)
+			if err == nil {
+				_, err = parser.ParseFile(token.NewFileSet(), migration.PathUp, content, parser.AllErrors)
+			}
+			if err != nil {
+				problems = append(problems, fmt.Errorf("%w: %s", ErrGoParse, err.Error()))
+			}
+		}
+		if err := l.addMigration(migration); err != nil {
+			problems = append(problems, err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, migration := range l.registered {
+		if err := l.addMigration(migration); err != nil {
+			problems = append(problems, err)
+		}
+	}
+
+	sort.Sort(l)
+	for _, migration := range l.listMigrations {
+		if migration.Format != config.FormatSQL {
+			continue
+		}
+		switch {
+		case migration.PathUp == "":
+			problems = append(problems, fmt.Errorf("%w for %s", ErrUpFileNotFound, migration.PathDown))
+		case len(splitter.Split(migration.QueryUp, splitter.Options{})) == 0:
+			problems = append(problems, fmt.Errorf("%w (%s)", ErrEmptyUp, migration.PathUp))
+		}
+		if migration.PathDown == "" {
+			problems = append(problems, fmt.Errorf("%w for %s", ErrDownFileNotFound, migration.PathUp))
+		}
+	}
+
+	return append(problems, CheckDependencies(l.listMigrations)...), nil
+}
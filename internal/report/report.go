@@ -2,6 +2,8 @@ package report
 
 import (
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/BashMS/SQL_migrator/pkg/domain" //nolint:depguard
 	"github.com/alexeyco/simpletable"           //nolint:depguard
@@ -16,22 +18,21 @@ func PrintMigrations(migrations []domain.Migration) {
 			{Align: simpletable.AlignCenter, Span: 0, Text: "#"},
 			{Align: simpletable.AlignCenter, Span: 0, Text: "Version"},
 			{Align: simpletable.AlignCenter, Span: 0, Text: "Name"},
-			{Align: simpletable.AlignCenter, Span: 0, Text: "Is applied?"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Tags"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Status"},
 			{Align: simpletable.AlignCenter, Span: 0, Text: "Date update"},
 		},
 	}
 
 	for index, migration := range migrations {
-		isApplied := aurora.Blue("No").String()
-		if migration.IsApplied {
-			isApplied = aurora.Cyan("Yes").String()
-		}
+		status := statusText(migration)
 
 		row := []*simpletable.Cell{
 			{Align: simpletable.AlignRight, Text: fmt.Sprintf("%d", index+1)},
 			{Align: simpletable.AlignCenter, Text: fmt.Sprintf("%d", migration.Version)},
 			{Align: simpletable.AlignCenter, Text: migration.Name},
-			{Align: simpletable.AlignCenter, Text: isApplied},
+			{Align: simpletable.AlignCenter, Text: strings.Join(migration.Tags, ", ")},
+			{Align: simpletable.AlignCenter, Text: status},
 			{Align: simpletable.AlignCenter, Text: migration.UpdateAt.String()},
 		}
 		table.Body.Cells = append(table.Body.Cells, row)
@@ -41,6 +42,45 @@ func PrintMigrations(migrations []domain.Migration) {
 	table.Println()
 }
 
+// PrintRepeatableMigrations - выводит таблицу повторяемых миграций.
+func PrintRepeatableMigrations(migrations []domain.RepeatableMigration) {
+	table := simpletable.New()
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Span: 0, Text: "#"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Repeatable"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Status"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Date applied"},
+		},
+	}
+
+	for index, migration := range migrations {
+		status := aurora.Cyan(migration.Status).String()
+		switch migration.Status {
+		case domain.StatusOutdated:
+			status = aurora.Yellow(migration.Status).String()
+		case domain.StatusPending:
+			status = aurora.Blue(migration.Status).String()
+		}
+
+		var appliedAt string
+		if !migration.AppliedAt.IsZero() {
+			appliedAt = migration.AppliedAt.String()
+		}
+
+		row := []*simpletable.Cell{
+			{Align: simpletable.AlignRight, Text: fmt.Sprintf("%d", index+1)},
+			{Align: simpletable.AlignCenter, Text: migration.Name},
+			{Align: simpletable.AlignCenter, Text: status},
+			{Align: simpletable.AlignCenter, Text: appliedAt},
+		}
+		table.Body.Cells = append(table.Body.Cells, row)
+	}
+
+	table.SetStyle(simpletable.StyleDefault)
+	table.Println()
+}
+
 // PrintMigration - выводит информацию о миграции.
 func PrintMigration(migration domain.Migration) {
 	table := simpletable.New()
@@ -78,3 +118,81 @@ func PrintMigration(migration domain.Migration) {
 	table.SetStyle(simpletable.StyleCompactLite)
 	table.Println()
 }
+
+// statusText - возвращает раскрашенное состояние миграции.
+func statusText(migration domain.Migration) string {
+	status := string(migration.Status)
+	if status == "" {
+		status = string(domain.StatusPending)
+		if migration.IsApplied {
+			status = string(domain.StatusApplied)
+		}
+	}
+	if migration.Dirty {
+		status += " (dirty)"
+	}
+	if migration.Missing {
+		status += " (missing)"
+	}
+	if migration.Dirty || migration.Missing {
+		return aurora.Red(status).String()
+	}
+
+	switch migration.Status {
+	case domain.StatusApplied:
+		return aurora.Cyan(status).String()
+	case domain.StatusRunning:
+		return aurora.Yellow(status).String()
+	case domain.StatusFailed:
+		return aurora.Red(status).String()
+	case domain.StatusPending, domain.StatusRolledBack:
+		return aurora.Blue(status).String()
+	}
+
+	return aurora.Blue(status).String()
+}
+
+// PrintExecutions - выводит таблицу журнала выполнения миграций.
+func PrintExecutions(executions []domain.Execution) {
+	table := simpletable.New()
+	table.Header = &simpletable.Header{
+		Cells: []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Version"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Name"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Direction"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Started"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Duration"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Outcome"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "OS user"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "DB role"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Host"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Tool version"},
+			{Align: simpletable.AlignCenter, Span: 0, Text: "Error"},
+		},
+	}
+
+	for _, execution := range executions {
+		outcome := aurora.Cyan(execution.Outcome).String()
+		if execution.Outcome != domain.OutcomeSuccess {
+			outcome = aurora.Red(execution.Outcome).String()
+		}
+
+		row := []*simpletable.Cell{
+			{Align: simpletable.AlignCenter, Text: fmt.Sprintf("%d", execution.Version)},
+			{Align: simpletable.AlignCenter, Text: execution.Name},
+			{Align: simpletable.AlignCenter, Text: execution.Direction},
+			{Align: simpletable.AlignCenter, Text: execution.StartedAt.Local().Format(time.RFC3339)},
+			{Align: simpletable.AlignRight, Text: execution.Duration.String()},
+			{Align: simpletable.AlignCenter, Text: outcome},
+			{Align: simpletable.AlignCenter, Text: execution.OSUser},
+			{Align: simpletable.AlignCenter, Text: execution.DBRole},
+			{Align: simpletable.AlignCenter, Text: execution.Hostname},
+			{Align: simpletable.AlignCenter, Text: execution.ToolVersion},
+			{Align: simpletable.AlignLeft, Text: execution.Error},
+		}
+		table.Body.Cells = append(table.Body.Cells, row)
+	}
+
+	table.SetStyle(simpletable.StyleDefault)
+	table.Println()
+}
@@ -0,0 +1,51 @@
+package splitter
+
+import (
+	"strings"
+)
+
+// Rebind - заменяет плейсхолдеры ? на плейсхолдеры драйвера, которые возвращает placeholder
+// по порядковому номеру (начиная с 1), например, $1, $2, ... для Postgres.
+// Знаки ? внутри строк, идентификаторов в кавычках, комментариев и строк в долларовых кавычках
+// не заменяются. Операторы jsonb ?| и ?& остаются как есть, а оператор ? записывается как ??.
+func Rebind(query string, placeholder func(index int) string) string {
+	var (
+		builder strings.Builder
+		index   int
+		from    int
+	)
+	builder.Grow(len(query))
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			i = skipLineComment(query, i)
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			i = skipBlockComment(query, i)
+		case c == '\'':
+			escapes := i > 0 && (query[i-1] == 'E' || query[i-1] == 'e') && (i == 1 || !isIdentPart(query[i-2]))
+			i = skipQuoted(query, i, '\'', escapes)
+		case c == '"':
+			i = skipQuoted(query, i, c, false)
+		case c == '$':
+			i = skipDollarQuoted(query, i)
+		case c == '?' && i+1 < len(query) && (query[i+1] == '|' || query[i+1] == '&'):
+			i += 2
+		case c == '?' && i+1 < len(query) && query[i+1] == '?':
+			builder.WriteString(query[from : i+1])
+			i += 2
+			from = i
+		case c == '?':
+			index++
+			builder.WriteString(query[from:i])
+			builder.WriteString(placeholder(index))
+			i++
+			from = i
+		default:
+			i++
+		}
+	}
+	builder.WriteString(query[from:])
+
+	return builder.String()
+}
@@ -0,0 +1,225 @@
+package splitter
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Statement - отдельный запрос sql-файла миграции.
+type Statement struct {
+	// Query - текст запроса вместе с завершающей точкой с запятой.
+	Query string
+	// Line, Column - строка и столбец (в символах) начала запроса, начиная с 1.
+	Line   int
+	Column int
+}
+
+// Options - параметры разбора.
+type Options struct {
+	// BackslashEscapes - обратная косая черта экранирует символы во всех строковых литералах (MySQL).
+	// Без этого параметра экранирование действует только в строках вида E'...' (Postgres).
+	BackslashEscapes bool
+	// HashComments - символ # начинает однострочный комментарий (MySQL).
+	HashComments bool
+}
+
+// Location - возвращает строку и столбец символа запроса по его позиции (начиная с 1),
+// например, по позиции из ошибки Postgres.
+func (s Statement) Location(position int) (int, int) {
+	line, column := s.Line, s.Column
+	for _, r := range s.Query {
+		position--
+		if position <= 0 {
+			break
+		}
+		if r == '\n' {
+			line++
+			column = 1
+			continue
+		}
+		column++
+	}
+
+	return line, column
+}
+
+// Split - разбивает текст миграции на запросы по точке с запятой.
+// Точка с запятой внутри строк, идентификаторов в кавычках, комментариев, строк в долларовых кавычках
+// и тел функций BEGIN ATOMIC ... END не завершает запрос. Запросы, состоящие только из комментариев, пропускаются.
+func Split(query string, options Options) []Statement {
+	var (
+		statements  []Statement
+		start       = -1
+		prevWord    string
+		atomicDepth int
+	)
+	appendStatement := func(end int) {
+		if start >= 0 {
+			line, column := position(query, start)
+			statements = append(statements, Statement{Query: query[start:end], Line: line, Column: column})
+		}
+		start = -1
+	}
+
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			i = skipLineComment(query, i)
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			i = skipBlockComment(query, i)
+			continue
+		case c == '#' && options.HashComments:
+			i = skipLineComment(query, i)
+			continue
+		case isSpace(c):
+			i++
+			continue
+		}
+
+		if start < 0 {
+			start = i
+		}
+
+		switch {
+		case c == ';':
+			i++
+			if atomicDepth == 0 {
+				appendStatement(i)
+				prevWord = ""
+			}
+		case c == '\'':
+			escapes := options.BackslashEscapes || (prevWord == "E" && i > 0 && (query[i-1] == 'E' || query[i-1] == 'e'))
+			i = skipQuoted(query, i, '\'', escapes)
+			prevWord = ""
+		case c == '"' || c == '`':
+			i = skipQuoted(query, i, c, false)
+			prevWord = ""
+		case c == '$':
+			i = skipDollarQuoted(query, i)
+			prevWord = ""
+		case isIdentStart(c):
+			end := i
+			for end < len(query) && isIdentPart(query[end]) {
+				end++
+			}
+			word := strings.ToUpper(query[i:end])
+			switch {
+			case word == "ATOMIC" && prevWord == "BEGIN":
+				atomicDepth++
+			case atomicDepth > 0 && word == "CASE":
+				atomicDepth++
+			case atomicDepth > 0 && word == "END":
+				atomicDepth--
+			}
+			prevWord = word
+			i = end
+		default:
+			i++
+			prevWord = ""
+		}
+	}
+	appendStatement(len(query))
+
+	return statements
+}
+
+// position - возвращает строку и столбец (в символах) байта query по его смещению, начиная с 1.
+func position(query string, offset int) (int, int) {
+	before := query[:offset]
+	line := strings.Count(before, "\n") + 1
+	column := utf8.RuneCountInString(before[strings.LastIndexByte(before, '\n')+1:]) + 1
+
+	return line, column
+}
+
+func skipLineComment(query string, i int) int {
+	end := strings.IndexByte(query[i:], '\n')
+	if end < 0 {
+		return len(query)
+	}
+
+	return i + end + 1
+}
+
+// skipBlockComment - пропускает комментарий /* ... */ (в Postgres комментарии могут быть вложенными).
+func skipBlockComment(query string, i int) int {
+	depth := 0
+	for i < len(query) {
+		switch {
+		case strings.HasPrefix(query[i:], "/*"):
+			depth++
+			i += 2
+		case strings.HasPrefix(query[i:], "*/"):
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		default:
+			i++
+		}
+	}
+
+	return i
+}
+
+// skipQuoted - пропускает литерал в кавычках quote; удвоенная кавычка внутри литерала не завершает его.
+func skipQuoted(query string, i int, quote byte, escapes bool) int {
+	for i++; i < len(query); i++ {
+		switch query[i] {
+		case '\\':
+			if escapes {
+				i++
+			}
+		case quote:
+			if i+1 < len(query) && query[i+1] == quote {
+				i++
+				continue
+			}
+
+			return i + 1
+		}
+	}
+
+	return i
+}
+
+// skipDollarQuoted - пропускает строку в долларовых кавычках $tag$ ... $tag$.
+// Если после $ нет тега (например, параметр $1), пропускается только сам символ.
+func skipDollarQuoted(query string, i int) int {
+	if i > 0 && isIdentPart(query[i-1]) {
+		return i + 1
+	}
+
+	end := i + 1
+	if end < len(query) && isIdentStart(query[end]) {
+		for end < len(query) && isIdentPart(query[end]) && query[end] != '$' {
+			end++
+		}
+	}
+	if end >= len(query) || query[end] != '$' {
+		return i + 1
+	}
+
+	tag := query[i : end+1]
+	closing := strings.Index(query[end+1:], tag)
+	if closing < 0 {
+		return len(query)
+	}
+
+	return end + 1 + closing + len(tag)
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= utf8.RuneSelf
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
@@ -0,0 +1,170 @@
+package splitter_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert" //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/splitter" //nolint:depguard
+)
+
+func TestSplit(t *testing.T) {
+	tCases := []struct {
+		name     string
+		query    string
+		options  splitter.Options
+		expected []splitter.Statement
+	}{
+		{
+			name:  "simple statements",
+			query: "CREATE TABLE a (id INT);\nCREATE TABLE b (id INT);",
+			expected: []splitter.Statement{
+				{Query: "CREATE TABLE a (id INT);", Line: 1, Column: 1},
+				{Query: "CREATE TABLE b (id INT);", Line: 2, Column: 1},
+			},
+		},
+		{
+			name:  "last statement without semicolon",
+			query: "SELECT 1;\n  SELECT 2\n",
+			expected: []splitter.Statement{
+				{Query: "SELECT 1;", Line: 1, Column: 1},
+				{Query: "SELECT 2\n", Line: 2, Column: 3},
+			},
+		},
+		{
+			name:  "comments",
+			query: "-- comment;\nSELECT 1; /* block; /* nested; */ */\n-- trailing;\n",
+			expected: []splitter.Statement{
+				{Query: "SELECT 1;", Line: 2, Column: 1},
+			},
+		},
+		{
+			name:  "string literals and identifiers",
+			query: `INSERT INTO "a;b" VALUES ('it''s; fine', E'\';');SELECT 2;`,
+			expected: []splitter.Statement{
+				{Query: `INSERT INTO "a;b" VALUES ('it''s; fine', E'\';');`, Line: 1, Column: 1},
+				{Query: "SELECT 2;", Line: 1, Column: 50},
+			},
+		},
+		{
+			name:    "backslash escapes",
+			query:   "INSERT INTO `a;b` VALUES ('it\\'s; fine');SELECT 2;",
+			options: splitter.Options{BackslashEscapes: true},
+			expected: []splitter.Statement{
+				{Query: "INSERT INTO `a;b` VALUES ('it\\'s; fine');", Line: 1, Column: 1},
+				{Query: "SELECT 2;", Line: 1, Column: 42},
+			},
+		},
+		{
+			name:    "hash comments",
+			query:   "# it's; a comment\nSELECT '#;' FROM t; # trailing ' comment;\nSELECT 2;",
+			options: splitter.Options{BackslashEscapes: true, HashComments: true},
+			expected: []splitter.Statement{
+				{Query: "SELECT '#;' FROM t;", Line: 2, Column: 1},
+				{Query: "SELECT 2;", Line: 3, Column: 1},
+			},
+		},
+		{
+			name:  "hash operator without hash comments",
+			query: "SELECT 5 # 3;\nSELECT '{1}'::jsonb #> '{0}';",
+			expected: []splitter.Statement{
+				{Query: "SELECT 5 # 3;", Line: 1, Column: 1},
+				{Query: "SELECT '{1}'::jsonb #> '{0}';", Line: 2, Column: 1},
+			},
+		},
+		{
+			name: "dollar quoting",
+			query: "CREATE FUNCTION f() RETURNS INT AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql;\n" +
+				"SELECT $$;$$, $1;",
+			expected: []splitter.Statement{
+				{Query: "CREATE FUNCTION f() RETURNS INT AS $body$ BEGIN RETURN 1; END; $body$ LANGUAGE plpgsql;", Line: 1, Column: 1},
+				{Query: "SELECT $$;$$, $1;", Line: 2, Column: 1},
+			},
+		},
+		{
+			name: "begin atomic",
+			query: "CREATE FUNCTION f(a INT) RETURNS INT BEGIN ATOMIC\n" +
+				"  SELECT CASE WHEN a > 0 THEN 1 ELSE 0 END;\nEND;\nSELECT 2;",
+			expected: []splitter.Statement{
+				{
+					Query: "CREATE FUNCTION f(a INT) RETURNS INT BEGIN ATOMIC\n" +
+						"  SELECT CASE WHEN a > 0 THEN 1 ELSE 0 END;\nEND;",
+					Line:   1,
+					Column: 1,
+				},
+				{Query: "SELECT 2;", Line: 4, Column: 1},
+			},
+		},
+		{
+			name:     "empty",
+			query:    "\n-- only comment\n;",
+			expected: []splitter.Statement{{Query: ";", Line: 3, Column: 1}},
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			assert.Equal(t, tCase.expected, splitter.Split(tCase.query, tCase.options))
+		})
+	}
+}
+
+func TestStatement_Location(t *testing.T) {
+	statement := splitter.Statement{Query: "SELECT\n  привет FORM t;", Line: 10, Column: 3}
+
+	line, column := statement.Location(1)
+	assert.Equal(t, 10, line)
+	assert.Equal(t, 3, column)
+
+	line, column = statement.Location(17)
+	assert.Equal(t, 11, line)
+	assert.Equal(t, 10, column)
+}
+
+func TestRebind(t *testing.T) {
+	tCases := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{
+			name:     "placeholders",
+			query:    "UPDATE t SET a = ?, b = ? WHERE id = ?;",
+			expected: "UPDATE t SET a = $1, b = $2 WHERE id = $3;",
+		},
+		{
+			name:     "string literals",
+			query:    "SELECT 'why?', 'it''s ?', E'\\'?', ? FROM t;",
+			expected: "SELECT 'why?', 'it''s ?', E'\\'?', $1 FROM t;",
+		},
+		{
+			name:     "quoted identifiers and comments",
+			query:    "SELECT \"col?\" -- really?\nFROM t /* what? */ WHERE id = ?;",
+			expected: "SELECT \"col?\" -- really?\nFROM t /* what? */ WHERE id = $1;",
+		},
+		{
+			name:     "dollar quoted strings",
+			query:    "DO $func$ BEGIN PERFORM 'a?'; END; $func$; SELECT ?;",
+			expected: "DO $func$ BEGIN PERFORM 'a?'; END; $func$; SELECT $1;",
+		},
+		{
+			name:     "jsonb operators",
+			query:    "SELECT data ?| array['a'], data ?& array['b'], data ?? 'c' FROM t WHERE id = ?;",
+			expected: "SELECT data ?| array['a'], data ?& array['b'], data ? 'c' FROM t WHERE id = $1;",
+		},
+		{
+			name:     "no placeholders",
+			query:    "SELECT 1;",
+			expected: "SELECT 1;",
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			assert.Equal(t, tCase.expected, splitter.Rebind(tCase.query, func(index int) string {
+				return "$" + strconv.Itoa(index)
+			}))
+		})
+	}
+}
@@ -4,29 +4,41 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/jackc/pgconn"                //nolint:depguard
 	"github.com/jackc/pgx/v4"                //nolint:depguard
 	"github.com/jackc/pgx/v4/log/zapadapter" //nolint:depguard
+	"github.com/jackc/pgx/v4/pgxpool"        //nolint:depguard
 
 	"go.uber.org/zap" //nolint:depguard
 
-	"github.com/BashMS/SQL_migrator/pkg/config" //nolint:depguard
-	"github.com/BashMS/SQL_migrator/pkg/domain" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/splitter" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/config"        //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"        //nolint:depguard
 )
 
 const (
-	// MigrationsScheme - схема, где находится таблица миграция.
-	MigrationsScheme = "public"
-	// MigrationsTable - таблица миграции.
-	MigrationsTable = "tmigration"
+	// MigrationsScheme - схема, где по умолчанию находится таблица миграция.
+	MigrationsScheme = config.DefaultTableSchema
+	// MigrationsTable - таблица миграции по умолчанию.
+	MigrationsTable = config.DefaultTableName
 
 	connTimeout  = 2 * time.Second
-	closeTimeout = 2 * time.Second
 	checkTimeout = 200 * time.Millisecond
 
+	lockRetryInterval = 500 * time.Millisecond
+
+	historyTableSuffix = "_history"
+
 	fallbackLogLevel = pgx.LogLevelInfo
+
+	schemePostgres   = "postgres"
+	schemePostgreSQL = "postgresql"
+	schemeMySQL      = "mysql"
+	schemeMariaDB    = "mariadb"
+	schemeSQLite     = "sqlite"
 )
 
 var (
@@ -36,56 +48,131 @@ var (
 	ErrQueryDeadlineExceeded = errors.New("query deadline exceeded")
 	// ErrLock - не удалось установить блокировку.
 	ErrLock = errors.New("failed to apply lock")
+	// ErrNoAppliedMigrations - нет ни одной примененной миграции.
+	ErrNoAppliedMigrations = errors.New("no applied migrations")
 
 	errVersionOrNameEmpty    = errors.New("version or migration name cannot be empty")
-	errCreateStorage         = errors.New("failed to create table for migrations")
-	errCheckStorage          = errors.New("failed to check table existence for migrations")
 	errStartTransaction      = errors.New("failed to start transaction")
+	errAcquireConnection     = errors.New("failed to acquire connection")
 	errBeginMigration        = errors.New("failed begin migration")
 	errCreateMigrationRecord = errors.New("failed to create migration record")
+	errCreateSchema          = errors.New("failed to create schema for migrations")
+	errUpgradeStorage        = errors.New("failed to upgrade table for migrations")
+	errRecordExecution       = errors.New("failed to record migration execution")
 	errDNSEmpty              = errors.New("no DNS connection string")
+	errNotConnected          = errors.New("storage is not connected to the database")
+	errUnknownDialect        = errors.New("unsupported database dialect (allow postgres, mysql or sqlite)")
 )
 
+// executor - соединение или транзакция, в которой выполняется запрос.
+type executor interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+// database - пул или отдельное соединение, через которое хранилище выполняет запросы.
+type database interface {
+	executor
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
 type MigrateStorage interface {
 	Connect(ctx context.Context) error
 	Close()
-	GetConnection(ctx context.Context) (*pgx.Conn, error)
 	Stats(ctx context.Context) ([]domain.Migration, error)
 	GetMigrationsByDirection(ctx context.Context, isApplied bool) (map[uint64]domain.Migration, error)
-	BeginTxMigration(ctx context.Context, migration domain.Migration, direction bool) (pgx.Tx, error)
+	BeginTxMigration(ctx context.Context, migration domain.Migration, direction bool) (Tx, error)
+	BeginNoTxMigration(ctx context.Context, migration domain.Migration, direction bool) (Tx, error)
+	BeginTxRepeatableMigration(ctx context.Context, migration domain.RepeatableMigration) (Tx, error)
+	FailMigration(ctx context.Context, migration domain.Migration, dirty bool) error
+	ResolveMigration(ctx context.Context, version uint64, status domain.MigrationStatus) error
+	RecordExecution(ctx context.Context, execution domain.Execution) error
+	Executions(ctx context.Context, version uint64, limit int) ([]domain.Execution, error)
 	RecentMigration(ctx context.Context) (domain.Migration, error)
-	Lock(ctx context.Context, uid uint32) error
+	RepeatableMigrations(ctx context.Context) ([]domain.RepeatableMigration, error)
+	Lock(ctx context.Context, uid uint32, timeout time.Duration) error
 	UnLock(ctx context.Context) error
+	// SplitOptions - параметры разбора sql-миграций на запросы для СУБД хранилища.
+	SplitOptions() splitter.Options
 }
 
 // postgresStorage слой для работы с БД.
 type postgresStorage struct {
-	storage MigrateStorage
-	config  *config.Config
-	conn    *pgx.Conn
-	logger  *zap.Logger
+	config *config.Config
+	logger *zap.Logger
+	db     database
+	// pool - пул соединений (собственный или переданный приложением).
+	pool *pgxpool.Pool
+	// external - пул или соединение переданы приложением, хранилище их не закрывает.
+	external bool
+	// lockConn - соединение пула, удерживающее advisory-блокировку до вызова UnLock.
+	lockConn *pgxpool.Conn
+	lockUID  uint32
 }
 
-// NewStorage.
+// NewStorage - хранилище, которое само открывает пул соединений по строке подключения из конфигурации.
+// СУБД выбирается по схеме DSN (mysql:// и mariadb:// - MySQL, sqlite:// - SQLite, иначе Postgres).
 func NewStorage(logger *zap.Logger, config *config.Config) MigrateStorage {
+	switch dsnScheme(config.DSN) {
+	case schemeMySQL, schemeMariaDB:
+		return newSQLStorage(logger, config, mysqlDialect{})
+	case schemeSQLite:
+		return newSQLStorage(logger, config, newSQLiteDialect())
+	default:
+		return newPostgresStorage(logger, config)
+	}
+}
+
+func newPostgresStorage(logger *zap.Logger, config *config.Config) MigrateStorage {
 	return &postgresStorage{
 		config: config,
 		logger: logger,
 	}
 }
 
-// Connect устанавливает соединение с БД.
+// NewStorageWithPool - хранилище поверх пула соединений приложения.
+func NewStorageWithPool(logger *zap.Logger, config *config.Config, pool *pgxpool.Pool) MigrateStorage {
+	return &postgresStorage{
+		config:   config,
+		logger:   logger,
+		db:       pool,
+		pool:     pool,
+		external: true,
+	}
+}
+
+// NewStorageWithConn - хранилище поверх соединения приложения.
+// Все запросы, включая advisory-блокировку, выполняются в этом соединении.
+func NewStorageWithConn(logger *zap.Logger, config *config.Config, conn *pgx.Conn) MigrateStorage {
+	return &postgresStorage{
+		config:   config,
+		logger:   logger,
+		db:       conn,
+		external: true,
+	}
+}
+
+// Connect открывает пул соединений с БД и подготавливает служебные таблицы.
+// Если пул или соединение переданы приложением, то только подготавливает служебные таблицы.
 func (ps *postgresStorage) Connect(ctx context.Context) error {
+	if ps.external {
+		return ps.provideStorage(ctx)
+	}
+	if ps.db != nil {
+		return nil
+	}
+
 	var (
 		err        error
 		level      pgx.LogLevel
-		connConfig *pgx.ConnConfig
+		poolConfig *pgxpool.Config
 	)
 	if ps.config.DSN == "" {
 		return errDNSEmpty
 	}
 
-	connConfig, err = pgx.ParseConfig(ps.config.DSN)
+	poolConfig, err = pgxpool.ParseConfig(ps.config.DSN)
 	if err != nil {
 		return err
 	}
@@ -95,127 +182,282 @@ func (ps *postgresStorage) Connect(ctx context.Context) error {
 		level = fallbackLogLevel
 	}
 
+	connConfig := poolConfig.ConnConfig
 	connConfig.Logger = zapadapter.NewLogger(ps.logger)
 	connConfig.LogLevel = level
 	connConfig.PreferSimpleProtocol = true
-	connConfig.RuntimeParams = map[string]string{
-		"standard_conforming_strings": "on",
+	if connConfig.RuntimeParams == nil {
+		connConfig.RuntimeParams = make(map[string]string)
 	}
+	connConfig.RuntimeParams["standard_conforming_strings"] = "on"
 
 	connCtx, cancelFunc := context.WithTimeout(ctx, connTimeout)
 	defer cancelFunc()
-	ps.conn, err = pgx.ConnectConfig(connCtx, connConfig)
+	pool, err := pgxpool.ConnectConfig(connCtx, poolConfig)
 	if err != nil {
 		return err
 	}
+	ps.pool = pool
+	ps.db = pool
 
 	if err = ps.provideStorage(ctx); err != nil {
+		ps.Close()
 		return err
 	}
 
 	return nil
 }
 
-func (ps *postgresStorage) GetConnection(ctx context.Context) (*pgx.Conn, error) {
-	if ps.isClosed() {
-		if err := ps.Connect(ctx); err != nil {
-			return nil, err
-		}
-	}
-
-	return ps.conn, nil
+// SplitOptions - в Postgres обратная косая черта экранирует символы только в строках E'...'.
+func (ps *postgresStorage) SplitOptions() splitter.Options {
+	return splitter.Options{}
 }
 
-// Close закрывает соединение с БД.
+// Close снимает не снятую advisory-блокировку и закрывает собственный пул соединений.
+// Пул или соединение, переданные приложением, остаются открытыми.
 func (ps *postgresStorage) Close() {
-	if ps.conn == nil {
+	if ps.lockConn != nil {
+		ctx, cancelFunc := context.WithTimeout(context.Background(), connTimeout)
+		if err := ps.releaseLockConn(ctx); err != nil {
+			ps.logger.Error("failed to release advisory lock", zap.Error(err))
+		}
+		cancelFunc()
+	}
+	if ps.external || ps.pool == nil {
 		return
 	}
 
-	ctx, cancelFunc := context.WithTimeout(context.Background(), closeTimeout)
-	defer cancelFunc()
-
-	err := ps.conn.Close(ctx)
-	if err != nil {
-		ps.logger.Error("failed to close postgresStorage connection correctly", zap.Error(err))
-	}
-	ps.conn = nil
-	ps.storage = nil
+	ps.pool.Close()
+	ps.pool = nil
+	ps.db = nil
 }
 
+// BeginTxMigration - переводит миграцию в состояние running и открывает транзакцию,
+// в которой миграция уже переведена в конечное состояние (applied или rolled_back).
+// Если транзакция не будет зафиксирована, миграция останется в состоянии running (dirty).
 func (ps *postgresStorage) BeginTxMigration(
 	ctx context.Context,
 	migration domain.Migration,
 	direction bool,
-) (pgx.Tx, error) {
-	if ps.isClosed() {
-		if err := ps.Connect(ctx); err != nil {
-			return nil, err
-		}
+) (Tx, error) {
+	if ps.db == nil {
+		return nil, errNotConnected
 	}
 	if err := ps.provideMigration(ctx, migration); err != nil {
 		return nil, err
 	}
+	if err := ps.startMigration(ctx, migration, direction); err != nil {
+		return nil, err
+	}
 
-	tx, err := ps.conn.Begin(ctx)
+	tx, err := ps.db.Begin(ctx)
 	if err != nil {
+		ps.failStartedMigration(ctx, migration)
 		return nil, fmt.Errorf("%w, %s", errStartTransaction, err.Error())
 	}
 
-	query := `
-	WITH desiredMigration AS (
-		SELECT version
-		FROM "public"."tmigration"
-		WHERE version = $1
-		  AND is_applied = NOT $2
-			FOR UPDATE
-	)
-	UPDATE "public"."tmigration" m
-	SET is_applied = $2,
-		update_at  = localtimestamp
-	FROM desiredMigration
-	WHERE m.version = desiredMigration.version
-	RETURNING m.version;
-`
-	ctx, cancelFunc := context.WithTimeout(ctx, checkTimeout)
-	defer cancelFunc()
+	if err := ps.finishMigration(ctx, tx, migration, direction); err != nil {
+		if errRollback := tx.Rollback(ctx); errRollback != nil {
+			ps.logger.Error("failed to rollback migration transaction", zap.Error(errRollback))
+		}
+		ps.failStartedMigration(ctx, migration)
+		return nil, err
+	}
+
+	return NewPgxTx(tx), nil
+}
+
+// BeginNoTxMigration - переводит миграцию в состояние running и выделяет соединение
+// для выполнения запросов без транзакции (CREATE INDEX CONCURRENTLY, VACUUM и т.п.).
+// Конечное состояние записывается при фиксации; до этого миграция остается в состоянии running (dirty).
+func (ps *postgresStorage) BeginNoTxMigration(
+	ctx context.Context,
+	migration domain.Migration,
+	direction bool,
+) (Tx, error) {
+	if ps.db == nil {
+		return nil, errNotConnected
+	}
+	if err := ps.provideMigration(ctx, migration); err != nil {
+		return nil, err
+	}
+	if err := ps.startMigration(ctx, migration, direction); err != nil {
+		return nil, err
+	}
 
-	tag, err := tx.Exec(ctx, query, migration.Version, direction)
+	conn, release, err := ps.acquireConn(ctx)
 	if err != nil {
-		if pgconn.Timeout(err) {
-			return nil, ErrQueryDeadlineExceeded
-		}
+		ps.failStartedMigration(ctx, migration)
+		return nil, fmt.Errorf("%w, %s", errAcquireConnection, err.Error())
+	}
 
-		return nil, fmt.Errorf("%w: %s", errBeginMigration, err.Error())
+	return &pgxConnTx{
+		conn:    conn,
+		release: release,
+		finish: func(ctx context.Context) error {
+			return ps.finishMigration(ctx, conn, migration, direction)
+		},
+	}, nil
+}
+
+// FailMigration - переводит выполняющуюся миграцию в состояние failed.
+// Если dirty, то миграция блокирует дальнейшие накаты до ручного разрешения.
+func (ps *postgresStorage) FailMigration(ctx context.Context, migration domain.Migration, dirty bool) error {
+	if ps.db == nil {
+		return errNotConnected
+	}
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET status    = $2,
+		dirty     = $3,
+		update_at = now()
+	WHERE version = $1
+	  AND status = $4;
+`, ps.table())
+	_, err := ps.db.Exec(ctx, query,
+		migration.Version, string(domain.StatusFailed), dirty, string(domain.StatusRunning))
+
+	return err
+}
+
+// ResolveMigration - вручную переводит миграцию в состояние applied или rolled_back и снимает отметку dirty.
+func (ps *postgresStorage) ResolveMigration(ctx context.Context, version uint64, status domain.MigrationStatus) error {
+	if ps.db == nil {
+		return errNotConnected
+	}
+	if status != domain.StatusApplied && status != domain.StatusRolledBack {
+		return fmt.Errorf("%w: %s (allow %s or %s)",
+			domain.ErrInvalidStatus, status, domain.StatusApplied, domain.StatusRolledBack)
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET status     = $2,
+		is_applied = $3,
+		dirty      = FALSE,
+		update_at  = now()
+	WHERE version = $1;
+`, ps.table())
+	tag, err := ps.db.Exec(ctx, query, version, string(status), status == domain.StatusApplied)
+	if err != nil {
+		return err
 	}
 	if tag.RowsAffected() == 0 {
-		return nil, ErrQueryNoAffectRows
+		return fmt.Errorf("%w: version %d", domain.ErrMigrationNotFound, version)
 	}
 
-	return tx, nil
+	return nil
 }
 
-func (ps *postgresStorage) RecentMigration(ctx context.Context) (domain.Migration, error) {
-	if ps.isClosed() {
-		if err := ps.Connect(ctx); err != nil {
-			return domain.Migration{}, err
+// RecordExecution - добавляет запись в журнал выполнения миграций (журнал только пополняется).
+func (ps *postgresStorage) RecordExecution(ctx context.Context, execution domain.Execution) error {
+	if ps.db == nil {
+		return errNotConnected
+	}
+	query := fmt.Sprintf(`
+	INSERT INTO %s (version, name, direction, started_at, finished_at, duration_ms,
+					outcome, error, os_user, db_role, hostname, tool_version)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), $9, current_user, $10, $11);
+`, ps.historyTable())
+	_, err := ps.db.Exec(ctx, query,
+		execution.Version,
+		execution.Name,
+		execution.Direction,
+		execution.StartedAt,
+		execution.FinishedAt,
+		execution.Duration.Milliseconds(),
+		string(execution.Outcome),
+		execution.Error,
+		execution.OSUser,
+		execution.Hostname,
+		execution.ToolVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errRecordExecution, err.Error())
+	}
+
+	return nil
+}
+
+// Executions - возвращает журнал выполнения миграций (всех или одной версии), начиная с последних записей.
+func (ps *postgresStorage) Executions(ctx context.Context, version uint64, limit int) ([]domain.Execution, error) {
+	if ps.db == nil {
+		return nil, errNotConnected
+	}
+	query := fmt.Sprintf(`
+	SELECT id, version, name, direction, started_at, finished_at, duration_ms,
+		   outcome, COALESCE(error, ''), os_user, db_role, hostname, tool_version
+	FROM %s
+	WHERE $1::BIGINT = 0 OR version = $1
+	ORDER BY started_at DESC, id DESC
+	LIMIT NULLIF($2, 0);
+`, ps.historyTable())
+	rows, err := ps.db.Query(ctx, query, version, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var executions []domain.Execution
+	for rows.Next() {
+		var (
+			execution  domain.Execution
+			durationMs int64
+		)
+		if err := rows.Scan(
+			&execution.ID,
+			&execution.Version,
+			&execution.Name,
+			&execution.Direction,
+			&execution.StartedAt,
+			&execution.FinishedAt,
+			&durationMs,
+			&execution.Outcome,
+			&execution.Error,
+			&execution.OSUser,
+			&execution.DBRole,
+			&execution.Hostname,
+			&execution.ToolVersion); err != nil {
+			return nil, err
 		}
+		execution.Duration = time.Duration(durationMs) * time.Millisecond
+		executions = append(executions, execution)
 	}
-	var migration domain.Migration
-	query := `
-	SELECT version, name, is_applied, update_at  
-	FROM "public"."tmigration" 
+
+	return executions, rows.Err()
+}
+
+func (ps *postgresStorage) RecentMigration(ctx context.Context) (domain.Migration, error) {
+	if ps.db == nil {
+		return domain.Migration{}, errNotConnected
+	}
+	var (
+		migration domain.Migration
+		tags      string
+	)
+	query := fmt.Sprintf(`
+	SELECT version, name, is_applied, status, dirty, update_at, COALESCE(checksum, ''), COALESCE(tags, '')  
+	FROM %s 
 	WHERE is_applied = TRUE
 	ORDER BY version DESC 
 	LIMIT 1; 
-`
-	if err := ps.conn.QueryRow(ctx, query).Scan(
+`, ps.table())
+	if err := ps.db.QueryRow(ctx, query).Scan(
 		&migration.Version,
 		&migration.Name,
 		&migration.IsApplied,
-		&migration.UpdateAt); err != nil {
+		&migration.Status,
+		&migration.Dirty,
+		&migration.UpdateAt,
+		&migration.Checksum,
+		&tags); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return migration, ErrNoAppliedMigrations
+		}
+
 		return migration, err
 	}
+	migration.Tags = splitTags(tags)
 
 	return migration, nil
 }
@@ -224,32 +466,38 @@ func (ps *postgresStorage) GetMigrationsByDirection(
 	ctx context.Context,
 	isApplied bool,
 ) (map[uint64]domain.Migration, error) {
-	if ps.isClosed() {
-		if err := ps.Connect(ctx); err != nil {
-			return nil, err
-		}
+	if ps.db == nil {
+		return nil, errNotConnected
 	}
-	query := `
-	SELECT version, name, is_applied, update_at 
-	FROM "public"."tmigration" 
+	query := fmt.Sprintf(`
+	SELECT version, name, is_applied, status, dirty, update_at, COALESCE(checksum, ''), COALESCE(tags, '') 
+	FROM %s 
 	WHERE is_applied = $1
 	ORDER BY version DESC;
-`
-	rows, err := ps.conn.Query(ctx, query, isApplied)
+`, ps.table())
+	rows, err := ps.db.Query(ctx, query, isApplied)
 	if err != nil {
 		return nil, err
 	}
 
 	migrations := make(map[uint64]domain.Migration)
 	for rows.Next() {
-		var migration domain.Migration
+		var (
+			migration domain.Migration
+			tags      string
+		)
 		if err := rows.Scan(
 			&migration.Version,
 			&migration.Name,
 			&migration.IsApplied,
-			&migration.UpdateAt); err != nil {
+			&migration.Status,
+			&migration.Dirty,
+			&migration.UpdateAt,
+			&migration.Checksum,
+			&tags); err != nil {
 			return nil, err
 		}
+		migration.Tags = splitTags(tags)
 		migrations[migration.Version] = migration
 	}
 
@@ -257,31 +505,37 @@ func (ps *postgresStorage) GetMigrationsByDirection(
 }
 
 func (ps *postgresStorage) Stats(ctx context.Context) ([]domain.Migration, error) {
-	if ps.isClosed() {
-		if err := ps.Connect(ctx); err != nil {
-			return nil, err
-		}
+	if ps.db == nil {
+		return nil, errNotConnected
 	}
-	query := `
-	SELECT version, name, is_applied, update_at 
-	FROM "public"."tmigration"
+	query := fmt.Sprintf(`
+	SELECT version, name, is_applied, status, dirty, update_at, COALESCE(checksum, ''), COALESCE(tags, '') 
+	FROM %s
 	ORDER BY version;
-`
-	rows, err := ps.conn.Query(ctx, query)
+`, ps.table())
+	rows, err := ps.db.Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
 
 	var stats []domain.Migration
 	for rows.Next() {
-		var migration domain.Migration
+		var (
+			migration domain.Migration
+			tags      string
+		)
 		if err := rows.Scan(
 			&migration.Version,
 			&migration.Name,
 			&migration.IsApplied,
-			&migration.UpdateAt); err != nil {
+			&migration.Status,
+			&migration.Dirty,
+			&migration.UpdateAt,
+			&migration.Checksum,
+			&tags); err != nil {
 			return nil, err
 		}
+		migration.Tags = splitTags(tags)
 
 		stats = append(stats, migration)
 	}
@@ -289,83 +543,217 @@ func (ps *postgresStorage) Stats(ctx context.Context) ([]domain.Migration, error
 	return stats, nil
 }
 
-func (ps *postgresStorage) Lock(ctx context.Context, uid uint32) error {
-	if ps.isClosed() {
-		if err := ps.Connect(ctx); err != nil {
+// Lock - устанавливает advisory-блокировку, ожидая ее освобождения не дольше timeout.
+// Блокировка сессионная, поэтому при работе через пул под нее выделяется отдельное соединение,
+// которое удерживается до вызова UnLock.
+func (ps *postgresStorage) Lock(ctx context.Context, uid uint32, timeout time.Duration) error {
+	if ps.db == nil {
+		return errNotConnected
+	}
+
+	if ps.pool != nil {
+		poolConn, err := ps.pool.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrLock, err.Error())
+		}
+		if err := ps.tryLock(ctx, poolConn, uid, timeout); err != nil {
+			poolConn.Release()
 			return err
 		}
+		ps.lockConn = poolConn
+		ps.lockUID = uid
+
+		return nil
 	}
-	var isLocked bool
-	if err := ps.conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", uid).Scan(&isLocked); err != nil {
+
+	if err := ps.tryLock(ctx, ps.db, uid, timeout); err != nil {
 		return err
 	}
+	ps.lockUID = uid
+
+	return nil
+}
 
-	if !isLocked {
-		return ErrLock
+// UnLock - снимает advisory-блокировку и возвращает удерживавшее ее соединение в пул.
+func (ps *postgresStorage) UnLock(ctx context.Context) error {
+	if ps.db == nil {
+		return errNotConnected
+	}
+
+	if ps.lockConn != nil {
+		return ps.releaseLockConn(ctx)
+	}
+	if _, err := ps.db.Exec(ctx, "SELECT pg_advisory_unlock($1)", ps.lockUID); err != nil {
+		return err
 	}
 
 	return nil
 }
 
-func (ps *postgresStorage) UnLock(ctx context.Context) error {
-	if ps.isClosed() {
-		if err := ps.Connect(ctx); err != nil {
-			return err
+// releaseLockConn - снимает advisory-блокировку в соединении пула и возвращает его в пул.
+// Если снять блокировку не удалось, соединение закрывается: сессионная блокировка освобождается
+// только вместе с сессией, а соединение в пуле удерживало бы ее и блокировало другие миграторы.
+func (ps *postgresStorage) releaseLockConn(ctx context.Context) error {
+	conn := ps.lockConn
+	ps.lockConn = nil
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", ps.lockUID); err != nil {
+		closeCtx, cancelFunc := context.WithTimeout(context.Background(), connTimeout)
+		defer cancelFunc()
+		if errClose := conn.Hijack().Close(closeCtx); errClose != nil {
+			ps.logger.Error("failed to close connection holding advisory lock", zap.Error(errClose))
 		}
-	}
-	if _, err := ps.conn.Exec(ctx, "SELECT pg_advisory_unlock_all()"); err != nil {
+
 		return err
 	}
+	conn.Release()
 
 	return nil
 }
 
-// provideStorage - создает таблицу для контроля миграций.
-func (ps *postgresStorage) provideStorage(ctx context.Context) error {
-	ok, err := ps.checkStorage(ctx)
-	if err != nil {
-		return fmt.Errorf("%w: %s", errCheckStorage, err.Error())
+// acquireConn - выделяет соединение пула (или возвращает соединение приложения) и функцию его освобождения.
+func (ps *postgresStorage) acquireConn(ctx context.Context) (*pgx.Conn, func(), error) {
+	if ps.pool != nil {
+		poolConn, err := ps.pool.Acquire(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return poolConn.Conn(), poolConn.Release, nil
 	}
+
+	conn, ok := ps.db.(*pgx.Conn)
 	if !ok {
-		query := `
-	CREATE TABLE IF NOT EXISTS "public"."tmigration" (
-	    version BIGINT NOT NULL,
-		name VARCHAR(255) NOT NULL,
-		is_applied BOOLEAN NOT NULL,
-		update_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
-	);
-	CREATE UNIQUE INDEX IF NOT EXISTS uidx_version  ON "public"."tmigration" USING  btree(version);
-	CREATE INDEX IF NOT EXISTS idx_applied_version ON "public"."tmigration" USING btree(is_applied, version);
-`
-		if _, err := ps.conn.Exec(ctx, query); err != nil {
-			return fmt.Errorf("%w: %s", errCreateStorage, err.Error())
+		return nil, nil, errNotConnected
+	}
+
+	return conn, func() {}, nil
+}
+
+// tryLock - пытается установить advisory-блокировку в соединении conn до истечения timeout.
+func (ps *postgresStorage) tryLock(ctx context.Context, conn database, uid uint32, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		var isLocked bool
+		if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", uid).Scan(&isLocked); err != nil {
+			return err
+		}
+
+		if isLocked {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			return ps.lockError(ctx, uid, timeout)
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// provideStorage - создает схему и служебные таблицы мигратора и обновляет их до текущей версии.
+func (ps *postgresStorage) provideStorage(ctx context.Context) error {
+	if err := ps.provideSchema(ctx); err != nil {
+		return fmt.Errorf("%w: %s", errCreateSchema, err.Error())
+	}
+
+	if err := ps.provideMetaStorage(ctx); err != nil {
+		return fmt.Errorf("%w: %s", errUpgradeStorage, err.Error())
+	}
+
+	return nil
+}
+
+// startMigration - переводит миграцию в состояние running (фиксируется сразу, вне транзакции миграции).
+func (ps *postgresStorage) startMigration(ctx context.Context, migration domain.Migration, direction bool) error {
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET status    = $3,
+		dirty     = TRUE,
+		update_at = now()
+	WHERE version = $1
+	  AND is_applied = NOT $2
+	  AND NOT dirty
+	RETURNING version;
+`, ps.table())
+	ctx, cancelFunc := context.WithTimeout(ctx, checkTimeout)
+	defer cancelFunc()
+
+	tag, err := ps.db.Exec(ctx, query, migration.Version, direction, string(domain.StatusRunning))
+	if err != nil {
+		if pgconn.Timeout(err) {
+			return ErrQueryDeadlineExceeded
 		}
+
+		return fmt.Errorf("%w: %s", errBeginMigration, err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrQueryNoAffectRows
 	}
 
 	return nil
 }
 
+// finishMigration - переводит выполняющуюся миграцию в конечное состояние.
+func (ps *postgresStorage) finishMigration(
+	ctx context.Context,
+	exec executor,
+	migration domain.Migration,
+	direction bool,
+) error {
+	status := domain.StatusRolledBack
+	if direction {
+		status = domain.StatusApplied
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET is_applied = $2,
+		status     = $3,
+		dirty      = FALSE,
+		checksum   = CASE WHEN $2 THEN NULLIF($4, '') ELSE checksum END,
+		tags       = CASE WHEN $2 THEN NULLIF($6, '') ELSE tags END,
+		update_at  = now()
+	WHERE version = $1
+	  AND status = $5;
+`, ps.table())
+	tag, err := exec.Exec(ctx, query,
+		migration.Version, direction, string(status), migration.Checksum, string(domain.StatusRunning),
+		joinTags(migration.Tags))
+	if err != nil {
+		return fmt.Errorf("%w: %s", errBeginMigration, err.Error())
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrQueryNoAffectRows
+	}
+
+	return nil
+}
+
+// failStartedMigration - переводит миграцию в состояние failed, если транзакция миграции не была начата.
+func (ps *postgresStorage) failStartedMigration(ctx context.Context, migration domain.Migration) {
+	if err := ps.FailMigration(ctx, migration, false); err != nil {
+		ps.logger.Error("failed to mark migration as failed", zap.Uint64("version", migration.Version), zap.Error(err))
+	}
+}
+
+// provideMigration - добавляет запись о миграции, если ее еще нет.
 func (ps *postgresStorage) provideMigration(ctx context.Context, migration domain.Migration) error {
 	if migration.Name == "" || migration.Version == 0 {
 		return fmt.Errorf("%w: version = '%d', name = '%s'",
 			errVersionOrNameEmpty, migration.Version, migration.Name)
 	}
 
-	query := `
-	DO
-	$func$
-		DECLARE
-			_version BIGINT;
-		BEGIN
-			SELECT version INTO _version FROM tmigration WHERE version = $1;
-			IF NOT FOUND THEN
-				INSERT INTO "public"."tmigration" (version, name, is_applied) VALUES ($1, $2, FALSE);
-				RAISE NOTICE 'New migration record added';
-			END IF;
-		END;
-	$func$;
-`
-	_, err := ps.conn.Exec(ctx, query, migration.Version, migration.Name)
+	// обычный запрос вместо блока DO: параметры в теле DO не поддерживаются расширенным протоколом,
+	// который по умолчанию используют пул и соединение приложения
+	query := fmt.Sprintf(`
+	INSERT INTO %s (version, name, is_applied)
+	VALUES ($1, $2, FALSE)
+	ON CONFLICT (version) DO NOTHING;
+`, ps.table())
+	_, err := ps.db.Exec(ctx, query, migration.Version, migration.Name)
 	if err != nil {
 		return fmt.Errorf("%w: %s", errCreateMigrationRecord, err.Error())
 	}
@@ -373,21 +761,75 @@ func (ps *postgresStorage) provideMigration(ctx context.Context, migration domai
 	return nil
 }
 
-func (ps *postgresStorage) isClosed() bool {
-	return ps.conn == nil || ps.conn.IsClosed()
+// lockError - формирует ошибку блокировки с PID процесса, который ее удерживает.
+func (ps *postgresStorage) lockError(ctx context.Context, uid uint32, timeout time.Duration) error {
+	var pid int32
+	if err := ps.db.QueryRow(ctx, postgresLockHolderQuery, uid).Scan(&pid); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("%w: timed out after %s", ErrLock, timeout)
+		}
+
+		return fmt.Errorf("%w: timed out after %s (%s)", ErrLock, timeout, err.Error())
+	}
+
+	return fmt.Errorf("%w: timed out after %s, the lock is held by backend with pid %d", ErrLock, timeout, pid)
 }
 
-func (ps *postgresStorage) checkStorage(ctx context.Context) (bool, error) {
-	query := `
-	SELECT EXISTS (
-   		SELECT FROM information_schema.tables 
-   		WHERE table_schema = $1 AND table_name = $2
-   );
-`
+// provideSchema - создает схему для таблицы миграций, если ее еще нет.
+func (ps *postgresStorage) provideSchema(ctx context.Context) error {
+	schema, _ := ps.config.MigrationsTable()
 	var ok bool
-	if err := ps.conn.QueryRow(ctx, query, MigrationsScheme, MigrationsTable).Scan(&ok); err != nil {
-		return false, err
+	query := "SELECT EXISTS (SELECT FROM pg_namespace WHERE nspname = $1);"
+	if err := ps.db.QueryRow(ctx, query, schema).Scan(&ok); err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	_, err := ps.db.Exec(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", pgx.Identifier{schema}.Sanitize()))
+
+	return err
+}
+
+// dsnScheme - возвращает схему DSN в нижнем регистре (пустую строку для DSN в формате key=value).
+func dsnScheme(dsn string) string {
+	scheme, _, ok := strings.Cut(dsn, "://")
+	if !ok {
+		return ""
+	}
+
+	return strings.ToLower(scheme)
+}
+
+// historyTableName - возвращает имя таблицы журнала выполнения миграций.
+func (ps *postgresStorage) historyTableName() string {
+	_, table := ps.config.MigrationsTable()
+	return table + historyTableSuffix
+}
+
+// historyTable - возвращает экранированное имя таблицы журнала выполнения миграций вместе со схемой.
+func (ps *postgresStorage) historyTable() string {
+	schema, _ := ps.config.MigrationsTable()
+	return pgx.Identifier{schema, ps.historyTableName()}.Sanitize()
+}
+
+// table - возвращает экранированное имя таблицы миграций вместе со схемой.
+func (ps *postgresStorage) table() string {
+	schema, table := ps.config.MigrationsTable()
+	return pgx.Identifier{schema, table}.Sanitize()
+}
+
+// joinTags - возвращает теги миграции в виде, в котором они хранятся в таблице миграций.
+func joinTags(tags []string) string {
+	return strings.Join(tags, ",")
+}
+
+// splitTags - разбирает теги миграции, сохраненные в таблице миграций.
+func splitTags(tags string) []string {
+	if tags == "" {
+		return nil
 	}
 
-	return ok, nil
+	return strings.Split(tags, ",")
 }
@@ -0,0 +1,384 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"             //nolint:depguard
+	"github.com/jackc/pgx/v4"             //nolint:depguard
+	"github.com/stretchr/testify/assert"  //nolint:depguard
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap/zaptest"             //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/pkg/config" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain" //nolint:depguard
+)
+
+var errFakeNotImplemented = errors.New("not implemented by fake database")
+
+// fakeQuery - запрос, выполненный через fakeDatabase.
+type fakeQuery struct {
+	sql  string
+	args []interface{}
+}
+
+// fakeDatabase - соединение Postgres без сервера: запоминает выполненные запросы
+// и отвечает на QueryRow значениями rows (по первой подстроке, которую содержит запрос).
+// Запросы с параметрами проверяются так же, как в расширенном протоколе, который по умолчанию
+// используют пул и соединение pgx приложения (см. extendedProtocolError).
+type fakeDatabase struct {
+	queries []fakeQuery
+	rows    map[string][]interface{}
+	errs    map[string]error
+}
+
+func (f *fakeDatabase) Exec(_ context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	f.queries = append(f.queries, fakeQuery{sql: sql, args: args})
+	if err := extendedProtocolError(sql, args); err != nil {
+		return nil, err
+	}
+	if err := f.err(sql); err != nil {
+		return nil, err
+	}
+
+	return pgconn.CommandTag("UPDATE 1"), nil
+}
+
+func (f *fakeDatabase) Query(_ context.Context, sql string, args ...interface{}) (pgx.Rows, error) {
+	f.queries = append(f.queries, fakeQuery{sql: sql, args: args})
+	if err := extendedProtocolError(sql, args); err != nil {
+		return nil, err
+	}
+
+	return nil, errFakeNotImplemented
+}
+
+func (f *fakeDatabase) QueryRow(_ context.Context, sql string, args ...interface{}) pgx.Row {
+	f.queries = append(f.queries, fakeQuery{sql: sql, args: args})
+	if err := extendedProtocolError(sql, args); err != nil {
+		return fakeRow{err: err}
+	}
+	if err := f.err(sql); err != nil {
+		return fakeRow{err: err}
+	}
+	for substr, values := range f.rows {
+		if strings.Contains(sql, substr) {
+			return fakeRow{values: values}
+		}
+	}
+
+	return fakeRow{err: pgx.ErrNoRows}
+}
+
+func (f *fakeDatabase) Begin(_ context.Context) (pgx.Tx, error) {
+	f.queries = append(f.queries, fakeQuery{sql: "BEGIN"})
+	return &fakeTx{db: f}, nil
+}
+
+func (f *fakeDatabase) err(sql string) error {
+	for substr, err := range f.errs {
+		if strings.Contains(sql, substr) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var (
+	// dollarQuoted - строки и тела функций в долларовых кавычках ($$...$$, $func$...$func$).
+	dollarQuoted = regexp.MustCompile(`(?s)\$([A-Za-z_]*)\$.*?\$([A-Za-z_]*)\$`)
+	// quoted - строковые литералы.
+	quoted = regexp.MustCompile(`'(?:[^']|'')*'`)
+	// placeholder - параметр запроса $1, $2, ...
+	placeholder = regexp.MustCompile(`\$(\d+)`)
+)
+
+// extendedProtocolError - возвращает ошибку, которую вернул бы Postgres при выполнении запроса с параметрами
+// по расширенному протоколу: такой запрос должен быть одной командой, а параметры внутри строк и тела
+// блока DO не учитываются. Запросы без параметров pgx выполняет по простому протоколу.
+func extendedProtocolError(sql string, args []interface{}) error {
+	if len(args) == 0 {
+		return nil
+	}
+	sql = quoted.ReplaceAllString(dollarQuoted.ReplaceAllString(sql, "''"), "''")
+	if strings.Contains(strings.TrimRight(strings.TrimSpace(sql), ";"), ";") {
+		return errors.New("cannot insert multiple commands into a prepared statement")
+	}
+	var count int
+	for _, match := range placeholder.FindAllStringSubmatch(sql, -1) {
+		if idx, _ := strconv.Atoi(match[1]); idx > count {
+			count = idx
+		}
+	}
+	if count != len(args) {
+		return fmt.Errorf("expected %d arguments, got %d", count, len(args))
+	}
+
+	return nil
+}
+
+// executed - возвращает выполненные запросы, содержащие substr.
+func (f *fakeDatabase) executed(substr string) []fakeQuery {
+	var queries []fakeQuery
+	for _, query := range f.queries {
+		if strings.Contains(query.sql, substr) {
+			queries = append(queries, query)
+		}
+	}
+
+	return queries
+}
+
+// fakeTx - транзакция fakeDatabase, запросы которой запоминаются в том же соединении.
+type fakeTx struct {
+	pgx.Tx
+	db *fakeDatabase
+}
+
+func (tx *fakeTx) Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error) {
+	return tx.db.Exec(ctx, sql, args...)
+}
+
+func (tx *fakeTx) QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row {
+	return tx.db.QueryRow(ctx, sql, args...)
+}
+
+func (tx *fakeTx) Commit(_ context.Context) error {
+	tx.db.queries = append(tx.db.queries, fakeQuery{sql: "COMMIT"})
+	return nil
+}
+
+func (tx *fakeTx) Rollback(_ context.Context) error {
+	tx.db.queries = append(tx.db.queries, fakeQuery{sql: "ROLLBACK"})
+	return nil
+}
+
+// fakeRow - строка результата fakeDatabase.
+type fakeRow struct {
+	values []interface{}
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	if len(dest) != len(r.values) {
+		return errors.New("fake row: wrong number of scan destinations")
+	}
+	for idx := range dest {
+		reflect.ValueOf(dest[idx]).Elem().Set(reflect.ValueOf(r.values[idx]))
+	}
+
+	return nil
+}
+
+func newFakePostgresStorage(t *testing.T, cfg *config.Config, db *fakeDatabase) *postgresStorage {
+	t.Helper()
+	return &postgresStorage{config: cfg, logger: zaptest.NewLogger(t), db: db, external: true}
+}
+
+func TestPostgresStorage_Table(t *testing.T) {
+	tCases := []struct {
+		name         string
+		config       *config.Config
+		table        string
+		historyTable string
+		metaTable    string
+	}{
+		{
+			name:         "defaults",
+			config:       &config.Config{},
+			table:        `"public"."tmigration"`,
+			historyTable: `"public"."tmigration_history"`,
+			metaTable:    `"public"."tmigration_meta"`,
+		},
+		{
+			name:         "custom schema and default name",
+			config:       &config.Config{TableSchema: "migrations"},
+			table:        `"migrations"."tmigration"`,
+			historyTable: `"migrations"."tmigration_history"`,
+			metaTable:    `"migrations"."tmigration_meta"`,
+		},
+		{
+			name:         "custom name and default schema",
+			config:       &config.Config{TableName: "schema_versions"},
+			table:        `"public"."schema_versions"`,
+			historyTable: `"public"."schema_versions_history"`,
+			metaTable:    `"public"."schema_versions_meta"`,
+		},
+		{
+			name:         "quoting",
+			config:       &config.Config{TableSchema: "My Schema", TableName: `odd"name`},
+			table:        `"My Schema"."odd""name"`,
+			historyTable: `"My Schema"."odd""name_history"`,
+			metaTable:    `"My Schema"."odd""name_meta"`,
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			ps := newFakePostgresStorage(t, tCase.config, &fakeDatabase{})
+			assert.Equal(t, tCase.table, ps.table())
+			assert.Equal(t, tCase.historyTable, ps.historyTable())
+			assert.Equal(t, tCase.metaTable, ps.metaTable())
+		})
+	}
+}
+
+func TestPostgresStorage_ProvideSchema(t *testing.T) {
+	ctx := context.Background()
+	tCases := []struct {
+		name   string
+		config *config.Config
+		exists bool
+		schema string
+		create string
+	}{
+		{
+			name:   "default schema exists",
+			config: &config.Config{},
+			exists: true,
+			schema: "public",
+		},
+		{
+			name:   "custom schema exists",
+			config: &config.Config{TableSchema: "migrations"},
+			exists: true,
+			schema: "migrations",
+		},
+		{
+			name:   "custom schema is created",
+			config: &config.Config{TableSchema: `My "Schema"`},
+			schema: `My "Schema"`,
+			create: `CREATE SCHEMA IF NOT EXISTS "My ""Schema""";`,
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			db := &fakeDatabase{rows: map[string][]interface{}{"pg_namespace": {tCase.exists}}}
+			ps := newFakePostgresStorage(t, tCase.config, db)
+			require.NoError(t, ps.provideSchema(ctx))
+
+			exists := db.executed("pg_namespace")
+			require.Len(t, exists, 1)
+			assert.Equal(t, []interface{}{tCase.schema}, exists[0].args)
+
+			create := db.executed("CREATE SCHEMA")
+			if tCase.create == "" {
+				assert.Empty(t, create)
+				return
+			}
+			require.Len(t, create, 1)
+			assert.Equal(t, tCase.create, create[0].sql)
+		})
+	}
+}
+
+func TestPostgresStorage_ExtendedProtocol(t *testing.T) {
+	ctx := context.Background()
+	migration := domain.Migration{Version: 20240101120000, Name: "createUsers", Checksum: "checksum"}
+	tCases := []struct {
+		name string
+		run  func(ps *postgresStorage) error
+		// expectedErr - ошибка fakeDatabase после того, как запрос принят
+		expectedErr error
+	}{
+		{
+			name: "begin migration",
+			run: func(ps *postgresStorage) error {
+				tx, err := ps.BeginTxMigration(ctx, migration, true)
+				if err != nil {
+					return err
+				}
+				return tx.Commit(ctx)
+			},
+		},
+		{
+			name: "fail migration",
+			run: func(ps *postgresStorage) error {
+				return ps.FailMigration(ctx, migration, true)
+			},
+		},
+		{
+			name: "resolve migration",
+			run: func(ps *postgresStorage) error {
+				return ps.ResolveMigration(ctx, migration.Version, domain.StatusApplied)
+			},
+		},
+		{
+			name: "record execution",
+			run: func(ps *postgresStorage) error {
+				return ps.RecordExecution(ctx, domain.Execution{Version: migration.Version, Name: migration.Name})
+			},
+		},
+		{
+			name: "executions",
+			run: func(ps *postgresStorage) error {
+				_, err := ps.Executions(ctx, migration.Version, 10)
+				return err
+			},
+			expectedErr: errFakeNotImplemented,
+		},
+		{
+			name: "migrations by direction",
+			run: func(ps *postgresStorage) error {
+				_, err := ps.GetMigrationsByDirection(ctx, true)
+				return err
+			},
+			expectedErr: errFakeNotImplemented,
+		},
+		{
+			name: "lock and unlock",
+			run: func(ps *postgresStorage) error {
+				if err := ps.Lock(ctx, 42, time.Second); err != nil {
+					return err
+				}
+				return ps.UnLock(ctx)
+			},
+		},
+		{
+			name: "lock holder",
+			run: func(ps *postgresStorage) error {
+				return ps.lockError(ctx, 42, time.Second)
+			},
+			expectedErr: ErrLock,
+		},
+		{
+			name: "provide storage",
+			run: func(ps *postgresStorage) error {
+				return ps.provideStorage(ctx)
+			},
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			db := &fakeDatabase{rows: map[string][]interface{}{
+				"pg_namespace":         {true},
+				"pg_try_advisory_lock": {true},
+				"MAX(version)":         {0},
+			}}
+			ps := newFakePostgresStorage(t, &config.Config{}, db)
+
+			err := tCase.run(ps)
+			if tCase.expectedErr != nil {
+				assert.ErrorIs(t, err, tCase.expectedErr)
+			} else {
+				assert.NoError(t, err)
+			}
+			for _, query := range db.queries {
+				assert.NoError(t, extendedProtocolError(query.sql, query.args), query.sql)
+			}
+		})
+	}
+}
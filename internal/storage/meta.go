@@ -0,0 +1,214 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4" //nolint:depguard
+	"go.uber.org/zap"         //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/util" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/config"    //nolint:depguard
+)
+
+const metaTableSuffix = "_meta"
+
+var errApplyMetaMigration = errors.New("failed to apply meta migration")
+
+// metaMigration - миграция служебных таблиц самого мигратора.
+// Список только дополняется: уже выпущенные мета-миграции изменять нельзя,
+// так как они могли быть применены к базам данных, созданным предыдущими версиями.
+type metaMigration struct {
+	version int
+	name    string
+	query   func(ps *postgresStorage) string
+}
+
+// postgresMetaMigrations - мета-миграции служебных таблиц для Postgres.
+var postgresMetaMigrations = []metaMigration{
+	{
+		version: 1,
+		name:    "create migration table",
+		// таблица могла быть создана версиями мигратора без мета-миграций (с другими именами индексов)
+		query: func(ps *postgresStorage) string {
+			_, tableName := ps.config.MigrationsTable()
+			return fmt.Sprintf(`
+	DO
+	$func$
+		BEGIN
+			IF to_regclass(%[4]s) IS NULL THEN
+				CREATE TABLE %[1]s (
+					version BIGINT NOT NULL,
+					name VARCHAR(255) NOT NULL,
+					is_applied BOOLEAN NOT NULL,
+					update_at TIMESTAMP WITHOUT TIME ZONE NOT NULL DEFAULT now()
+				);
+				CREATE UNIQUE INDEX %[2]s ON %[1]s USING btree(version);
+				CREATE INDEX %[3]s ON %[1]s USING btree(is_applied, version);
+			END IF;
+		END;
+	$func$;
+`,
+				ps.table(),
+				pgx.Identifier{fmt.Sprintf("uidx_%s_version", tableName)}.Sanitize(),
+				pgx.Identifier{fmt.Sprintf("idx_%s_applied_version", tableName)}.Sanitize(),
+				quoteLiteral(ps.table()),
+			)
+		},
+	},
+	{
+		version: 2,
+		name:    "add checksum",
+		query: func(ps *postgresStorage) string {
+			return fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS checksum VARCHAR(64);`, ps.table())
+		},
+	},
+	{
+		version: 3,
+		name:    "add status and dirty marker",
+		query: func(ps *postgresStorage) string {
+			return fmt.Sprintf(`
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS status VARCHAR(16) NOT NULL DEFAULT 'pending';
+	ALTER TABLE %[1]s ADD COLUMN IF NOT EXISTS dirty BOOLEAN NOT NULL DEFAULT FALSE;
+	UPDATE %[1]s SET status = 'applied' WHERE is_applied AND status = 'pending';
+`, ps.table())
+		},
+	},
+	{
+		version: 4,
+		name:    "create history table",
+		query: func(ps *postgresStorage) string {
+			return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id BIGSERIAL PRIMARY KEY,
+		version BIGINT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		direction VARCHAR(4) NOT NULL,
+		started_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		finished_at TIMESTAMP WITH TIME ZONE NOT NULL,
+		duration_ms BIGINT NOT NULL,
+		outcome VARCHAR(16) NOT NULL,
+		error TEXT,
+		os_user VARCHAR(255) NOT NULL,
+		db_role VARCHAR(255) NOT NULL,
+		hostname VARCHAR(255) NOT NULL,
+		tool_version VARCHAR(64) NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s USING btree(version, started_at);
+`,
+				ps.historyTable(),
+				pgx.Identifier{fmt.Sprintf("idx_%s_version_started", ps.historyTableName())}.Sanitize(),
+			)
+		},
+	},
+	{
+		version: 5,
+		name:    "move update_at to timestamptz",
+		// старые значения записывались через localtimestamp, поэтому интерпретируются в часовом поясе сессии
+		query: func(ps *postgresStorage) string {
+			return fmt.Sprintf(`
+	ALTER TABLE %s
+		ALTER COLUMN update_at TYPE TIMESTAMP WITH TIME ZONE,
+		ALTER COLUMN update_at SET DEFAULT now();
+`, ps.table())
+		},
+	},
+	{
+		version: 6,
+		name:    "create repeatable table",
+		query: func(ps *postgresStorage) string {
+			return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		name VARCHAR(255) NOT NULL PRIMARY KEY,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	);
+`, ps.repeatableTable())
+		},
+	},
+	{
+		version: 7,
+		name:    "add tags",
+		query: func(ps *postgresStorage) string {
+			return fmt.Sprintf(`ALTER TABLE %s ADD COLUMN IF NOT EXISTS tags TEXT;`, ps.table())
+		},
+	},
+}
+
+// provideMetaStorage - создает таблицу версий служебных таблиц и применяет недостающие мета-миграции.
+// Мета-миграции выполняются в одной транзакции под advisory-блокировкой,
+// поэтому одновременно запущенные миграторы не обновляют служебные таблицы параллельно.
+func (ps *postgresStorage) provideMetaStorage(ctx context.Context) error {
+	query := fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		tool_version VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	);
+`, ps.metaTable())
+	if _, err := ps.db.Exec(ctx, query); err != nil {
+		return err
+	}
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%w, %s", errStartTransaction, err.Error())
+	}
+	defer func() {
+		_ = tx.Rollback(ctx)
+	}()
+
+	schema, _ := ps.config.MigrationsTable()
+	uid := util.GenerateUID(ps.metaTableName(), schema)
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", uid); err != nil {
+		return err
+	}
+
+	var current int
+	if err := tx.QueryRow(ctx, fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s;", ps.metaTable())).
+		Scan(&current); err != nil {
+		return err
+	}
+
+	latest := postgresMetaMigrations[len(postgresMetaMigrations)-1].version
+	if current > latest {
+		ps.logger.Warn("migration tables were upgraded by a newer version of the migrator",
+			zap.Int("metaVersion", current), zap.Int("supportedMetaVersion", latest))
+	}
+
+	for _, meta := range postgresMetaMigrations {
+		if meta.version <= current {
+			continue
+		}
+		if _, err := tx.Exec(ctx, meta.query(ps)); err != nil {
+			return fmt.Errorf("%w %d (%s): %s", errApplyMetaMigration, meta.version, meta.name, err.Error())
+		}
+		insert := fmt.Sprintf("INSERT INTO %s (version, name, tool_version) VALUES ($1, $2, $3);", ps.metaTable())
+		if _, err := tx.Exec(ctx, insert, meta.version, meta.name, config.AppVersion); err != nil {
+			return fmt.Errorf("%w %d (%s): %s", errApplyMetaMigration, meta.version, meta.name, err.Error())
+		}
+		ps.logger.Info("meta migration applied", zap.Int("version", meta.version), zap.String("name", meta.name))
+	}
+
+	return tx.Commit(ctx)
+}
+
+// metaTableName - возвращает имя таблицы версий служебных таблиц.
+func (ps *postgresStorage) metaTableName() string {
+	_, table := ps.config.MigrationsTable()
+	return table + metaTableSuffix
+}
+
+// metaTable - возвращает экранированное имя таблицы версий служебных таблиц вместе со схемой.
+func (ps *postgresStorage) metaTable() string {
+	schema, _ := ps.config.MigrationsTable()
+	return pgx.Identifier{schema, ps.metaTableName()}.Sanitize()
+}
+
+// quoteLiteral - экранирует строку для использования в качестве строкового литерала SQL.
+func quoteLiteral(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
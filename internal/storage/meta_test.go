@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"  //nolint:depguard
+	"github.com/stretchr/testify/require" //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/util" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/config"    //nolint:depguard
+)
+
+func TestPostgresStorage_ProvideMetaStorage(t *testing.T) {
+	ctx := context.Background()
+	latest := postgresMetaMigrations[len(postgresMetaMigrations)-1].version
+	tCases := []struct {
+		name     string
+		current  int
+		applied  []int
+		timezone bool
+	}{
+		{
+			name:     "fresh meta table",
+			current:  0,
+			applied:  []int{1, 2, 3, 4, 5, 6, 7},
+			timezone: true,
+		},
+		{
+			name:     "partially migrated meta table",
+			current:  3,
+			applied:  []int{4, 5, 6, 7},
+			timezone: true,
+		},
+		{
+			name:    "update_at already moved to timestamptz",
+			current: 5,
+			applied: []int{6, 7},
+		},
+		{
+			name:    "up to date",
+			current: latest,
+		},
+		{
+			name:    "upgraded by a newer migrator",
+			current: latest + 1,
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			db := &fakeDatabase{rows: map[string][]interface{}{"MAX(version)": {tCase.current}}}
+			ps := newFakePostgresStorage(t, &config.Config{TableSchema: "migrations"}, db)
+			require.NoError(t, ps.provideMetaStorage(ctx))
+
+			create := db.executed(`CREATE TABLE IF NOT EXISTS "migrations"."tmigration_meta"`)
+			require.Len(t, create, 1)
+			assert.Equal(t, create[0], db.queries[0], "meta table is created before the transaction")
+
+			// мета-миграции выполняются под блокировкой в транзакции
+			lock := db.executed("pg_advisory_xact_lock")
+			require.Len(t, lock, 1)
+			assert.Equal(t, []interface{}{util.GenerateUID("tmigration_meta", "migrations")}, lock[0].args)
+			assert.Equal(t, "BEGIN", db.queries[1].sql)
+			assert.Equal(t, lock[0], db.queries[2])
+			assert.Len(t, db.executed("COMMIT"), 1)
+
+			var applied []int
+			for _, insert := range db.executed(`INSERT INTO "migrations"."tmigration_meta"`) {
+				applied = append(applied, insert.args[0].(int))
+				assert.Equal(t, config.AppVersion, insert.args[2])
+			}
+			assert.Equal(t, tCase.applied, applied)
+
+			timezone := db.executed("ALTER COLUMN update_at TYPE TIMESTAMP WITH TIME ZONE")
+			if tCase.timezone {
+				require.Len(t, timezone, 1)
+				assert.Contains(t, timezone[0].sql, `"migrations"."tmigration"`)
+			} else {
+				assert.Empty(t, timezone)
+			}
+		})
+	}
+}
+
+func TestPostgresStorage_ProvideMetaStorage_Failed(t *testing.T) {
+	ctx := context.Background()
+	db := &fakeDatabase{
+		rows: map[string][]interface{}{"MAX(version)": {4}},
+		errs: map[string]error{"ALTER COLUMN update_at": errors.New("cannot alter type")},
+	}
+	ps := newFakePostgresStorage(t, &config.Config{}, db)
+
+	err := ps.provideMetaStorage(ctx)
+	require.ErrorIs(t, err, errApplyMetaMigration)
+	assert.Contains(t, err.Error(), "5 (move update_at to timestamptz)")
+
+	// транзакция откатывается, следующие мета-миграции не выполняются
+	assert.Empty(t, db.executed(`INSERT INTO "public"."tmigration_meta"`))
+	assert.Empty(t, db.executed(ps.repeatableTable()))
+	assert.Empty(t, db.executed("COMMIT"))
+	assert.Len(t, db.executed("ROLLBACK"), 1)
+}
@@ -2,11 +2,11 @@ package storage
 
 import (
 	context "context"
+	time "time"
 
-	domain "github.com/BashMS/SQL_migrator/pkg/domain" //nolint:depguard
-	mock "github.com/stretchr/testify/mock"            //nolint:depguard
-
-	pgx "github.com/jackc/pgx/v4" //nolint:depguard
+	splitter "github.com/BashMS/SQL_migrator/internal/splitter" //nolint:depguard
+	domain "github.com/BashMS/SQL_migrator/pkg/domain"          //nolint:depguard
+	mock "github.com/stretchr/testify/mock"                     //nolint:depguard
 )
 
 // MockMigrateStorage is an autogenerated mock type for the MigrateStorage type.
@@ -14,19 +14,44 @@ type MockMigrateStorage struct {
 	mock.Mock
 }
 
+// BeginNoTxMigration provides a mock function with given fields: ctx, migration, direction.
+func (_m *MockMigrateStorage) BeginNoTxMigration(
+	ctx context.Context,
+	migration domain.Migration,
+	direction bool,
+) (Tx, error) {
+	ret := _m.Called(ctx, migration, direction)
+
+	var r0 Tx
+	if rf, ok := ret.Get(0).(func(context.Context, domain.Migration, bool) Tx); ok {
+		r0 = rf(ctx, migration, direction)
+	} else if ret.Get(0) != nil {
+		r0 = ret.Get(0).(Tx)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, domain.Migration, bool) error); ok {
+		r1 = rf(ctx, migration, direction)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // BeginTxMigration provides a mock function with given fields: ctx, migration, direction.
 func (_m *MockMigrateStorage) BeginTxMigration(
 	ctx context.Context,
 	migration domain.Migration,
 	direction bool,
-) (pgx.Tx, error) {
+) (Tx, error) {
 	ret := _m.Called(ctx, migration, direction)
 
-	var r0 pgx.Tx
-	if rf, ok := ret.Get(0).(func(context.Context, domain.Migration, bool) pgx.Tx); ok {
+	var r0 Tx
+	if rf, ok := ret.Get(0).(func(context.Context, domain.Migration, bool) Tx); ok {
 		r0 = rf(ctx, migration, direction)
 	} else if ret.Get(0) != nil {
-		r0 = ret.Get(0).(pgx.Tx)
+		r0 = ret.Get(0).(Tx)
 	}
 
 	var r1 error
@@ -39,6 +64,30 @@ func (_m *MockMigrateStorage) BeginTxMigration(
 	return r0, r1
 }
 
+// BeginTxRepeatableMigration provides a mock function with given fields: ctx, migration.
+func (_m *MockMigrateStorage) BeginTxRepeatableMigration(
+	ctx context.Context,
+	migration domain.RepeatableMigration,
+) (Tx, error) {
+	ret := _m.Called(ctx, migration)
+
+	var r0 Tx
+	if rf, ok := ret.Get(0).(func(context.Context, domain.RepeatableMigration) Tx); ok {
+		r0 = rf(ctx, migration)
+	} else if ret.Get(0) != nil {
+		r0 = ret.Get(0).(Tx)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, domain.RepeatableMigration) error); ok {
+		r1 = rf(ctx, migration)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Close provides a mock function with given fields.
 func (_m *MockMigrateStorage) Close() {
 	_m.Called()
@@ -58,27 +107,41 @@ func (_m *MockMigrateStorage) Connect(ctx context.Context) error {
 	return r0
 }
 
-// GetConnection provides a mock function with given fields: ctx.
-func (_m *MockMigrateStorage) GetConnection(ctx context.Context) (*pgx.Conn, error) {
-	ret := _m.Called(ctx)
+// Executions provides a mock function with given fields: ctx, version, limit.
+func (_m *MockMigrateStorage) Executions(ctx context.Context, version uint64, limit int) ([]domain.Execution, error) {
+	ret := _m.Called(ctx, version, limit)
 
-	var r0 *pgx.Conn
-	if rf, ok := ret.Get(0).(func(context.Context) *pgx.Conn); ok {
-		r0 = rf(ctx)
+	var r0 []domain.Execution
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, int) []domain.Execution); ok {
+		r0 = rf(ctx, version, limit)
 	} else if ret.Get(0) != nil {
-		r0 = ret.Get(0).(*pgx.Conn)
+		r0 = ret.Get(0).([]domain.Execution)
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
-		r1 = rf(ctx)
-	} else if ret.Get(1) != nil {
+	if rf, ok := ret.Get(1).(func(context.Context, uint64, int) error); ok {
+		r1 = rf(ctx, version, limit)
+	} else {
 		r1 = ret.Error(1)
 	}
 
 	return r0, r1
 }
 
+// FailMigration provides a mock function with given fields: ctx, migration, dirty.
+func (_m *MockMigrateStorage) FailMigration(ctx context.Context, migration domain.Migration, dirty bool) error {
+	ret := _m.Called(ctx, migration, dirty)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, domain.Migration, bool) error); ok {
+		r0 = rf(ctx, migration, dirty)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // GetMigrationsByDirection provides a mock function with given fields: ctx, isApplied.
 func (_m *MockMigrateStorage) GetMigrationsByDirection(
 	ctx context.Context,
@@ -103,13 +166,13 @@ func (_m *MockMigrateStorage) GetMigrationsByDirection(
 	return r0, r1
 }
 
-// Lock provides a mock function with given fields: ctx, uid.
-func (_m *MockMigrateStorage) Lock(ctx context.Context, uid uint32) error {
-	ret := _m.Called(ctx, uid)
+// Lock provides a mock function with given fields: ctx, uid, timeout.
+func (_m *MockMigrateStorage) Lock(ctx context.Context, uid uint32, timeout time.Duration) error {
+	ret := _m.Called(ctx, uid, timeout)
 
 	var r0 error
-	if rf, ok := ret.Get(0).(func(context.Context, uint32) error); ok {
-		r0 = rf(ctx, uid)
+	if rf, ok := ret.Get(0).(func(context.Context, uint32, time.Duration) error); ok {
+		r0 = rf(ctx, uid, timeout)
 	} else {
 		r0 = ret.Error(0)
 	}
@@ -138,6 +201,59 @@ func (_m *MockMigrateStorage) RecentMigration(ctx context.Context) (domain.Migra
 	return r0, r1
 }
 
+// RecordExecution provides a mock function with given fields: ctx, execution.
+func (_m *MockMigrateStorage) RecordExecution(ctx context.Context, execution domain.Execution) error {
+	ret := _m.Called(ctx, execution)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, domain.Execution) error); ok {
+		r0 = rf(ctx, execution)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// RepeatableMigrations provides a mock function with given fields: ctx.
+func (_m *MockMigrateStorage) RepeatableMigrations(ctx context.Context) ([]domain.RepeatableMigration, error) {
+	ret := _m.Called(ctx)
+
+	var r0 []domain.RepeatableMigration
+	if rf, ok := ret.Get(0).(func(context.Context) []domain.RepeatableMigration); ok {
+		r0 = rf(ctx)
+	} else if ret.Get(0) != nil {
+		r0 = ret.Get(0).([]domain.RepeatableMigration)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
+// ResolveMigration provides a mock function with given fields: ctx, version, status.
+func (_m *MockMigrateStorage) ResolveMigration(
+	ctx context.Context,
+	version uint64,
+	status domain.MigrationStatus,
+) error {
+	ret := _m.Called(ctx, version, status)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, uint64, domain.MigrationStatus) error); ok {
+		r0 = rf(ctx, version, status)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // Stats provides a mock function with given fields: ctx.
 func (_m *MockMigrateStorage) Stats(ctx context.Context) ([]domain.Migration, error) {
 	ret := _m.Called(ctx)
@@ -172,3 +288,17 @@ func (_m *MockMigrateStorage) UnLock(ctx context.Context) error {
 
 	return r0
 }
+
+// SplitOptions provides a mock function with given fields.
+func (_m *MockMigrateStorage) SplitOptions() splitter.Options {
+	ret := _m.Called()
+
+	var r0 splitter.Options
+	if rf, ok := ret.Get(0).(func() splitter.Options); ok {
+		r0 = rf()
+	} else {
+		r0 = ret.Get(0).(splitter.Options)
+	}
+
+	return r0
+}
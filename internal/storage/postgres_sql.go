@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v4" //nolint:depguard
+	// драйвер database/sql "pgx" для хранилища, открываемого по DSN
+	_ "github.com/jackc/pgx/v4/stdlib" //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/splitter" //nolint:depguard
+)
+
+// postgresLockHolderQuery - запрос PID процесса, удерживающего advisory-блокировку.
+const postgresLockHolderQuery = `
+	SELECT pid
+	FROM pg_locks
+	WHERE locktype = 'advisory'
+	  AND classid = 0
+	  AND objid::BIGINT = $1::BIGINT
+	  AND objsubid = 1
+	  AND granted
+	LIMIT 1;
+`
+
+// postgresDialect - диалект Postgres для хранилища поверх database/sql (lib/pq, pgx/stdlib и др.).
+// Служебные таблицы и блокировки совпадают с хранилищем поверх pgx, поэтому их можно использовать вперемешку.
+type postgresDialect struct{}
+
+// driverName - драйвер pgx/stdlib, если хранилище открывается по DSN.
+func (postgresDialect) driverName() string {
+	return "pgx"
+}
+
+func (postgresDialect) dataSource(dsn string) (string, error) {
+	return dsn, nil
+}
+
+func (postgresDialect) table(schema, name string) string {
+	return pgx.Identifier{schema, name}.Sanitize()
+}
+
+func (postgresDialect) quoteIdent(name string) string {
+	return pgx.Identifier{name}.Sanitize()
+}
+
+// rebind - заменяет плейсхолдеры ? на $1, $2, ... (кроме знаков ? в строках, комментариях и операторах jsonb).
+func (postgresDialect) rebind(query string) string {
+	return splitter.Rebind(query, func(index int) string {
+		return "$" + strconv.Itoa(index)
+	})
+}
+
+func (postgresDialect) now() string {
+	return "now()"
+}
+
+func (postgresDialect) currentRole() string {
+	return "current_user"
+}
+
+func (postgresDialect) insertMigration(table string) string {
+	return fmt.Sprintf(
+		"INSERT INTO %s (version, name, is_applied) VALUES (?, ?, FALSE) ON CONFLICT (version) DO NOTHING;", table)
+}
+
+func (postgresDialect) transactionalDDL() bool {
+	return true
+}
+
+func (postgresDialect) splitOptions() splitter.Options {
+	return splitter.Options{}
+}
+
+func (postgresDialect) createMetaTable(table string) string {
+	return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		tool_version VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+	);
+`, table)
+}
+
+func (postgresDialect) provideSchema(ctx context.Context, db *sql.DB, schema string) error {
+	var ok bool
+	query := "SELECT EXISTS (SELECT FROM pg_namespace WHERE nspname = $1);"
+	if err := db.QueryRowContext(ctx, query, schema).Scan(&ok); err != nil {
+		return err
+	}
+	if ok {
+		return nil
+	}
+
+	_, err := db.ExecContext(ctx, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s;", pgx.Identifier{schema}.Sanitize()))
+
+	return err
+}
+
+// metaMigrations - те же мета-миграции, что и у хранилища поверх pgx.
+func (postgresDialect) metaMigrations() []sqlMetaMigration {
+	metaMigrations := make([]sqlMetaMigration, 0, len(postgresMetaMigrations))
+	for _, meta := range postgresMetaMigrations {
+		query := meta.query
+		metaMigrations = append(metaMigrations, sqlMetaMigration{
+			version: meta.version,
+			name:    meta.name,
+			query: func(ss *sqlStorage) string {
+				return query(&postgresStorage{config: ss.config})
+			},
+		})
+	}
+
+	return metaMigrations
+}
+
+// lock - устанавливает advisory-блокировку, ожидая ее освобождения не дольше timeout.
+func (postgresDialect) lock(ctx context.Context, conn *sql.Conn, uid uint32, timeout time.Duration) error {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		var isLocked bool
+		if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", uid).Scan(&isLocked); err != nil {
+			return err
+		}
+
+		if isLocked {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			var pid int32
+			if err := conn.QueryRowContext(ctx, postgresLockHolderQuery, uid).Scan(&pid); err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return fmt.Errorf("%w: timed out after %s", ErrLock, timeout)
+				}
+
+				return fmt.Errorf("%w: timed out after %s (%s)", ErrLock, timeout, err.Error())
+			}
+
+			return fmt.Errorf("%w: timed out after %s, the lock is held by backend with pid %d", ErrLock, timeout, pid)
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+func (postgresDialect) unlock(ctx context.Context, conn *sql.Conn, uid uint32) error {
+	_, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", uid)
+
+	return err
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/jackc/pgx/v4" //nolint:depguard
+	"go.uber.org/zap"         //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/pkg/domain" //nolint:depguard
+)
+
+const repeatableTableSuffix = "_repeatable"
+
+// RepeatableMigrations - возвращает накатанные повторяемые миграции, отсортированные по имени.
+func (ps *postgresStorage) RepeatableMigrations(ctx context.Context) ([]domain.RepeatableMigration, error) {
+	if ps.db == nil {
+		return nil, errNotConnected
+	}
+	query := fmt.Sprintf(`
+	SELECT name, checksum, applied_at
+	FROM %s
+	ORDER BY name;
+`, ps.repeatableTable())
+	rows, err := ps.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var migrations []domain.RepeatableMigration
+	for rows.Next() {
+		migration := domain.RepeatableMigration{Status: domain.StatusApplied}
+		if err := rows.Scan(&migration.Name, &migration.Checksum, &migration.AppliedAt); err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration)
+	}
+
+	return migrations, rows.Err()
+}
+
+// BeginTxRepeatableMigration - открывает транзакцию повторяемой миграции, в которой уже записана
+// ее новая контрольная сумма. Если транзакция не будет зафиксирована, миграция накатится при следующем запуске.
+func (ps *postgresStorage) BeginTxRepeatableMigration(
+	ctx context.Context,
+	migration domain.RepeatableMigration,
+) (Tx, error) {
+	if ps.db == nil {
+		return nil, errNotConnected
+	}
+	if migration.Name == "" {
+		return nil, fmt.Errorf("%w: name = '%s'", errVersionOrNameEmpty, migration.Name)
+	}
+
+	tx, err := ps.db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %s", errStartTransaction, err.Error())
+	}
+
+	query := fmt.Sprintf(`
+	INSERT INTO %s (name, checksum, applied_at)
+	VALUES ($1, $2, now())
+	ON CONFLICT (name) DO UPDATE
+	SET checksum   = excluded.checksum,
+		applied_at = excluded.applied_at;
+`, ps.repeatableTable())
+	if _, err := tx.Exec(ctx, query, migration.Name, migration.Checksum); err != nil {
+		if errRollback := tx.Rollback(ctx); errRollback != nil {
+			ps.logger.Error("failed to rollback migration transaction", zap.Error(errRollback))
+		}
+
+		return nil, fmt.Errorf("%w: %s", errBeginMigration, err.Error())
+	}
+
+	return NewPgxTx(tx), nil
+}
+
+// repeatableTableName - возвращает имя таблицы повторяемых миграций.
+func (ps *postgresStorage) repeatableTableName() string {
+	_, table := ps.config.MigrationsTable()
+	return table + repeatableTableSuffix
+}
+
+// repeatableTable - возвращает экранированное имя таблицы повторяемых миграций вместе со схемой.
+func (ps *postgresStorage) repeatableTable() string {
+	schema, _ := ps.config.MigrationsTable()
+	return pgx.Identifier{schema, ps.repeatableTableName()}.Sanitize()
+}
+
+// RepeatableMigrations - возвращает накатанные повторяемые миграции, отсортированные по имени.
+func (ss *sqlStorage) RepeatableMigrations(ctx context.Context) ([]domain.RepeatableMigration, error) {
+	if ss.db == nil {
+		return nil, errNotConnected
+	}
+	query := fmt.Sprintf(`
+	SELECT name, checksum, applied_at
+	FROM %s
+	ORDER BY name;
+`, ss.repeatableTable())
+	rows, err := ss.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var migrations []domain.RepeatableMigration
+	for rows.Next() {
+		migration := domain.RepeatableMigration{Status: domain.StatusApplied}
+		if err := rows.Scan(&migration.Name, &migration.Checksum, &migration.AppliedAt); err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration)
+	}
+
+	return migrations, rows.Err()
+}
+
+// BeginTxRepeatableMigration - открывает транзакцию повторяемой миграции.
+// Новая контрольная сумма записывается в этой же транзакции перед ее фиксацией.
+func (ss *sqlStorage) BeginTxRepeatableMigration(
+	ctx context.Context,
+	migration domain.RepeatableMigration,
+) (Tx, error) {
+	if ss.db == nil {
+		return nil, errNotConnected
+	}
+	if migration.Name == "" {
+		return nil, fmt.Errorf("%w: name = '%s'", errVersionOrNameEmpty, migration.Name)
+	}
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w, %s", errStartTransaction, err.Error())
+	}
+
+	return &sqlTx{
+		tx: tx,
+		beforeCommit: func(ctx context.Context, tx *sql.Tx) error {
+			// удаление и вставка вместо upsert, синтаксис которого у каждой СУБД свой
+			deleteQuery := fmt.Sprintf("DELETE FROM %s WHERE name = ?;", ss.repeatableTable())
+			if _, err := tx.ExecContext(ctx, ss.dialect.rebind(deleteQuery), migration.Name); err != nil {
+				return err
+			}
+			insertQuery := fmt.Sprintf("INSERT INTO %s (name, checksum, applied_at) VALUES (?, ?, %s);",
+				ss.repeatableTable(), ss.dialect.now())
+			_, err := tx.ExecContext(ctx, ss.dialect.rebind(insertQuery), migration.Name, migration.Checksum)
+
+			return err
+		},
+	}, nil
+}
+
+// repeatableTableName - возвращает имя таблицы повторяемых миграций.
+func (ss *sqlStorage) repeatableTableName() string {
+	_, table := ss.config.MigrationsTable()
+	return table + repeatableTableSuffix
+}
+
+// repeatableTable - возвращает экранированное имя таблицы повторяемых миграций вместе со схемой.
+func (ss *sqlStorage) repeatableTable() string {
+	schema, _ := ss.config.MigrationsTable()
+	return ss.dialect.table(schema, ss.repeatableTableName())
+}
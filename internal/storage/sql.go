@@ -0,0 +1,754 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap" //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/splitter" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/util"     //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/config"        //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"        //nolint:depguard
+)
+
+// dialect - особенности СУБД для хранилища поверх database/sql.
+type dialect interface {
+	// driverName - имя драйвера database/sql.
+	driverName() string
+	// dataSource - преобразует строку подключения мигратора в строку подключения драйвера.
+	dataSource(dsn string) (string, error)
+	// table - возвращает экранированное имя таблицы вместе со схемой.
+	table(schema, name string) string
+	// quoteIdent - экранирует идентификатор.
+	quoteIdent(name string) string
+	// rebind - заменяет плейсхолдеры ? на плейсхолдеры драйвера.
+	rebind(query string) string
+	// now - SQL-выражение текущего времени.
+	now() string
+	// currentRole - SQL-выражение текущего пользователя БД.
+	currentRole() string
+	// insertMigration - запрос добавления записи о миграции, если ее еще нет (параметры: версия, имя).
+	insertMigration(table string) string
+	// transactionalDDL - DDL выполняется в транзакции и отменяется вместе с ней.
+	transactionalDDL() bool
+	// splitOptions - параметры разбора sql-миграций на запросы (экранирование и комментарии СУБД).
+	splitOptions() splitter.Options
+	// createMetaTable - запрос создания таблицы версий служебных таблиц, если ее еще нет.
+	createMetaTable(table string) string
+	// provideSchema - создает схему для таблицы миграций, если ее еще нет.
+	provideSchema(ctx context.Context, db *sql.DB, schema string) error
+	// metaMigrations - мета-миграции служебных таблиц.
+	metaMigrations() []sqlMetaMigration
+	// lock - устанавливает сессионную блокировку в соединении conn, ожидая ее не дольше timeout.
+	lock(ctx context.Context, conn *sql.Conn, uid uint32, timeout time.Duration) error
+	// unlock - снимает блокировку, установленную в соединении conn.
+	unlock(ctx context.Context, conn *sql.Conn, uid uint32) error
+}
+
+// sqlMetaMigration - мета-миграция служебных таблиц для хранилища поверх database/sql.
+type sqlMetaMigration struct {
+	version int
+	name    string
+	query   func(ss *sqlStorage) string
+}
+
+// createMetaTable - таблица версий служебных таблиц, общая для MySQL и SQLite.
+func createMetaTable(table string) string {
+	return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		version INTEGER NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		tool_version VARCHAR(64) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+`, table)
+}
+
+// sqlExecutor - соединение или транзакция database/sql.
+type sqlExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// sqlStorage - слой для работы с БД через database/sql.
+type sqlStorage struct {
+	config  *config.Config
+	logger  *zap.Logger
+	dialect dialect
+	db      *sql.DB
+	// external - пул соединений передан приложением, хранилище его не закрывает.
+	external bool
+	// lockConn - соединение, удерживающее блокировку до вызова UnLock.
+	lockConn *sql.Conn
+	lockUID  uint32
+}
+
+func newSQLStorage(logger *zap.Logger, config *config.Config, dialect dialect) MigrateStorage {
+	return &sqlStorage{
+		config:  config,
+		logger:  logger,
+		dialect: dialect,
+	}
+}
+
+// NewStorageWithDB - хранилище поверх пула соединений database/sql приложения.
+// dialectName - СУБД, к которой подключен пул: postgres, mysql или sqlite.
+func NewStorageWithDB(logger *zap.Logger, config *config.Config, db *sql.DB, dialectName string) MigrateStorage {
+	return &sqlStorage{
+		config:   config,
+		logger:   logger,
+		dialect:  dialectByName(dialectName),
+		db:       db,
+		external: true,
+	}
+}
+
+// dialectByName - возвращает диалект по имени СУБД или nil, если СУБД не поддерживается.
+func dialectByName(name string) dialect {
+	switch strings.ToLower(name) {
+	case schemePostgres, schemePostgreSQL:
+		return postgresDialect{}
+	case schemeMySQL, schemeMariaDB:
+		return mysqlDialect{}
+	case schemeSQLite:
+		return newSQLiteDialect()
+	default:
+		return nil
+	}
+}
+
+// Connect открывает пул соединений с БД и подготавливает служебные таблицы.
+// Если пул передан приложением, то только подготавливает служебные таблицы.
+func (ss *sqlStorage) Connect(ctx context.Context) error {
+	if ss.dialect == nil {
+		return errUnknownDialect
+	}
+	if ss.external {
+		return ss.provideStorage(ctx)
+	}
+	if ss.db != nil {
+		return nil
+	}
+	if ss.config.DSN == "" {
+		return errDNSEmpty
+	}
+
+	dataSource, err := ss.dialect.dataSource(ss.config.DSN)
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open(ss.dialect.driverName(), dataSource)
+	if err != nil {
+		return err
+	}
+
+	connCtx, cancelFunc := context.WithTimeout(ctx, connTimeout)
+	defer cancelFunc()
+	if err := db.PingContext(connCtx); err != nil {
+		_ = db.Close()
+		return err
+	}
+	ss.db = db
+
+	if err := ss.provideStorage(ctx); err != nil {
+		ss.Close()
+		return err
+	}
+
+	return nil
+}
+
+// SplitOptions - параметры разбора sql-миграций на запросы по диалекту хранилища.
+func (ss *sqlStorage) SplitOptions() splitter.Options {
+	return ss.dialect.splitOptions()
+}
+
+// Close снимает не снятую блокировку и закрывает собственный пул соединений.
+func (ss *sqlStorage) Close() {
+	if ss.lockConn != nil {
+		ctx, cancelFunc := context.WithTimeout(context.Background(), connTimeout)
+		if err := ss.releaseLockConn(ctx); err != nil {
+			ss.logger.Error("failed to release migration lock", zap.Error(err))
+		}
+		cancelFunc()
+	}
+	if ss.external || ss.db == nil {
+		return
+	}
+
+	if err := ss.db.Close(); err != nil {
+		ss.logger.Error("failed to close sqlStorage connection correctly", zap.Error(err))
+	}
+	ss.db = nil
+}
+
+// BeginTxMigration - переводит миграцию в состояние running и открывает транзакцию.
+// Конечное состояние (applied или rolled_back) записывается в этой же транзакции перед ее фиксацией,
+// поэтому для СУБД, фиксирующих DDL неявно, миграция не считается выполненной до успешного завершения.
+func (ss *sqlStorage) BeginTxMigration(
+	ctx context.Context,
+	migration domain.Migration,
+	direction bool,
+) (Tx, error) {
+	if ss.db == nil {
+		return nil, errNotConnected
+	}
+	if err := ss.provideMigration(ctx, migration); err != nil {
+		return nil, err
+	}
+	if err := ss.startMigration(ctx, migration, direction); err != nil {
+		return nil, err
+	}
+
+	tx, err := ss.db.BeginTx(ctx, nil)
+	if err != nil {
+		ss.failStartedMigration(ctx, migration)
+		return nil, fmt.Errorf("%w, %s", errStartTransaction, err.Error())
+	}
+
+	return &sqlTx{
+		tx: tx,
+		beforeCommit: func(ctx context.Context, tx *sql.Tx) error {
+			return ss.finishMigration(ctx, tx, migration, direction)
+		},
+	}, nil
+}
+
+// BeginNoTxMigration - переводит миграцию в состояние running и выделяет соединение
+// для выполнения запросов без транзакции. Конечное состояние записывается при фиксации;
+// до этого миграция остается в состоянии running (dirty).
+func (ss *sqlStorage) BeginNoTxMigration(
+	ctx context.Context,
+	migration domain.Migration,
+	direction bool,
+) (Tx, error) {
+	if ss.db == nil {
+		return nil, errNotConnected
+	}
+	if err := ss.provideMigration(ctx, migration); err != nil {
+		return nil, err
+	}
+	if err := ss.startMigration(ctx, migration, direction); err != nil {
+		return nil, err
+	}
+
+	conn, err := ss.db.Conn(ctx)
+	if err != nil {
+		ss.failStartedMigration(ctx, migration)
+		return nil, fmt.Errorf("%w, %s", errAcquireConnection, err.Error())
+	}
+
+	return &sqlConnTx{
+		conn: conn,
+		finish: func(ctx context.Context, conn *sql.Conn) error {
+			return ss.finishMigration(ctx, conn, migration, direction)
+		},
+	}, nil
+}
+
+// FailMigration - переводит выполняющуюся миграцию в состояние failed.
+// Если СУБД не отменяет DDL вместе с транзакцией, миграция всегда отмечается как dirty.
+func (ss *sqlStorage) FailMigration(ctx context.Context, migration domain.Migration, dirty bool) error {
+	if ss.db == nil {
+		return errNotConnected
+	}
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET status    = ?,
+		dirty     = ?,
+		update_at = %s
+	WHERE version = ?
+	  AND status = ?;
+`, ss.table(), ss.dialect.now())
+	_, err := ss.db.ExecContext(ctx, ss.dialect.rebind(query),
+		string(domain.StatusFailed),
+		dirty || !ss.dialect.transactionalDDL(),
+		migration.Version,
+		string(domain.StatusRunning))
+
+	return err
+}
+
+// ResolveMigration - вручную переводит миграцию в состояние applied или rolled_back и снимает отметку dirty.
+func (ss *sqlStorage) ResolveMigration(ctx context.Context, version uint64, status domain.MigrationStatus) error {
+	if ss.db == nil {
+		return errNotConnected
+	}
+	if status != domain.StatusApplied && status != domain.StatusRolledBack {
+		return fmt.Errorf("%w: %s (allow %s or %s)",
+			domain.ErrInvalidStatus, status, domain.StatusApplied, domain.StatusRolledBack)
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET status     = ?,
+		is_applied = ?,
+		dirty      = FALSE,
+		update_at  = %s
+	WHERE version = ?;
+`, ss.table(), ss.dialect.now())
+	result, err := ss.db.ExecContext(ctx, ss.dialect.rebind(query),
+		string(status), status == domain.StatusApplied, version)
+	if err != nil {
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return fmt.Errorf("%w: version %d", domain.ErrMigrationNotFound, version)
+	}
+
+	return nil
+}
+
+// RecordExecution - добавляет запись в журнал выполнения миграций (журнал только пополняется).
+func (ss *sqlStorage) RecordExecution(ctx context.Context, execution domain.Execution) error {
+	if ss.db == nil {
+		return errNotConnected
+	}
+	query := fmt.Sprintf(`
+	INSERT INTO %s (version, name, direction, started_at, finished_at, duration_ms,
+					outcome, error, os_user, db_role, hostname, tool_version)
+	VALUES (?, ?, ?, ?, ?, ?, ?, NULLIF(?, ''), ?, %s, ?, ?);
+`, ss.historyTable(), ss.dialect.currentRole())
+	_, err := ss.db.ExecContext(ctx, ss.dialect.rebind(query),
+		execution.Version,
+		execution.Name,
+		execution.Direction,
+		execution.StartedAt.UTC(),
+		execution.FinishedAt.UTC(),
+		execution.Duration.Milliseconds(),
+		string(execution.Outcome),
+		execution.Error,
+		execution.OSUser,
+		execution.Hostname,
+		execution.ToolVersion,
+	)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errRecordExecution, err.Error())
+	}
+
+	return nil
+}
+
+// Executions - возвращает журнал выполнения миграций (всех или одной версии), начиная с последних записей.
+func (ss *sqlStorage) Executions(ctx context.Context, version uint64, limit int) ([]domain.Execution, error) {
+	if ss.db == nil {
+		return nil, errNotConnected
+	}
+	query := fmt.Sprintf(`
+	SELECT id, version, name, direction, started_at, finished_at, duration_ms,
+		   outcome, COALESCE(error, ''), os_user, db_role, hostname, tool_version
+	FROM %s
+	WHERE ? = 0 OR version = ?
+	ORDER BY started_at DESC, id DESC
+`, ss.historyTable())
+	if limit > 0 {
+		query += fmt.Sprintf("LIMIT %d", limit)
+	}
+	rows, err := ss.db.QueryContext(ctx, ss.dialect.rebind(query), version, version)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var executions []domain.Execution
+	for rows.Next() {
+		var (
+			execution  domain.Execution
+			durationMs int64
+		)
+		if err := rows.Scan(
+			&execution.ID,
+			&execution.Version,
+			&execution.Name,
+			&execution.Direction,
+			&execution.StartedAt,
+			&execution.FinishedAt,
+			&durationMs,
+			&execution.Outcome,
+			&execution.Error,
+			&execution.OSUser,
+			&execution.DBRole,
+			&execution.Hostname,
+			&execution.ToolVersion); err != nil {
+			return nil, err
+		}
+		execution.Duration = time.Duration(durationMs) * time.Millisecond
+		executions = append(executions, execution)
+	}
+
+	return executions, rows.Err()
+}
+
+func (ss *sqlStorage) RecentMigration(ctx context.Context) (domain.Migration, error) {
+	if ss.db == nil {
+		return domain.Migration{}, errNotConnected
+	}
+	var (
+		migration domain.Migration
+		tags      string
+	)
+	query := fmt.Sprintf(`
+	SELECT version, name, is_applied, status, dirty, update_at, COALESCE(checksum, ''), COALESCE(tags, '')
+	FROM %s
+	WHERE is_applied = TRUE
+	ORDER BY version DESC
+	LIMIT 1;
+`, ss.table())
+	if err := ss.db.QueryRowContext(ctx, query).Scan(
+		&migration.Version,
+		&migration.Name,
+		&migration.IsApplied,
+		&migration.Status,
+		&migration.Dirty,
+		&migration.UpdateAt,
+		&migration.Checksum,
+		&tags); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return migration, ErrNoAppliedMigrations
+		}
+
+		return migration, err
+	}
+	migration.Tags = splitTags(tags)
+
+	return migration, nil
+}
+
+func (ss *sqlStorage) GetMigrationsByDirection(
+	ctx context.Context,
+	isApplied bool,
+) (map[uint64]domain.Migration, error) {
+	if ss.db == nil {
+		return nil, errNotConnected
+	}
+	query := fmt.Sprintf(`
+	SELECT version, name, is_applied, status, dirty, update_at, COALESCE(checksum, ''), COALESCE(tags, '')
+	FROM %s
+	WHERE is_applied = ?
+	ORDER BY version DESC;
+`, ss.table())
+	migrations, err := ss.queryMigrations(ctx, ss.dialect.rebind(query), isApplied)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[uint64]domain.Migration, len(migrations))
+	for _, migration := range migrations {
+		result[migration.Version] = migration
+	}
+
+	return result, nil
+}
+
+func (ss *sqlStorage) Stats(ctx context.Context) ([]domain.Migration, error) {
+	if ss.db == nil {
+		return nil, errNotConnected
+	}
+	query := fmt.Sprintf(`
+	SELECT version, name, is_applied, status, dirty, update_at, COALESCE(checksum, ''), COALESCE(tags, '')
+	FROM %s
+	ORDER BY version;
+`, ss.table())
+
+	return ss.queryMigrations(ctx, query)
+}
+
+// Lock - устанавливает блокировку в отдельном соединении, которое удерживается до вызова UnLock.
+func (ss *sqlStorage) Lock(ctx context.Context, uid uint32, timeout time.Duration) error {
+	if ss.db == nil {
+		return errNotConnected
+	}
+
+	conn, err := ss.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLock, err.Error())
+	}
+	if err := ss.dialect.lock(ctx, conn, uid, timeout); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	ss.lockConn = conn
+	ss.lockUID = uid
+
+	return nil
+}
+
+// UnLock - снимает блокировку и возвращает удерживавшее ее соединение в пул.
+func (ss *sqlStorage) UnLock(ctx context.Context) error {
+	if ss.lockConn == nil {
+		return nil
+	}
+
+	return ss.releaseLockConn(ctx)
+}
+
+// releaseLockConn - снимает блокировку и возвращает удерживавшее ее соединение в пул.
+// Если снять блокировку не удалось, соединение закрывается, а не возвращается в пул:
+// блокировка сессионная, и соединение в пуле удерживало бы ее.
+func (ss *sqlStorage) releaseLockConn(ctx context.Context) error {
+	conn := ss.lockConn
+	ss.lockConn = nil
+	if err := ss.dialect.unlock(ctx, conn, ss.lockUID); err != nil {
+		// driver.ErrBadConn из Raw закрывает соединение вместо возврата в пул
+		_ = conn.Raw(func(interface{}) error {
+			return driver.ErrBadConn
+		})
+
+		return err
+	}
+
+	return conn.Close()
+}
+
+// queryMigrations - выполняет запрос, возвращающий записи таблицы миграций.
+func (ss *sqlStorage) queryMigrations(
+	ctx context.Context,
+	query string,
+	args ...interface{},
+) ([]domain.Migration, error) {
+	rows, err := ss.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var migrations []domain.Migration
+	for rows.Next() {
+		var (
+			migration domain.Migration
+			tags      string
+		)
+		if err := rows.Scan(
+			&migration.Version,
+			&migration.Name,
+			&migration.IsApplied,
+			&migration.Status,
+			&migration.Dirty,
+			&migration.UpdateAt,
+			&migration.Checksum,
+			&tags); err != nil {
+			return nil, err
+		}
+		migration.Tags = splitTags(tags)
+		migrations = append(migrations, migration)
+	}
+
+	return migrations, rows.Err()
+}
+
+// provideStorage - создает схему и служебные таблицы мигратора и обновляет их до текущей версии.
+func (ss *sqlStorage) provideStorage(ctx context.Context) error {
+	schema, _ := ss.config.MigrationsTable()
+	if err := ss.dialect.provideSchema(ctx, ss.db, schema); err != nil {
+		return fmt.Errorf("%w: %s", errCreateSchema, err.Error())
+	}
+
+	if err := ss.provideMetaStorage(ctx); err != nil {
+		return fmt.Errorf("%w: %s", errUpgradeStorage, err.Error())
+	}
+
+	return nil
+}
+
+// provideMetaStorage - создает таблицу версий служебных таблиц и применяет недостающие мета-миграции
+// под блокировкой, чтобы одновременно запущенные миграторы не обновляли служебные таблицы параллельно.
+func (ss *sqlStorage) provideMetaStorage(ctx context.Context) error {
+	if _, err := ss.db.ExecContext(ctx, ss.dialect.createMetaTable(ss.metaTable())); err != nil {
+		return err
+	}
+
+	conn, err := ss.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	schema, _ := ss.config.MigrationsTable()
+	uid := util.GenerateUID(ss.metaTableName(), schema)
+	if err := ss.dialect.lock(ctx, conn, uid, ss.lockTimeout()); err != nil {
+		return err
+	}
+	defer func() {
+		if err := ss.dialect.unlock(context.Background(), conn, uid); err != nil {
+			ss.logger.Error("failed to release the meta migration lock", zap.Error(err))
+		}
+	}()
+
+	var current int
+	if err := conn.QueryRowContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(version), 0) FROM %s;", ss.metaTable())).
+		Scan(&current); err != nil {
+		return err
+	}
+
+	metaMigrations := ss.dialect.metaMigrations()
+	latest := metaMigrations[len(metaMigrations)-1].version
+	if current > latest {
+		ss.logger.Warn("migration tables were upgraded by a newer version of the migrator",
+			zap.Int("metaVersion", current), zap.Int("supportedMetaVersion", latest))
+	}
+
+	for _, meta := range metaMigrations {
+		if meta.version <= current {
+			continue
+		}
+		if err := ss.applyMetaMigration(ctx, conn, meta); err != nil {
+			return fmt.Errorf("%w %d (%s): %s", errApplyMetaMigration, meta.version, meta.name, err.Error())
+		}
+		ss.logger.Info("meta migration applied", zap.Int("version", meta.version), zap.String("name", meta.name))
+	}
+
+	return nil
+}
+
+// applyMetaMigration - применяет мета-миграцию и записывает ее версию в одной транзакции.
+func (ss *sqlStorage) applyMetaMigration(ctx context.Context, conn *sql.Conn, meta sqlMetaMigration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if _, err := tx.ExecContext(ctx, meta.query(ss)); err != nil {
+		return err
+	}
+	insert := fmt.Sprintf("INSERT INTO %s (version, name, tool_version) VALUES (?, ?, ?);", ss.metaTable())
+	if _, err := tx.ExecContext(ctx, ss.dialect.rebind(insert), meta.version, meta.name, config.AppVersion); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (ss *sqlStorage) provideMigration(ctx context.Context, migration domain.Migration) error {
+	if migration.Name == "" || migration.Version == 0 {
+		return fmt.Errorf("%w: version = '%d', name = '%s'",
+			errVersionOrNameEmpty, migration.Version, migration.Name)
+	}
+
+	query := ss.dialect.rebind(ss.dialect.insertMigration(ss.table()))
+	if _, err := ss.db.ExecContext(ctx, query, migration.Version, migration.Name); err != nil {
+		return fmt.Errorf("%w: %s", errCreateMigrationRecord, err.Error())
+	}
+
+	return nil
+}
+
+// startMigration - переводит миграцию в состояние running (фиксируется сразу, вне транзакции миграции).
+func (ss *sqlStorage) startMigration(ctx context.Context, migration domain.Migration, direction bool) error {
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET status    = ?,
+		dirty     = TRUE,
+		update_at = %s
+	WHERE version = ?
+	  AND is_applied <> ?
+	  AND NOT dirty;
+`, ss.table(), ss.dialect.now())
+	ctx, cancelFunc := context.WithTimeout(ctx, checkTimeout)
+	defer cancelFunc()
+
+	result, err := ss.db.ExecContext(ctx, ss.dialect.rebind(query),
+		string(domain.StatusRunning), migration.Version, direction)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return ErrQueryDeadlineExceeded
+		}
+
+		return fmt.Errorf("%w: %s", errBeginMigration, err.Error())
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return ErrQueryNoAffectRows
+	}
+
+	return nil
+}
+
+// finishMigration - переводит выполняющуюся миграцию в конечное состояние.
+func (ss *sqlStorage) finishMigration(
+	ctx context.Context,
+	exec sqlExecutor,
+	migration domain.Migration,
+	direction bool,
+) error {
+	status := domain.StatusRolledBack
+	if direction {
+		status = domain.StatusApplied
+	}
+
+	query := fmt.Sprintf(`
+	UPDATE %s
+	SET is_applied = ?,
+		status     = ?,
+		dirty      = FALSE,
+		checksum   = CASE WHEN ? THEN NULLIF(?, '') ELSE checksum END,
+		tags       = CASE WHEN ? THEN NULLIF(?, '') ELSE tags END,
+		update_at  = %s
+	WHERE version = ?
+	  AND status = ?;
+`, ss.table(), ss.dialect.now())
+	result, err := exec.ExecContext(ctx, ss.dialect.rebind(query),
+		direction, string(status), direction, migration.Checksum, direction, joinTags(migration.Tags),
+		migration.Version, string(domain.StatusRunning))
+	if err != nil {
+		return fmt.Errorf("%w: %s", errBeginMigration, err.Error())
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return ErrQueryNoAffectRows
+	}
+
+	return nil
+}
+
+// failStartedMigration - переводит миграцию в состояние failed, если транзакция миграции не была начата.
+func (ss *sqlStorage) failStartedMigration(ctx context.Context, migration domain.Migration) {
+	if err := ss.FailMigration(ctx, migration, false); err != nil {
+		ss.logger.Error("failed to mark migration as failed", zap.Uint64("version", migration.Version), zap.Error(err))
+	}
+}
+
+// lockTimeout - время ожидания блокировки из конфигурации.
+func (ss *sqlStorage) lockTimeout() time.Duration {
+	if ss.config.LockTimeout <= 0 {
+		return config.DefaultLockTimeout
+	}
+
+	return ss.config.LockTimeout
+}
+
+// historyTableName - возвращает имя таблицы журнала выполнения миграций.
+func (ss *sqlStorage) historyTableName() string {
+	_, table := ss.config.MigrationsTable()
+	return table + historyTableSuffix
+}
+
+// historyTable - возвращает экранированное имя таблицы журнала выполнения миграций вместе со схемой.
+func (ss *sqlStorage) historyTable() string {
+	schema, _ := ss.config.MigrationsTable()
+	return ss.dialect.table(schema, ss.historyTableName())
+}
+
+// metaTableName - возвращает имя таблицы версий служебных таблиц.
+func (ss *sqlStorage) metaTableName() string {
+	_, table := ss.config.MigrationsTable()
+	return table + metaTableSuffix
+}
+
+// metaTable - возвращает экранированное имя таблицы версий служебных таблиц вместе со схемой.
+func (ss *sqlStorage) metaTable() string {
+	schema, _ := ss.config.MigrationsTable()
+	return ss.dialect.table(schema, ss.metaTableName())
+}
+
+// table - возвращает экранированное имя таблицы миграций вместе со схемой.
+func (ss *sqlStorage) table() string {
+	schema, table := ss.config.MigrationsTable()
+	return ss.dialect.table(schema, table)
+}
@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/pkg/fileutil" //nolint:depguard
+	_ "modernc.org/sqlite"                //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/splitter" //nolint:depguard
+)
+
+var errSQLitePathEmpty = errors.New("no database file in the sqlite DSN")
+
+// sqliteMemoryLocks - блокировки баз без файла (в памяти) по идентификатору блокировки.
+// Такая база доступна только из текущего процесса, поэтому достаточно блокировки внутри процесса.
+var sqliteMemoryLocks sync.Map
+
+// sqliteDialect - диалект SQLite.
+// Схема таблицы миграций не используется: служебные таблицы создаются в файле базы данных.
+// Вместо advisory-блокировок используются блокировки файлов рядом с файлом базы данных.
+type sqliteDialect struct {
+	mu    sync.Mutex
+	locks map[uint32]func() error
+}
+
+func newSQLiteDialect() *sqliteDialect {
+	return &sqliteDialect{locks: make(map[uint32]func() error)}
+}
+
+func (*sqliteDialect) driverName() string {
+	return "sqlite"
+}
+
+// dataSource - преобразует DSN вида sqlite:///path/to/file.db?param=value в строку подключения драйвера.
+func (*sqliteDialect) dataSource(dsn string) (string, error) {
+	_, rest, _ := strings.Cut(dsn, "://")
+	path, rawQuery, _ := strings.Cut(rest, "?")
+	if path == "" {
+		return "", errSQLitePathEmpty
+	}
+
+	params, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", err
+	}
+	// ожидание записи другим соединением вместо немедленной ошибки SQLITE_BUSY
+	params.Add("_pragma", "busy_timeout(5000)")
+	params.Set("_txlock", "immediate")
+
+	return path + "?" + params.Encode(), nil
+}
+
+func (d *sqliteDialect) table(_, name string) string {
+	return d.quoteIdent(name)
+}
+
+func (*sqliteDialect) quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+func (*sqliteDialect) rebind(query string) string {
+	return query
+}
+
+func (*sqliteDialect) now() string {
+	return "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+}
+
+func (*sqliteDialect) currentRole() string {
+	return "''"
+}
+
+func (*sqliteDialect) insertMigration(table string) string {
+	return fmt.Sprintf("INSERT OR IGNORE INTO %s (version, name, is_applied) VALUES (?, ?, FALSE);", table)
+}
+
+func (*sqliteDialect) transactionalDDL() bool {
+	return true
+}
+
+func (*sqliteDialect) splitOptions() splitter.Options {
+	return splitter.Options{}
+}
+
+func (*sqliteDialect) createMetaTable(table string) string {
+	return createMetaTable(table)
+}
+
+func (*sqliteDialect) provideSchema(_ context.Context, _ *sql.DB, _ string) error {
+	return nil
+}
+
+func (*sqliteDialect) metaMigrations() []sqlMetaMigration {
+	return sqliteMetaMigrations
+}
+
+// lock - блокирует файл <файл базы>.migrator-<uid>.lock, ожидая его освобождения не дольше timeout.
+// В файл записывается PID процесса, чтобы при ожидании сообщить, кто удерживает блокировку.
+// Для базы в памяти файла нет, и используется блокировка внутри процесса.
+func (d *sqliteDialect) lock(ctx context.Context, conn *sql.Conn, uid uint32, timeout time.Duration) error {
+	dbPath, err := databasePath(ctx, conn)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrLock, err.Error())
+	}
+	if dbPath == "" {
+		return d.lockMemory(ctx, uid, timeout)
+	}
+
+	lockPath := fmt.Sprintf("%s.migrator-%d.lock", dbPath, uid)
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		file, err := fileutil.TryLockFile(lockPath, os.O_RDWR|os.O_CREATE, fileutil.PrivateFileMode)
+		if err == nil {
+			if err := file.Truncate(0); err == nil {
+				_, _ = file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+			}
+			// файл блокировки не удаляется, иначе другой процесс может заблокировать уже удаленный файл
+			d.setLock(uid, file.Close)
+
+			return nil
+		}
+		if !errors.Is(err, fileutil.ErrLocked) {
+			return fmt.Errorf("%w: %s", ErrLock, err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			pid, errRead := os.ReadFile(lockPath)
+			if errRead != nil || len(pid) == 0 {
+				return fmt.Errorf("%w: timed out after %s", ErrLock, timeout)
+			}
+
+			return fmt.Errorf("%w: timed out after %s, the lock is held by process with pid %s", ErrLock, timeout, pid)
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// lockMemory - блокировка базы в памяти внутри процесса, ожидающая освобождения не дольше timeout.
+func (d *sqliteDialect) lockMemory(ctx context.Context, uid uint32, timeout time.Duration) error {
+	sem, _ := sqliteMemoryLocks.LoadOrStore(uid, make(chan struct{}, 1))
+	memoryLock := sem.(chan struct{})
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	select {
+	case memoryLock <- struct{}{}:
+		d.setLock(uid, func() error {
+			<-memoryLock
+			return nil
+		})
+
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-deadline.C:
+		return fmt.Errorf("%w: timed out after %s, the lock is held in this process", ErrLock, timeout)
+	}
+}
+
+func (d *sqliteDialect) setLock(uid uint32, release func() error) {
+	d.mu.Lock()
+	d.locks[uid] = release
+	d.mu.Unlock()
+}
+
+func (d *sqliteDialect) unlock(_ context.Context, _ *sql.Conn, uid uint32) error {
+	d.mu.Lock()
+	release, ok := d.locks[uid]
+	delete(d.locks, uid)
+	d.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	return release()
+}
+
+// databasePath - путь к файлу основной базы соединения.
+// Путь берется из самой базы, а не из DSN, поэтому известен и для пула соединений приложения.
+// Для базы в памяти и временной базы путь пустой.
+func databasePath(ctx context.Context, conn *sql.Conn) (string, error) {
+	rows, err := conn.QueryContext(ctx, "PRAGMA database_list;")
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			seq        int
+			name, file string
+		)
+		if err := rows.Scan(&seq, &name, &file); err != nil {
+			return "", err
+		}
+		if name == "main" {
+			return file, rows.Err()
+		}
+	}
+
+	return "", rows.Err()
+}
+
+// sqliteMetaMigrations - мета-миграции служебных таблиц для SQLite.
+// Список только дополняется: уже выпущенные мета-миграции изменять нельзя.
+var sqliteMetaMigrations = []sqlMetaMigration{
+	{
+		version: 1,
+		name:    "create migration table",
+		query: func(ss *sqlStorage) string {
+			_, tableName := ss.config.MigrationsTable()
+			return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		version BIGINT NOT NULL PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		is_applied BOOLEAN NOT NULL,
+		status VARCHAR(16) NOT NULL DEFAULT 'pending',
+		dirty BOOLEAN NOT NULL DEFAULT FALSE,
+		checksum VARCHAR(64),
+		update_at DATETIME NOT NULL DEFAULT (strftime('%%Y-%%m-%%d %%H:%%M:%%f', 'now'))
+	);
+	CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s (is_applied, version);
+`, ss.table(), ss.dialect.quoteIdent(fmt.Sprintf("idx_%s_applied_version", tableName)))
+		},
+	},
+	{
+		version: 2,
+		name:    "create history table",
+		query: func(ss *sqlStorage) string {
+			return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %[1]s (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version BIGINT NOT NULL,
+		name VARCHAR(255) NOT NULL,
+		direction VARCHAR(4) NOT NULL,
+		started_at DATETIME NOT NULL,
+		finished_at DATETIME NOT NULL,
+		duration_ms BIGINT NOT NULL,
+		outcome VARCHAR(16) NOT NULL,
+		error TEXT,
+		os_user VARCHAR(255) NOT NULL,
+		db_role VARCHAR(255) NOT NULL,
+		hostname VARCHAR(255) NOT NULL,
+		tool_version VARCHAR(64) NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS %[2]s ON %[1]s (version, started_at);
+`, ss.historyTable(), ss.dialect.quoteIdent(fmt.Sprintf("idx_%s_version_started", ss.historyTableName())))
+		},
+	},
+	{
+		version: 3,
+		name:    "create repeatable table",
+		query: func(ss *sqlStorage) string {
+			return fmt.Sprintf(`
+	CREATE TABLE IF NOT EXISTS %s (
+		name VARCHAR(255) NOT NULL PRIMARY KEY,
+		checksum VARCHAR(64) NOT NULL,
+		applied_at DATETIME NOT NULL
+	);
+`, ss.repeatableTable())
+		},
+	},
+	{
+		version: 4,
+		name:    "add tags",
+		query: func(ss *sqlStorage) string {
+			return fmt.Sprintf(`ALTER TABLE %s ADD COLUMN tags TEXT;`, ss.table())
+		},
+	},
+}
@@ -0,0 +1,242 @@
+package storage_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"  //nolint:depguard
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap/zaptest"             //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/internal/storage" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/config"       //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"       //nolint:depguard
+)
+
+func TestSQLiteStorage(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "migration.db")}
+	migrateStorage := storage.NewStorage(zaptest.NewLogger(t), cfg)
+	require.NoError(t, migrateStorage.Connect(ctx))
+	defer migrateStorage.Close()
+
+	// lock
+	require.NoError(t, migrateStorage.Lock(ctx, 1, time.Second))
+	parallelStorage := storage.NewStorage(zaptest.NewLogger(t), cfg)
+	require.NoError(t, parallelStorage.Connect(ctx))
+	err := parallelStorage.Lock(ctx, 1, 10*time.Millisecond)
+	assert.ErrorIs(t, err, storage.ErrLock)
+	parallelStorage.Close()
+
+	// up
+	migration := domain.Migration{Version: 1, Name: "create_table", Checksum: "checksum", Tags: []string{"dev", "seed"}}
+	tx, err := migrateStorage.BeginTxMigration(ctx, migration, true)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `CREATE TABLE "test_table" (id INTEGER);`)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	recent, err := migrateStorage.RecentMigration(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), recent.Version)
+	assert.Equal(t, domain.StatusApplied, recent.Status)
+	assert.Equal(t, "checksum", recent.Checksum)
+	assert.Equal(t, []string{"dev", "seed"}, recent.Tags)
+	assert.False(t, recent.Dirty)
+
+	// failed down
+	tx, err = migrateStorage.BeginTxMigration(ctx, migration, false)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `DROP TABLE "unknown_table";`)
+	require.Error(t, err)
+	require.NoError(t, tx.Rollback(ctx))
+	require.NoError(t, migrateStorage.FailMigration(ctx, migration, false))
+
+	stats, err := migrateStorage.Stats(ctx)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.True(t, stats[0].IsApplied)
+	assert.Equal(t, domain.StatusFailed, stats[0].Status)
+	assert.Equal(t, []string{"dev", "seed"}, stats[0].Tags)
+	assert.False(t, stats[0].Dirty)
+
+	// history
+	startedAt := time.Now()
+	require.NoError(t, migrateStorage.RecordExecution(ctx, domain.Execution{
+		Version:    1,
+		Name:       "create_table",
+		Direction:  domain.DirectionUp,
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(time.Second),
+		Duration:   time.Second,
+		Outcome:    domain.OutcomeSuccess,
+	}))
+	executions, err := migrateStorage.Executions(ctx, 1, 10)
+	require.NoError(t, err)
+	require.Len(t, executions, 1)
+	assert.Equal(t, time.Second, executions[0].Duration)
+	assert.WithinDuration(t, startedAt, executions[0].StartedAt, time.Millisecond)
+
+	require.NoError(t, migrateStorage.UnLock(ctx))
+}
+
+func TestSQLiteStorage_CloseReleasesLock(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "migration.db")}
+	migrateStorage := storage.NewStorage(zaptest.NewLogger(t), cfg)
+	require.NoError(t, migrateStorage.Connect(ctx))
+	require.NoError(t, migrateStorage.Lock(ctx, 1, time.Second))
+	// блокировка не снята через UnLock (например, после ошибки)
+	migrateStorage.Close()
+
+	parallelStorage := storage.NewStorage(zaptest.NewLogger(t), cfg)
+	require.NoError(t, parallelStorage.Connect(ctx))
+	defer parallelStorage.Close()
+	require.NoError(t, parallelStorage.Lock(ctx, 1, 10*time.Millisecond))
+	require.NoError(t, parallelStorage.UnLock(ctx))
+}
+
+func TestSQLiteStorage_NoTxMigration(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "migration.db")}
+	migrateStorage := storage.NewStorage(zaptest.NewLogger(t), cfg)
+	require.NoError(t, migrateStorage.Connect(ctx))
+	defer migrateStorage.Close()
+
+	// up
+	migration := domain.Migration{Version: 1, Name: "vacuum"}
+	tx, err := migrateStorage.BeginNoTxMigration(ctx, migration, true)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `CREATE TABLE "test_table" (id INTEGER);`)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `VACUUM;`)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit(ctx))
+
+	recent, err := migrateStorage.RecentMigration(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, domain.StatusApplied, recent.Status)
+	assert.False(t, recent.Dirty)
+
+	// failed down: выполненные запросы не отменяются, миграция остается dirty
+	tx, err = migrateStorage.BeginNoTxMigration(ctx, migration, false)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `DROP TABLE "test_table";`)
+	require.NoError(t, err)
+	_, err = tx.Exec(ctx, `DROP TABLE "unknown_table";`)
+	require.Error(t, err)
+	require.NoError(t, tx.Rollback(ctx))
+	require.NoError(t, migrateStorage.FailMigration(ctx, migration, true))
+
+	stats, err := migrateStorage.Stats(ctx)
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, domain.StatusFailed, stats[0].Status)
+	assert.True(t, stats[0].Dirty)
+}
+
+func TestSQLiteStorage_WithDB(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migration.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrateStorage := storage.NewStorageWithDB(zaptest.NewLogger(t), &config.Config{}, db, "sqlite")
+	require.NoError(t, migrateStorage.Connect(ctx))
+	stats, err := migrateStorage.Stats(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, stats)
+	migrateStorage.Close()
+
+	// пул соединений приложения остается открытым
+	assert.NoError(t, db.PingContext(ctx))
+
+	unknownStorage := storage.NewStorageWithDB(zaptest.NewLogger(t), &config.Config{}, db, "oracle")
+	assert.Error(t, unknownStorage.Connect(ctx))
+}
+
+func TestSQLiteStorage_WithDBLock(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "migration.db")
+	db, err := sql.Open("sqlite", dbPath)
+	require.NoError(t, err)
+	defer db.Close()
+	otherDB, err := sql.Open("sqlite", filepath.Join(dir, "other.db"))
+	require.NoError(t, err)
+	defer otherDB.Close()
+
+	// путь к файлу базы берется из самой базы: блокировка общая с мигратором, подключенным по DSN
+	migrateStorage := storage.NewStorageWithDB(zaptest.NewLogger(t), &config.Config{}, db, "sqlite")
+	require.NoError(t, migrateStorage.Lock(ctx, 1, time.Second))
+	assert.FileExists(t, dbPath+".migrator-1.lock")
+
+	dsnStorage := storage.NewStorage(zaptest.NewLogger(t), &config.Config{DSN: "sqlite://" + dbPath})
+	require.NoError(t, dsnStorage.Connect(ctx))
+	defer dsnStorage.Close()
+	assert.ErrorIs(t, dsnStorage.Lock(ctx, 1, 10*time.Millisecond), storage.ErrLock)
+
+	// блокировка другой базы с тем же идентификатором не конфликтует
+	otherStorage := storage.NewStorageWithDB(zaptest.NewLogger(t), &config.Config{}, otherDB, "sqlite")
+	require.NoError(t, otherStorage.Lock(ctx, 1, 10*time.Millisecond))
+	require.NoError(t, otherStorage.UnLock(ctx))
+
+	require.NoError(t, migrateStorage.UnLock(ctx))
+	require.NoError(t, dsnStorage.Lock(ctx, 1, time.Second))
+	require.NoError(t, dsnStorage.UnLock(ctx))
+}
+
+func TestSQLiteStorage_MemoryLock(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", ":memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	// у базы в памяти нет файла, блокировка удерживается внутри процесса
+	migrateStorage := storage.NewStorageWithDB(zaptest.NewLogger(t), &config.Config{}, db, "sqlite")
+	require.NoError(t, migrateStorage.Lock(ctx, 2, time.Second))
+
+	parallelStorage := storage.NewStorageWithDB(zaptest.NewLogger(t), &config.Config{}, db, "sqlite")
+	assert.ErrorIs(t, parallelStorage.Lock(ctx, 2, 10*time.Millisecond), storage.ErrLock)
+
+	require.NoError(t, migrateStorage.UnLock(ctx))
+	require.NoError(t, parallelStorage.Lock(ctx, 2, time.Second))
+	require.NoError(t, parallelStorage.UnLock(ctx))
+}
+
+func TestSQLiteStorage_RepeatableMigration(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{DSN: "sqlite://" + filepath.Join(t.TempDir(), "migration.db")}
+	migrateStorage := storage.NewStorage(zaptest.NewLogger(t), cfg)
+	require.NoError(t, migrateStorage.Connect(ctx))
+	defer migrateStorage.Close()
+
+	for _, checksum := range []string{"first", "second"} {
+		tx, err := migrateStorage.BeginTxRepeatableMigration(ctx,
+			domain.RepeatableMigration{Name: "usersView", Checksum: checksum})
+		require.NoError(t, err)
+		_, err = tx.Exec(ctx, `CREATE VIEW IF NOT EXISTS "users_view" AS SELECT 1 AS id;`)
+		require.NoError(t, err)
+		require.NoError(t, tx.Commit(ctx))
+	}
+
+	// откаченная транзакция не меняет контрольную сумму
+	tx, err := migrateStorage.BeginTxRepeatableMigration(ctx,
+		domain.RepeatableMigration{Name: "usersView", Checksum: "third"})
+	require.NoError(t, err)
+	require.NoError(t, tx.Rollback(ctx))
+
+	migrations, err := migrateStorage.RepeatableMigrations(ctx)
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+	assert.Equal(t, "usersView", migrations[0].Name)
+	assert.Equal(t, "second", migrations[0].Checksum)
+	assert.Equal(t, domain.StatusApplied, migrations[0].Status)
+	assert.False(t, migrations[0].AppliedAt.IsZero())
+
+	_, err = migrateStorage.BeginTxRepeatableMigration(ctx, domain.RepeatableMigration{})
+	assert.Error(t, err)
+}
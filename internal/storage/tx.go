@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v4" //nolint:depguard
+)
+
+// Tx - транзакция миграции, не зависящая от диалекта БД.
+type Tx interface {
+	// Exec - выполняет запрос и возвращает количество затронутых строк.
+	Exec(ctx context.Context, query string, args ...interface{}) (int64, error)
+	Commit(ctx context.Context) error
+	Rollback(ctx context.Context) error
+}
+
+// pgxTx - транзакция миграции поверх pgx.
+type pgxTx struct {
+	tx pgx.Tx
+}
+
+// NewPgxTx - оборачивает транзакцию pgx в транзакцию миграции.
+func NewPgxTx(tx pgx.Tx) Tx {
+	return &pgxTx{tx: tx}
+}
+
+// PgxTx - возвращает транзакцию pgx, если хранилище работает через pgx.
+func PgxTx(tx Tx) (pgx.Tx, bool) {
+	t, ok := tx.(*pgxTx)
+	if !ok {
+		return nil, false
+	}
+
+	return t.tx, true
+}
+
+func (t *pgxTx) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	tag, err := t.tx.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (t *pgxTx) Commit(ctx context.Context) error {
+	return t.tx.Commit(ctx)
+}
+
+func (t *pgxTx) Rollback(ctx context.Context) error {
+	return t.tx.Rollback(ctx)
+}
+
+// sqlTx - транзакция миграции поверх database/sql.
+type sqlTx struct {
+	tx *sql.Tx
+	// beforeCommit - выполняется в транзакции непосредственно перед ее фиксацией.
+	beforeCommit func(ctx context.Context, tx *sql.Tx) error
+}
+
+// SQLTx - возвращает транзакцию database/sql, если хранилище работает через database/sql.
+// Транзакцию фиксирует мигратор: перед фиксацией в ней записывается конечное состояние миграции.
+func SQLTx(tx Tx) (*sql.Tx, bool) {
+	t, ok := tx.(*sqlTx)
+	if !ok {
+		return nil, false
+	}
+
+	return t.tx, true
+}
+
+func (t *sqlTx) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	result, err := t.tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (t *sqlTx) Commit(ctx context.Context) error {
+	if t.beforeCommit != nil {
+		if err := t.beforeCommit(ctx, t.tx); err != nil {
+			_ = t.tx.Rollback()
+			return err
+		}
+	}
+
+	return t.tx.Commit()
+}
+
+func (t *sqlTx) Rollback(_ context.Context) error {
+	return t.tx.Rollback()
+}
+
+// pgxConnTx - миграция без транзакции в выделенном соединении pgx.
+// Каждый запрос фиксируется сразу, поэтому отменить уже выполненные запросы нельзя.
+type pgxConnTx struct {
+	conn    *pgx.Conn
+	release func()
+	// finish - записывает конечное состояние миграции после выполнения всех запросов.
+	finish func(ctx context.Context) error
+}
+
+// PgxConn - возвращает соединение pgx миграции без транзакции, если хранилище работает через pgx.
+func PgxConn(tx Tx) (*pgx.Conn, bool) {
+	t, ok := tx.(*pgxConnTx)
+	if !ok {
+		return nil, false
+	}
+
+	return t.conn, true
+}
+
+func (t *pgxConnTx) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	tag, err := t.conn.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func (t *pgxConnTx) Commit(ctx context.Context) error {
+	defer t.Rollback(ctx) //nolint:errcheck
+
+	return t.finish(ctx)
+}
+
+// Rollback - возвращает соединение в пул; выполненные запросы не отменяются.
+func (t *pgxConnTx) Rollback(_ context.Context) error {
+	if t.release != nil {
+		t.release()
+		t.release = nil
+	}
+
+	return nil
+}
+
+// sqlConnTx - миграция без транзакции в выделенном соединении database/sql.
+// Каждый запрос фиксируется сразу, поэтому отменить уже выполненные запросы нельзя.
+type sqlConnTx struct {
+	conn   *sql.Conn
+	closed bool
+	// finish - записывает конечное состояние миграции после выполнения всех запросов.
+	finish func(ctx context.Context, conn *sql.Conn) error
+}
+
+// SQLConn - возвращает соединение database/sql миграции без транзакции,
+// если хранилище работает через database/sql.
+func SQLConn(tx Tx) (*sql.Conn, bool) {
+	t, ok := tx.(*sqlConnTx)
+	if !ok {
+		return nil, false
+	}
+
+	return t.conn, true
+}
+
+func (t *sqlConnTx) Exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	result, err := t.conn.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func (t *sqlConnTx) Commit(ctx context.Context) error {
+	defer t.Rollback(ctx) //nolint:errcheck
+
+	return t.finish(ctx, t.conn)
+}
+
+// Rollback - возвращает соединение в пул; выполненные запросы не отменяются.
+func (t *sqlConnTx) Rollback(_ context.Context) error {
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	return t.conn.Close()
+}
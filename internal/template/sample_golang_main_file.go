@@ -6,23 +6,59 @@ var SampleGolangMainFile = Sample{
 
 import (
 	"context"
+	"database/sql"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/jackc/pgx/v4"
+
 	"github.com/BashMS/SQL_migrator/pkg/config"
+	"github.com/BashMS/SQL_migrator/pkg/domain"
 	"github.com/BashMS/SQL_migrator/pkg/logger"
 	"github.com/BashMS/SQL_migrator/pkg/migrate"
 	"go.uber.org/zap"
 )
 
 type customFunc struct {
-	migrateFunc migrate.CustomMigrateFunc
-	name        string
-	version     uint64
-	direction   bool
+	// migrateFunc - функция миграции с транзакцией pgx.Tx или *sql.Tx,
+	// а для миграции без транзакции - с соединением *pgx.Conn или *sql.Conn
+	migrateFunc   interface{}
+	noTransaction bool
+	name          string
+	version       uint64
+	checksum      string
+	tags          []string
+	direction     bool
+}
+
+// run - выполняет миграцию функцией, соответствующей типу migrateFunc.
+func (f customFunc) run(ctx context.Context, migrator migrate.Migrate) error {
+	migration := domain.Migration{Version: f.version, Name: f.name, Checksum: f.checksum, Tags: f.tags}
+	switch fn := f.migrateFunc.(type) {
+	case func(context.Context, pgx.Tx) error:
+		if !f.noTransaction {
+			return migrator.RunCustomMigration(ctx, fn, migration, f.direction)
+		}
+	case func(context.Context, *sql.Tx) error:
+		if !f.noTransaction {
+			return migrator.RunSQLMigration(ctx, fn, migration, f.direction)
+		}
+	case func(context.Context, *pgx.Conn) error:
+		if f.noTransaction {
+			return migrator.RunNoTxMigration(ctx, fn, migration, f.direction)
+		}
+	case func(context.Context, *sql.Conn) error:
+		if f.noTransaction {
+			return migrator.RunSQLNoTxMigration(ctx, fn, migration, f.direction)
+		}
+	}
+
+	return fmt.Errorf("%w: %T (version %d, no transaction %t)",
+		domain.ErrUnsupportedMigrateFunc, f.migrateFunc, f.version, f.noTransaction)
 }
 
 func main() {
@@ -33,9 +69,11 @@ func main() {
 	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
 
 	config := config.Config{
-		DSN:              "{{.Config.DSN}}",
+		DSN:              os.Getenv("{{.DSNEnv}}"),
 		LogPath:          "{{.Config.LogPath}}",
 		LogLevel:         "{{.Config.LogLevel}}",
+		TableSchema:      "{{.Config.TableSchema}}",
+		TableName:        "{{.Config.TableName}}",
 	}
 
 	zLogger, err := logger.New(&config)
@@ -52,16 +90,18 @@ func main() {
 {{range $k, $migration := .Migrations}}
 {{$FN := printf "%s%d%s" $prefix $migration.Version $migration.Name}}
     migrationFuncs = append(migrationFuncs, customFunc{
-        migrateFunc: {{$FN}},
-        name:        "{{$migration.Name}}",
-        version:     {{$migration.Version}},
-        direction:   {{$direction}},
+        migrateFunc:   {{$FN}},
+        noTransaction: {{$migration.NoTransaction}},
+        name:          "{{$migration.Name}}",
+        version:       {{$migration.Version}},
+        checksum:      "{{$migration.Checksum}}",
+        tags:          []string{ {{- range $migration.Tags}}"{{.}}", {{end -}} },
+        direction:     {{$direction}},
     })
 {{end}}
 	go func() {
     		for _, f := range migrationFuncs {
-    			if err := migrator.RunMigrationWithCustomFunc(ctx, f.migrateFunc, f.name, f.version, f.direction);
-    				err != nil {
+    			if err := f.run(ctx, migrator); err != nil {
     				zLogger.Error("failed migration {{$prefix}}", zap.Error(err))
     				os.Exit(3)
     			} else {
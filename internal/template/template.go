@@ -11,6 +11,10 @@ import (
 	"github.com/BashMS/SQL_migrator/pkg/domain"      //nolint:depguard
 )
 
+// ProgramDSNEnv - переменная среды, из которой программа go-миграций читает строку подключения к БД
+// (строка подключения не сохраняется в программе, чтобы собранную программу можно было хранить в кэше).
+const ProgramDSNEnv = "MIGRATOR_PROGRAM_DSN"
+
 type (
 	// Sample struct.
 	Sample struct {
@@ -23,6 +27,7 @@ type (
 		Config     *config.Config
 		Migrations []loader.RawMigration
 		Direction  bool
+		DSNEnv     string
 	}
 
 	dataGolangMigrationMethod struct {
@@ -48,6 +53,7 @@ func CreateMainSample(path string, config *config.Config, migrations []loader.Ra
 		Config:     config,
 		Migrations: migrations,
 		Direction:  direction,
+		DSNEnv:     ProgramDSNEnv,
 	}
 
 	return Create(path, sample)
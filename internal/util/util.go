@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"hash/crc32"
 	"io"
+	"io/fs"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -46,6 +48,39 @@ func CopyFile(dest, src string) error {
 	return nil
 }
 
+// CopyDir - копирует каталог src с подкаталогами в новый каталог dest.
+func CopyDir(dest, src string) error {
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("%w: %s (%s)", ErrCopyFile, err.Error(), path)
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return fmt.Errorf("%w: %s (%s)", ErrCopyFile, err.Error(), path)
+		}
+		target := filepath.Join(dest, rel)
+		switch {
+		case entry.IsDir():
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return fmt.Errorf("%w: %s (%s)", ErrCopyFile, err.Error(), path)
+			}
+			return nil
+		case !entry.Type().IsRegular():
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("%w: %s (%s)", ErrCopyFile, err.Error(), path)
+		}
+		// CopyFile не копирует пустые файлы
+		if info.Size() == 0 {
+			return CreateFile(target)
+		}
+
+		return CopyFile(target, path)
+	})
+}
+
 // CreateFile - создает файл.
 func CreateFile(path string) error {
 	f, err := os.Create(path)
@@ -57,6 +92,15 @@ func CreateFile(path string) error {
 	return nil
 }
 
+// CreateFileWithContent - создает файл с указанным содержимым.
+func CreateFileWithContent(path, content string) error {
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil { //nolint:gosec
+		return fmt.Errorf("%w: %s (%s)", ErrCreateFile, err.Error(), path)
+	}
+
+	return nil
+}
+
 // GenerateUID - генерирует уникального ключа по имени.
 func GenerateUID(name string, keys ...string) uint32 {
 	if len(keys) > 0 {
@@ -2,15 +2,21 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/coreos/etcd/pkg/fileutil" //nolint:depguard
 	"github.com/spf13/viper"              //nolint:depguard
 )
 
 const (
+	// AppVersion - версия мигратора.
+	AppVersion = "0.0.1"
+
 	defaultConfigPath = "config/config.yml"
 
 	// LogLevelDebug - уровень логгирования.
@@ -24,6 +30,8 @@ const (
 	FormatSQL = "sql"
 	// FormatGolang - go формат.
 	FormatGolang = "golang"
+	// FormatMixed - sql- и go-миграции в одних каталогах, выполняемые вместе в порядке версий.
+	FormatMixed = "mixed"
 
 	// ExtSQL - расширение для sql.
 	ExtSQL = ".sql"
@@ -35,20 +43,70 @@ const (
 	// PostfixDown down постфикс для отката.
 	PostfixDown = ".down"
 
+	// SQLLayoutSplit - sql-миграция в двух файлах с постфиксами .up и .down.
+	SQLLayoutSplit = "split"
+	// SQLLayoutSingle - sql-миграция в одном файле с секциями `-- +migrate Up` и `-- +migrate Down`.
+	SQLLayoutSingle = "single"
+
+	// RepeatablePrefix - префикс файла повторяемой sql-миграции (R_<имя>.sql).
+	RepeatablePrefix = "R_"
+
 	// Separator - разделитель.
 	Separator = '_'
+
+	// DefaultLockTimeout - время ожидания блокировки по умолчанию.
+	DefaultLockTimeout = time.Minute
+
+	// DefaultTableSchema - схема таблицы миграций по умолчанию.
+	DefaultTableSchema = "public"
+	// DefaultTableName - имя таблицы миграций по умолчанию.
+	DefaultTableName = "tmigration"
+
+	// EnvVarPrefix - префикс переменных среды со значениями переменных шаблонов sql-миграций.
+	EnvVarPrefix = "MIGRATOR_VAR_"
 )
 
-// ErrConfigurationFileNotFound - файл конфигурации не найден.
-var ErrConfigurationFileNotFound = errors.New("configuration file not found")
+var (
+	// ErrConfigurationFileNotFound - файл конфигурации не найден.
+	ErrConfigurationFileNotFound = errors.New("configuration file not found")
+	// ErrInvalidVar - переменная шаблона должна быть указана в виде key=value.
+	ErrInvalidVar = errors.New("template variable must be specified as key=value")
+)
 
 // Config.
 type Config struct {
-	DSN         string
-	Path        string
-	Format      string
-	LogPath     string
-	LogLevel    string
+	DSN           string
+	Path          string
+	Format        string
+	SQLLayout     string
+	LogPath       string
+	LogLevel      string
+	LockTimeout   time.Duration
+	TableSchema   string
+	TableName     string
+	AllowModified bool
+	// Paths - каталоги миграций (или glob-шаблоны каталогов), миграции которых объединяются в один план.
+	// Если не заданы, используется Path; иначе Path - первый из них, а для glob-шаблона - первый подходящий
+	// каталог (в нем команда create создает файлы).
+	Paths []string
+	// AllowOutOfOrder - накатывать не примененные миграции с версией ниже последней примененной.
+	AllowOutOfOrder bool
+	// Force - откатывать миграции, файлы отката которых отсутствуют (они отмечаются откаченными без выполнения).
+	Force bool
+	// CI - запуск в CI: пропущенные миграции с версией ниже последней примененной считаются ошибкой.
+	CI bool
+	// Tags - выполнять из миграций с тегами только миграции хотя бы с одним из этих тегов.
+	Tags []string
+	// ExcludeTags - не выполнять миграции хотя бы с одним из этих тегов.
+	ExcludeTags []string
+	// GoModule - каталог модуля мигратора (или проекта с мигратором в vendor), с которым программа go-миграций
+	// собирается без доступа к сети.
+	// Если не задан, ищется по go.mod каталогов миграций и рабочего каталога.
+	GoModule string
+	// GoCacheDir - каталог кэша собранных программ go-миграций (по умолчанию - в пользовательском кэше ОС).
+	GoCacheDir string
+	// Vars - переменные шаблонов sql-миграций (имена в нижнем регистре).
+	Vars        map[string]string
 	viperConfig *viper.Viper
 }
 
@@ -96,18 +154,168 @@ func (c *Config) Apply() {
 	if c.DSN == "" {
 		c.DSN = os.ExpandEnv(c.viper().GetString("migrator.dsn"))
 	}
-	if c.Path == "" {
-		c.Path = os.ExpandEnv(c.viper().GetString("migrator.path"))
+	if c.Path == "" && len(c.Paths) == 0 {
+		c.Paths = c.viperPaths("migrator.path")
+	}
+	if c.Path == "" && len(c.Paths) != 0 {
+		c.Path = firstMigrationDir(c.Paths)
 	}
 	if c.Format == "" {
 		c.Format = os.ExpandEnv(c.viper().GetString("migrator.format"))
 	}
+	if c.SQLLayout == "" {
+		c.SQLLayout = os.ExpandEnv(c.viper().GetString("migrator.sql.layout"))
+	}
 	if c.LogPath == "" {
 		c.LogPath = os.ExpandEnv(c.viper().GetString("migrator.log.path"))
 	}
 	if c.LogLevel == "" {
 		c.LogLevel = os.ExpandEnv(c.viper().GetString("migrator.log.level"))
 	}
+	if c.LockTimeout == 0 {
+		c.LockTimeout = c.viper().GetDuration("migrator.lock.timeout")
+	}
+	if c.TableSchema == "" {
+		c.TableSchema = os.ExpandEnv(c.viper().GetString("migrator.table.schema"))
+	}
+	if c.TableName == "" {
+		c.TableName = os.ExpandEnv(c.viper().GetString("migrator.table.name"))
+	}
+	if !c.AllowModified {
+		c.AllowModified = c.viper().GetBool("migrator.allow_modified")
+	}
+	if !c.AllowOutOfOrder {
+		c.AllowOutOfOrder = c.viper().GetBool("migrator.allow_out_of_order")
+	}
+	if !c.CI {
+		c.CI = c.viper().GetBool("migrator.ci") || isCI()
+	}
+	if len(c.Tags) == 0 {
+		c.Tags = c.viper().GetStringSlice("migrator.tags")
+	}
+	if len(c.ExcludeTags) == 0 {
+		c.ExcludeTags = c.viper().GetStringSlice("migrator.exclude_tags")
+	}
+	if c.GoModule == "" {
+		c.GoModule = os.ExpandEnv(c.viper().GetString("migrator.go.module"))
+	}
+	if c.GoCacheDir == "" {
+		c.GoCacheDir = os.ExpandEnv(c.viper().GetString("migrator.go.cache_dir"))
+	}
+	c.applyVars()
+}
+
+// viperPaths - возвращает пути из параметра key, заданного строкой или списком строк.
+func (c *Config) viperPaths(key string) []string {
+	var paths []string
+	switch value := c.viper().Get(key).(type) {
+	case string:
+		paths = []string{value}
+	case []interface{}:
+		for _, item := range value {
+			paths = append(paths, fmt.Sprint(item))
+		}
+	case []string:
+		paths = value
+	}
+
+	var result []string
+	for _, path := range paths {
+		if path = os.ExpandEnv(path); path != "" {
+			result = append(result, path)
+		}
+	}
+
+	return result
+}
+
+// firstMigrationDir - возвращает первый каталог миграций: первый путь без glob-шаблона или первый каталог,
+// подходящий под шаблон. Пустая строка - ни один шаблон не подошел.
+func firstMigrationDir(paths []string) string {
+	for _, path := range paths {
+		if !strings.ContainsAny(path, "*?[") {
+			return path
+		}
+		matches, _ := filepath.Glob(path)
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.IsDir() {
+				return match
+			}
+		}
+	}
+
+	return ""
+}
+
+// MigrationPaths - возвращает каталоги миграций (или glob-шаблоны каталогов).
+func (c *Config) MigrationPaths() []string {
+	if len(c.Paths) != 0 {
+		return c.Paths
+	}
+	if c.Path != "" {
+		return []string{c.Path}
+	}
+
+	return nil
+}
+
+// isCI - сообщает, что мигратор запущен в CI (большинство CI-систем устанавливают переменную среды CI).
+func isCI() bool {
+	ci, err := strconv.ParseBool(os.Getenv("CI"))
+	return err == nil && ci
+}
+
+// SetVars - устанавливает переменные шаблонов sql-миграций из пар key=value (например, из флагов --var).
+// Эти значения имеют приоритет над переменными среды и файла конфигурации.
+func (c *Config) SetVars(pairs []string) error {
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return fmt.Errorf("%w: %q", ErrInvalidVar, pair)
+		}
+		c.setVar(key, value)
+	}
+
+	return nil
+}
+
+// applyVars - дополняет переменные шаблонов значениями из переменных среды MIGRATOR_VAR_<имя>
+// и секции migrator.vars файла конфигурации (в порядке убывания приоритета).
+func (c *Config) applyVars() {
+	for _, env := range os.Environ() {
+		name, value, _ := strings.Cut(env, "=")
+		if key, ok := strings.CutPrefix(name, EnvVarPrefix); ok && key != "" {
+			if _, exists := c.Vars[strings.ToLower(key)]; !exists {
+				c.setVar(key, value)
+			}
+		}
+	}
+	for key, value := range c.viper().GetStringMapString("migrator.vars") {
+		if _, exists := c.Vars[strings.ToLower(key)]; !exists {
+			c.setVar(key, value)
+		}
+	}
+}
+
+func (c *Config) setVar(key, value string) {
+	if c.Vars == nil {
+		c.Vars = make(map[string]string)
+	}
+	c.Vars[strings.ToLower(key)] = value
+}
+
+// MigrationsTable - возвращает схему и имя таблицы миграций (с учетом значений по умолчанию).
+func (c *Config) MigrationsTable() (string, string) {
+	schema, name := c.TableSchema, c.TableName
+	if schema == "" {
+		schema = DefaultTableSchema
+	}
+	if name == "" {
+		name = DefaultTableName
+	}
+
+	return schema, name
 }
 
 // PathConversion - заменяет относительные пути на абсолютные.
@@ -119,12 +327,30 @@ func (c *Config) PathConversion() error {
 			return err
 		}
 	}
+	for idx, path := range c.Paths {
+		c.Paths[idx], err = filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+	}
 	if c.LogPath != "" {
 		c.LogPath, err = filepath.Abs(c.LogPath)
 		if err != nil {
 			return err
 		}
 	}
+	if c.GoModule != "" {
+		c.GoModule, err = filepath.Abs(c.GoModule)
+		if err != nil {
+			return err
+		}
+	}
+	if c.GoCacheDir != "" {
+		c.GoCacheDir, err = filepath.Abs(c.GoCacheDir)
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
@@ -143,4 +369,8 @@ func (c *Config) viper() *viper.Viper {
 
 func (c *Config) applyDefault() {
 	c.viper().SetDefault("migrator.format", FormatSQL)
+	c.viper().SetDefault("migrator.sql.layout", SQLLayoutSplit)
+	c.viper().SetDefault("migrator.lock.timeout", DefaultLockTimeout)
+	c.viper().SetDefault("migrator.table.schema", DefaultTableSchema)
+	c.viper().SetDefault("migrator.table.name", DefaultTableName)
 }
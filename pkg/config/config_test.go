@@ -0,0 +1,200 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"  //nolint:depguard
+	"github.com/stretchr/testify/require" //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/pkg/config" //nolint:depguard
+)
+
+func TestConfig_MigrationsTable(t *testing.T) {
+	tCases := []struct {
+		name   string
+		config config.Config
+		schema string
+		table  string
+	}{
+		{
+			name:   "defaults",
+			config: config.Config{},
+			schema: config.DefaultTableSchema,
+			table:  config.DefaultTableName,
+		},
+		{
+			name:   "custom schema",
+			config: config.Config{TableSchema: "migrations"},
+			schema: "migrations",
+			table:  config.DefaultTableName,
+		},
+		{
+			name:   "custom name",
+			config: config.Config{TableName: "schema_versions"},
+			schema: config.DefaultTableSchema,
+			table:  "schema_versions",
+		},
+		{
+			name:   "custom schema and name",
+			config: config.Config{TableSchema: "My Schema", TableName: `odd"name`},
+			schema: "My Schema",
+			table:  `odd"name`,
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			schema, table := tCase.config.MigrationsTable()
+			assert.Equal(t, tCase.schema, schema)
+			assert.Equal(t, tCase.table, table)
+		})
+	}
+}
+
+func TestConfig_Apply(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		cfg := config.Config{}
+		cfg.Apply()
+
+		assert.Equal(t, config.FormatSQL, cfg.Format)
+		assert.Equal(t, config.SQLLayoutSplit, cfg.SQLLayout)
+		assert.Equal(t, config.DefaultLockTimeout, cfg.LockTimeout)
+		assert.Equal(t, config.DefaultTableSchema, cfg.TableSchema)
+		assert.Equal(t, config.DefaultTableName, cfg.TableName)
+	})
+
+	t.Run("configuration file", func(t *testing.T) {
+		path := writeConfig(t, `
+migrator:
+  format: "golang"
+  table:
+    schema: "migrations"
+    name: "schema_versions"
+  lock:
+    timeout: "5s"
+`)
+		cfg := config.Config{}
+		require.NoError(t, cfg.ReadConfigFromFile(path))
+		cfg.Apply()
+
+		assert.Equal(t, config.FormatGolang, cfg.Format)
+		assert.Equal(t, 5*time.Second, cfg.LockTimeout)
+		schema, table := cfg.MigrationsTable()
+		assert.Equal(t, "migrations", schema)
+		assert.Equal(t, "schema_versions", table)
+	})
+
+	t.Run("flags take precedence over the configuration file", func(t *testing.T) {
+		path := writeConfig(t, `
+migrator:
+  table:
+    schema: "migrations"
+    name: "schema_versions"
+`)
+		cfg := config.Config{TableSchema: "flag_schema"}
+		require.NoError(t, cfg.ReadConfigFromFile(path))
+		cfg.Apply()
+
+		assert.Equal(t, "flag_schema", cfg.TableSchema)
+		assert.Equal(t, "schema_versions", cfg.TableName)
+	})
+
+	t.Run("environment variables in values", func(t *testing.T) {
+		t.Setenv("TEST_MIGRATOR_SCHEMA", "env_schema")
+		path := writeConfig(t, `
+migrator:
+  table:
+    schema: "${TEST_MIGRATOR_SCHEMA}"
+`)
+		cfg := config.Config{}
+		require.NoError(t, cfg.ReadConfigFromFile(path))
+		cfg.Apply()
+
+		assert.Equal(t, "env_schema", cfg.TableSchema)
+		assert.Equal(t, config.DefaultTableName, cfg.TableName)
+	})
+}
+
+func TestConfig_Apply_Vars(t *testing.T) {
+	t.Setenv("APP_ROLE", "env_role")
+	t.Setenv(config.EnvVarPrefix+"SCHEMA", "env_schema")
+	path := writeConfig(t, `
+migrator:
+  vars:
+    app_role: "${APP_ROLE}"
+    schema: "public"
+    Owner: "admin"
+`)
+	cfg := config.Config{}
+	require.NoError(t, cfg.SetVars([]string{"owner=flag_owner"}))
+	require.NoError(t, cfg.ReadConfigFromFile(path))
+	cfg.Apply()
+
+	assert.Equal(t, map[string]string{
+		// значения переменных шаблонов не раскрываются
+		"app_role": "${APP_ROLE}",
+		"schema":   "env_schema",
+		"owner":    "flag_owner",
+	}, cfg.Vars)
+}
+
+func TestConfig_Apply_Path(t *testing.T) {
+	tmpDir := t.TempDir()
+	for _, dir := range []string{"modules/billing/migrations", "modules/users/migrations"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(tmpDir, filepath.FromSlash(dir)), 0o755))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(tmpDir, "modules", "readme.md"), nil, 0o600))
+
+	tCases := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{
+			name:  "directory",
+			paths: []string{filepath.Join(tmpDir, "core"), filepath.Join(tmpDir, "modules", "*", "migrations")},
+			want:  filepath.Join(tmpDir, "core"),
+		},
+		{
+			name:  "first directory matched by a glob",
+			paths: []string{filepath.Join(tmpDir, "modules", "*", "migrations"), filepath.Join(tmpDir, "core")},
+			want:  filepath.Join(tmpDir, "modules", "billing", "migrations"),
+		},
+		{
+			name:  "glob without directories",
+			paths: []string{filepath.Join(tmpDir, "plugins", "*"), filepath.Join(tmpDir, "modules", "*.md")},
+		},
+		{
+			name:  "next path after a glob without directories",
+			paths: []string{filepath.Join(tmpDir, "plugins", "*"), filepath.Join(tmpDir, "core")},
+			want:  filepath.Join(tmpDir, "core"),
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			cfg := config.Config{Paths: tCase.paths}
+			cfg.Apply()
+			assert.Equal(t, tCase.want, cfg.Path)
+			assert.Equal(t, tCase.paths, cfg.MigrationPaths())
+		})
+	}
+}
+
+func TestConfig_ReadConfigFromFile_NotFound(t *testing.T) {
+	cfg := config.Config{}
+	err := cfg.ReadConfigFromFile(filepath.Join(t.TempDir(), "config.yml"))
+	assert.ErrorIs(t, err, config.ErrConfigurationFileNotFound)
+}
+
+// writeConfig - записывает файл конфигурации во временный каталог и возвращает его путь.
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+
+	return path
+}
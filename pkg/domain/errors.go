@@ -7,6 +7,8 @@ var (
 	ErrConnection = errors.New("unable to connect to database")
 	// ErrInvalidFormat - неверный формат миграции.
 	ErrInvalidFormat = errors.New("invalid migration format specified")
+	// ErrInvalidSQLLayout - неверная раскладка sql-миграции по файлам.
+	ErrInvalidSQLLayout = errors.New("invalid sql migration layout specified")
 
 	// ErrMigrationFileExists - файл миграции уже существует.
 	ErrMigrationFileExists = errors.New("migration file already exists")
@@ -32,4 +34,33 @@ it is possible that the application of migrations is running in parallel`)
 	ErrBuildProgramForMigrations = errors.New("error while building the program for migrations")
 	// ErrStartingProgramForMigrations - ошибка при запуске программы для миграций.
 	ErrStartingProgramForMigrations = errors.New("an error occurred while starting the program for migrations")
+	// ErrGoMigrationsRequireDSN - миграции на Go выполняются отдельной программой и требуют строку подключения.
+	ErrGoMigrationsRequireDSN = errors.New("go migrations are run by a separate program and require a DSN")
+	// ErrMigrationNotRegistered - функции миграции не зарегистрированы в приложении.
+	ErrMigrationNotRegistered = errors.New("migration is not registered in the application")
+	// ErrUnsupportedMigrateFunc - пользовательская функция миграции не поддерживается хранилищем.
+	ErrUnsupportedMigrateFunc = errors.New("custom migration function is not supported by the database backend")
+	// ErrNilMigrateFunc - пользовательская функция миграции не передана.
+	ErrNilMigrateFunc = errors.New("custom migration function is nil")
+	// ErrDirtyMigration - миграция осталась в незавершенном состоянии.
+	ErrDirtyMigration = errors.New("migration was interrupted and left the database in a dirty state, " +
+		"check the database and resolve it with the 'resolve' command")
+	// ErrMigrationNotFound - миграция не найдена в таблице миграций.
+	ErrMigrationNotFound = errors.New("migration not found in the migration table")
+	// ErrInvalidStatus - недопустимое состояние миграции.
+	ErrInvalidStatus = errors.New("invalid migration status")
+	// ErrMigrationsModified - файлы примененных миграций были изменены.
+	ErrMigrationsModified = errors.New("applied migrations have been modified on disk")
+	// ErrInvalidMigrations - в каталоге миграций найдены ошибки.
+	ErrInvalidMigrations = errors.New("migration directory is invalid")
+	// ErrMissingDownMigration - у откатываемых миграций нет файла отката.
+	ErrMissingDownMigration = errors.New("cannot roll back migrations whose files are missing " +
+		"(use --force to mark them as rolled back without running them)")
+	// ErrOutOfOrderMigrations - есть не примененные миграции с версией ниже последней примененной.
+	ErrOutOfOrderMigrations = errors.New("pending migrations have versions below the latest applied migration " +
+		"(use --allow-out-of-order to apply them)")
+	// ErrDependencyNotApplied - миграция зависит от миграции, которая не применена и не накатывается вместе с ней.
+	ErrDependencyNotApplied = errors.New("migrations require migrations that are neither applied nor applied with them")
+	// ErrDependentMigrations - от откатываемой миграции зависят примененные миграции.
+	ErrDependentMigrations = errors.New("cannot roll back migrations that applied migrations depend on")
 )
@@ -4,10 +4,78 @@ import (
 	"time"
 )
 
+// MigrationStatus - состояние миграции.
+type MigrationStatus string
+
+const (
+	// StatusPending - миграция зарегистрирована, но еще не применялась.
+	StatusPending MigrationStatus = "pending"
+	// StatusRunning - миграция выполняется (или процесс упал во время ее выполнения).
+	StatusRunning MigrationStatus = "running"
+	// StatusApplied - миграция применена.
+	StatusApplied MigrationStatus = "applied"
+	// StatusFailed - последняя попытка наката или отката завершилась ошибкой.
+	StatusFailed MigrationStatus = "failed"
+	// StatusRolledBack - миграция откачена.
+	StatusRolledBack MigrationStatus = "rolled_back"
+	// StatusOutdated - файл повторяемой миграции изменен после ее последнего наката.
+	StatusOutdated MigrationStatus = "outdated"
+)
+
 // Migration.
 type Migration struct {
-	Version   uint64    `json:"version"`
-	Name      string    `json:"name"`
-	IsApplied bool      `json:"isApplied"`
-	UpdateAt  time.Time `json:"updateAt"`
+	Version   uint64          `json:"version"`
+	Name      string          `json:"name"`
+	IsApplied bool            `json:"isApplied"`
+	Status    MigrationStatus `json:"status"`
+	Dirty     bool            `json:"dirty"`
+	UpdateAt  time.Time       `json:"updateAt"`
+	Checksum  string          `json:"checksum"`
+	// Missing - миграция применена, но ее файл отсутствует на диске (удален или переименован).
+	Missing bool `json:"missing,omitempty"`
+	// Tags - теги миграции (сохраняются при накате).
+	Tags []string `json:"tags,omitempty"`
+}
+
+// RepeatableMigration - повторяемая миграция (R_<имя>.sql).
+// Накатывается заново после версионных миграций при каждом изменении контрольной суммы.
+type RepeatableMigration struct {
+	Name      string          `json:"name"`
+	Checksum  string          `json:"checksum"`
+	Status    MigrationStatus `json:"status"`
+	AppliedAt time.Time       `json:"appliedAt"`
+}
+
+const (
+	// DirectionUp - накат миграции.
+	DirectionUp = "up"
+	// DirectionDown - откат миграции.
+	DirectionDown = "down"
+)
+
+// ExecutionOutcome - результат выполнения миграции.
+type ExecutionOutcome string
+
+const (
+	// OutcomeSuccess - миграция выполнена успешно.
+	OutcomeSuccess ExecutionOutcome = "success"
+	// OutcomeFailed - миграция завершилась ошибкой.
+	OutcomeFailed ExecutionOutcome = "failed"
+)
+
+// Execution - запись журнала выполнения миграции (накат или откат).
+type Execution struct {
+	ID          int64            `json:"id"`
+	Version     uint64           `json:"version"`
+	Name        string           `json:"name"`
+	Direction   string           `json:"direction"`
+	StartedAt   time.Time        `json:"startedAt"`
+	FinishedAt  time.Time        `json:"finishedAt"`
+	Duration    time.Duration    `json:"duration"`
+	Outcome     ExecutionOutcome `json:"outcome"`
+	Error       string           `json:"error"`
+	OSUser      string           `json:"osUser"`
+	DBRole      string           `json:"dbRole"`
+	Hostname    string           `json:"hostname"`
+	ToolVersion string           `json:"toolVersion"`
 }
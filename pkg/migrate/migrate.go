@@ -2,18 +2,19 @@ package migrate
 
 import (
 	"context"
-	"errors"
+	"database/sql"
 	"fmt"
+	"io/fs"
 	"time"
 
-	"github.com/jackc/pgx/v4" //nolint:depguard
+	"github.com/jackc/pgx/v4"         //nolint:depguard
+	"github.com/jackc/pgx/v4/pgxpool" //nolint:depguard
 
 	"github.com/BashMS/SQL_migrator/internal/command" //nolint:depguard
 	"github.com/BashMS/SQL_migrator/internal/core"    //nolint:depguard
 	"github.com/BashMS/SQL_migrator/internal/storage" //nolint:depguard
 	"github.com/BashMS/SQL_migrator/pkg/config"       //nolint:depguard
 	"github.com/BashMS/SQL_migrator/pkg/domain"       //nolint:depguard
-	"github.com/BashMS/SQL_migrator/pkg/logger"       //nolint:depguard
 	"go.uber.org/zap"                                 //nolint:depguard
 )
 
@@ -24,34 +25,133 @@ const (
 	MigrationDown = false
 )
 
+// Диалекты пула соединений database/sql, переданного через WithDB.
+const (
+	DialectPostgres = "postgres"
+	DialectMySQL    = "mysql"
+	DialectSQLite   = "sqlite"
+)
+
 // CustomMigrateFunc - пользовательская функция для миграций.
 type CustomMigrateFunc func(ctx context.Context, tx pgx.Tx) error
 
+// NoTxMigrateFunc - пользовательская функция для миграций без транзакции
+// (CREATE INDEX CONCURRENTLY, VACUUM и т.п.). Каждый запрос фиксируется сразу.
+type NoTxMigrateFunc func(ctx context.Context, conn *pgx.Conn) error
+
+// SQLMigrateFunc - пользовательская функция для миграций через database/sql.
+// Функция не должна фиксировать транзакцию: это делает мигратор.
+type SQLMigrateFunc func(ctx context.Context, tx *sql.Tx) error
+
+// SQLNoTxMigrateFunc - пользовательская функция для миграций без транзакции через database/sql.
+// Каждый запрос фиксируется сразу; соединение не закрывается функцией.
+type SQLNoTxMigrateFunc func(ctx context.Context, conn *sql.Conn) error
+
 // Migrate.
 type Migrate interface {
 	Create(name string) error
 	Status(ctx context.Context) ([]domain.Migration, error)
+	RepeatableStatus(ctx context.Context) ([]domain.RepeatableMigration, error)
 	Up(ctx context.Context, requestToVersion uint64) (int, error)
 	DownAll(ctx context.Context) (int, error)
 	Down(ctx context.Context, requestToVersion uint64) (int, error)
 	Redo(ctx context.Context) (*domain.Migration, error)
 	RunMigrationWithCustomFunc(ctx context.Context,
 		migrateFunc CustomMigrateFunc, name string, version uint64, direction bool) error
+	RunCustomMigration(ctx context.Context,
+		migrateFunc CustomMigrateFunc, migration domain.Migration, direction bool) error
+	RunSQLMigration(ctx context.Context,
+		migrateFunc SQLMigrateFunc, migration domain.Migration, direction bool) error
+	RunNoTxMigration(ctx context.Context,
+		migrateFunc NoTxMigrateFunc, migration domain.Migration, direction bool) error
+	RunSQLNoTxMigration(ctx context.Context,
+		migrateFunc SQLNoTxMigrateFunc, migration domain.Migration, direction bool) error
 	MigrateVersion(ctx context.Context) (*domain.Migration, error)
+	Verify(ctx context.Context) ([]domain.Migration, error)
+	Validate(ctx context.Context) ([]error, error)
+	Resolve(ctx context.Context, version uint64, status domain.MigrationStatus) error
+	History(ctx context.Context, version uint64, limit int) ([]domain.Execution, error)
 }
 
 type migrate struct {
 	migrateCore *core.MigrateCore
-	logger      *zap.Logger
 	config      *config.Config
 }
 
+// Option - дополнительная настройка мигратора.
+type Option func(o *options)
+
+type options struct {
+	pool    *pgxpool.Pool
+	conn    *pgx.Conn
+	db      *sql.DB
+	dialect string
+	fsys    fs.FS
+}
+
+// WithPool - выполнять миграции через пул соединений приложения вместо подключения по DSN.
+// Пул не закрывается мигратором.
+func WithPool(pool *pgxpool.Pool) Option {
+	return func(o *options) {
+		o.pool = pool
+	}
+}
+
+// WithConn - выполнять миграции через соединение приложения вместо подключения по DSN.
+// Соединение не закрывается мигратором.
+func WithConn(conn *pgx.Conn) Option {
+	return func(o *options) {
+		o.conn = conn
+	}
+}
+
+// WithDB - выполнять миграции через пул соединений database/sql приложения.
+// dialect - СУБД пула: DialectPostgres, DialectMySQL или DialectSQLite. Пул не закрывается мигратором.
+func WithDB(db *sql.DB, dialect string) Option {
+	return func(o *options) {
+		o.db = db
+		o.dialect = dialect
+	}
+}
+
+// WithFS - загружать миграции из fsys (например, embed.FS) вместо каталога migrator.path.
+// Для встроенного каталога передается fs.Sub(migrations, "migrations"). Команда Create по-прежнему
+// создает файлы в каталоге migrator.path.
+func WithFS(fsys fs.FS) Option {
+	return func(o *options) {
+		o.fsys = fsys
+	}
+}
+
 // NewMigrate конструктор.
-func NewMigrate(zLogger *zap.Logger, config *config.Config) Migrate {
-	migrateStorage := storage.NewStorage(zLogger, config)
+func NewMigrate(zLogger *zap.Logger, config *config.Config, opts ...Option) Migrate {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	var migrateStorage storage.MigrateStorage
+	switch {
+	case o.pool != nil:
+		migrateStorage = storage.NewStorageWithPool(zLogger, config, o.pool)
+	case o.conn != nil:
+		migrateStorage = storage.NewStorageWithConn(zLogger, config, o.conn)
+	case o.db != nil:
+		migrateStorage = storage.NewStorageWithDB(zLogger, config, o.db, o.dialect)
+	default:
+		migrateStorage = storage.NewStorage(zLogger, config)
+	}
+
+	migrateCore := core.NewMigrateCore(migrateStorage, command.NewCommand(), zLogger, config)
+	if o.fsys != nil {
+		migrateCore.SetFS(o.fsys)
+	}
+	if registered := registeredMigrations(); len(registered) != 0 {
+		migrateCore.SetRegistered(registered)
+	}
+
 	return &migrate{
-		migrateCore: core.NewMigrateCore(migrateStorage, command.NewCommand(), zLogger, config),
-		logger:      zLogger.Named(logger.ConsoleLogger),
+		migrateCore: migrateCore,
 		config:      config,
 	}
 }
@@ -72,16 +172,49 @@ func (m *migrate) Up(ctx context.Context, requestToVersion uint64) (int, error)
 	}
 	defer closeFunc()
 
+	unlockFunc, err := m.migrateCore.Lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlockFunc()
+
+	if err := m.migrateCore.CheckDirty(ctx); err != nil {
+		return 0, err
+	}
+
+	if err := m.migrateCore.ReportMissingMigrations(ctx); err != nil {
+		return 0, err
+	}
+
+	if !m.config.AllowModified {
+		if err := m.migrateCore.CheckModified(ctx); err != nil {
+			return 0, err
+		}
+	}
+
 	neededMigrations, err := m.migrateCore.LoadMigrations(ctx, requestToVersion, MigrationUp)
 	if err != nil {
 		return 0, err
 	}
 
-	if len(neededMigrations) == 0 {
-		return 0, nil
+	var count int
+	if len(neededMigrations) != 0 {
+		if count, err = m.migrateCore.StartMigrate(ctx, neededMigrations, MigrationUp); err != nil {
+			return count, err
+		}
 	}
 
-	return m.migrateCore.StartMigrate(ctx, neededMigrations, MigrationUp)
+	// повторяемые миграции накатываются только при накате до последней версии
+	if requestToVersion != 0 {
+		return count, nil
+	}
+	repeatableMigrations, err := m.migrateCore.LoadRepeatableMigrations(ctx)
+	if err != nil {
+		return count, err
+	}
+	repeatableCount, err := m.migrateCore.StartRepeatableMigrate(ctx, repeatableMigrations)
+
+	return count + repeatableCount, err
 }
 
 // Down - откатить все миграции.
@@ -93,6 +226,20 @@ func (m *migrate) DownAll(ctx context.Context) (int, error) {
 	}
 	defer closeFunc()
 
+	unlockFunc, err := m.migrateCore.Lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlockFunc()
+
+	if err := m.migrateCore.CheckDirty(ctx); err != nil {
+		return 0, err
+	}
+
+	if err := m.migrateCore.ReportMissingMigrations(ctx); err != nil {
+		return 0, err
+	}
+
 	neededMigrations, err := m.migrateCore.LoadMigrations(ctx, 0, MigrationDown)
 	if err != nil {
 		return 0, err
@@ -114,8 +261,22 @@ func (m *migrate) Down(ctx context.Context, requestToVersion uint64) (int, error
 	}
 	defer closeFunc()
 
+	unlockFunc, err := m.migrateCore.Lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer unlockFunc()
+
+	if err := m.migrateCore.CheckDirty(ctx); err != nil {
+		return 0, err
+	}
+
+	if err := m.migrateCore.ReportMissingMigrations(ctx); err != nil {
+		return 0, err
+	}
+
 	if requestToVersion == 0 {
-		migration, err := m.migrateCore.GetRecentMigration(ctx)
+		migration, err := m.migrateCore.GetLastAppliedMigration(ctx)
 		if err != nil || migration == nil {
 			return 0, err
 		}
@@ -142,7 +303,21 @@ func (m *migrate) Redo(ctx context.Context) (*domain.Migration, error) {
 	}
 	defer closeFunc()
 
-	migration, err := m.migrateCore.GetRecentMigration(ctx)
+	unlockFunc, err := m.migrateCore.Lock(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockFunc()
+
+	if err := m.migrateCore.CheckDirty(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := m.migrateCore.ReportMissingMigrations(ctx); err != nil {
+		return nil, err
+	}
+
+	migration, err := m.migrateCore.GetLastAppliedMigration(ctx)
 	if err != nil || migration == nil {
 		return nil, err
 	}
@@ -204,6 +379,62 @@ func (m *migrate) Status(ctx context.Context) ([]domain.Migration, error) {
 	return m.migrateCore.GetMigrations(ctx)
 }
 
+// RepeatableStatus - возвращает состояние повторяемых миграций (pending, applied или outdated).
+func (m *migrate) RepeatableStatus(ctx context.Context) ([]domain.RepeatableMigration, error) {
+	closeFunc, err := m.migrateCore.ConnectDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFunc()
+
+	return m.migrateCore.GetRepeatableMigrations(ctx)
+}
+
+// Resolve - вручную устанавливает состояние миграции (applied или rolled_back) и снимает отметку dirty,
+// после того как база данных была приведена в порядок.
+func (m *migrate) Resolve(ctx context.Context, version uint64, status domain.MigrationStatus) error {
+	closeFunc, err := m.migrateCore.ConnectDB(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeFunc()
+
+	unlockFunc, err := m.migrateCore.Lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlockFunc()
+
+	return m.migrateCore.ResolveMigration(ctx, version, status)
+}
+
+// History - возвращает журнал выполнения миграций (всех, если version равна 0), начиная с последних записей.
+func (m *migrate) History(ctx context.Context, version uint64, limit int) ([]domain.Execution, error) {
+	closeFunc, err := m.migrateCore.ConnectDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFunc()
+
+	return m.migrateCore.GetExecutions(ctx, version, limit)
+}
+
+// Verify - возвращает примененные миграции, файлы которых были изменены после наката.
+func (m *migrate) Verify(ctx context.Context) ([]domain.Migration, error) {
+	closeFunc, err := m.migrateCore.ConnectDB(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFunc()
+
+	return m.migrateCore.VerifyMigrations(ctx)
+}
+
+// Validate - проверяет каталог миграций без подключения к БД и возвращает все найденные проблемы.
+func (m *migrate) Validate(ctx context.Context) ([]error, error) {
+	return m.migrateCore.ValidateMigrations(ctx)
+}
+
 // RunMigrationWithCustomFunc - запускает миграцию с помощью пользовательской функции.
 func (m *migrate) RunMigrationWithCustomFunc(
 	ctx context.Context,
@@ -212,25 +443,108 @@ func (m *migrate) RunMigrationWithCustomFunc(
 	version uint64,
 	direction bool,
 ) error {
-	closeFunc, err := m.migrateCore.ConnectDB(ctx)
-	if err != nil {
-		return err
+	return m.RunCustomMigration(ctx, migrateFunc, domain.Migration{Version: version, Name: name}, direction)
+}
+
+// RunCustomMigration - запускает миграцию с помощью пользовательской функции
+// (с сохранением контрольной суммы миграции). Функция сама фиксирует транзакцию.
+func (m *migrate) RunCustomMigration(
+	ctx context.Context,
+	migrateFunc CustomMigrateFunc,
+	migration domain.Migration,
+	direction bool,
+) error {
+	if migrateFunc == nil {
+		return domain.ErrNilMigrateFunc
 	}
-	defer closeFunc()
-	tx, err := m.migrateCore.CreateTransactionalMigration(ctx, domain.Migration{Version: version, Name: name}, direction)
-	if err != nil {
-		if errors.Is(err, storage.ErrQueryNoAffectRows) {
-			return nil
+	runFunc := pgxMigrationFunc(migrateFunc)
+	return m.runMigrationFunc(ctx, migration, direction, false, func(tx storage.Tx) error {
+		return runFunc(ctx, tx)
+	})
+}
+
+// RunSQLMigration - запускает миграцию с помощью пользовательской функции database/sql.
+// Транзакцию фиксирует мигратор после успешного выполнения функции.
+func (m *migrate) RunSQLMigration(
+	ctx context.Context,
+	migrateFunc SQLMigrateFunc,
+	migration domain.Migration,
+	direction bool,
+) error {
+	if migrateFunc == nil {
+		return domain.ErrNilMigrateFunc
+	}
+	runFunc := sqlMigrationFunc(migrateFunc)
+	return m.runMigrationFunc(ctx, migration, direction, false, func(tx storage.Tx) error {
+		return runFunc(ctx, tx)
+	})
+}
+
+// RunNoTxMigration - запускает миграцию с помощью пользовательской функции без транзакции.
+// Конечное состояние миграции записывается после успешного выполнения функции,
+// а при ошибке миграция остается в состоянии dirty до ручного разрешения командой resolve.
+func (m *migrate) RunNoTxMigration(
+	ctx context.Context,
+	migrateFunc NoTxMigrateFunc,
+	migration domain.Migration,
+	direction bool,
+) error {
+	if migrateFunc == nil {
+		return domain.ErrNilMigrateFunc
+	}
+	return m.runMigrationFunc(ctx, migration, direction, true, func(tx storage.Tx) error {
+		conn, ok := storage.PgxConn(tx)
+		if !ok {
+			return domain.ErrUnsupportedMigrateFunc
+		}
+		if err := migrateFunc(ctx, conn); err != nil {
+			return err
 		}
 
-		return err
+		return tx.Commit(ctx)
+	})
+}
+
+// RunSQLNoTxMigration - запускает миграцию с помощью пользовательской функции database/sql без транзакции.
+// Конечное состояние миграции записывается после успешного выполнения функции,
+// а при ошибке миграция остается в состоянии dirty до ручного разрешения командой resolve.
+func (m *migrate) RunSQLNoTxMigration(
+	ctx context.Context,
+	migrateFunc SQLNoTxMigrateFunc,
+	migration domain.Migration,
+	direction bool,
+) error {
+	if migrateFunc == nil {
+		return domain.ErrNilMigrateFunc
 	}
-	sDirection := "Down"
-	if direction {
-		sDirection = "Up"
+	return m.runMigrationFunc(ctx, migration, direction, true, func(tx storage.Tx) error {
+		conn, ok := storage.SQLConn(tx)
+		if !ok {
+			return domain.ErrUnsupportedMigrateFunc
+		}
+		if err := migrateFunc(ctx, conn); err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	})
+}
+
+// runMigrationFunc - выполняет функцию миграции в транзакции миграции (или без нее) с записью в журнал.
+func (m *migrate) runMigrationFunc(
+	ctx context.Context,
+	migration domain.Migration,
+	direction bool,
+	noTransaction bool,
+	runFunc func(tx storage.Tx) error,
+) error {
+	closeFunc, err := m.migrateCore.ConnectDB(ctx)
+	if err != nil {
+		return err
 	}
+	defer closeFunc()
 
-	m.logger.Info(fmt.Sprintf("running %s migration with version %d (%s) ...", name, version, sDirection))
+	_, err = m.migrateCore.RunMigrationFunc(ctx, migration, direction, noTransaction, runFunc)
 
-	return migrateFunc(ctx, tx)
+	return err
 }
@@ -0,0 +1,184 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v4"             //nolint:depguard
+	"github.com/stretchr/testify/assert"  //nolint:depguard
+	"github.com/stretchr/testify/require" //nolint:depguard
+	"go.uber.org/zap/zaptest"             //nolint:depguard
+
+	"github.com/BashMS/SQL_migrator/pkg/config"  //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"  //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/migrate" //nolint:depguard
+)
+
+func TestMigrate_RunSQLNoTxMigration(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migration.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator := migrate.NewMigrate(zaptest.NewLogger(t), &config.Config{}, migrate.WithDB(db, migrate.DialectSQLite))
+
+	// up: запросы выполняются в соединении без транзакции
+	migration := domain.Migration{Version: 1, Name: "vacuum"}
+	err = migrator.RunSQLNoTxMigration(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE "test_table" (id INTEGER);`); err != nil {
+			return err
+		}
+		_, err := conn.ExecContext(ctx, `VACUUM;`)
+		return err
+	}, migration, migrate.MigrationUp)
+	require.NoError(t, err)
+
+	status, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	assert.Equal(t, domain.StatusApplied, status[0].Status)
+	assert.False(t, status[0].Dirty)
+
+	// failed down: выполненные запросы не отменяются, миграция остается dirty
+	errDown := errors.New("down failed")
+	err = migrator.RunSQLNoTxMigration(ctx, func(ctx context.Context, conn *sql.Conn) error {
+		if _, err := conn.ExecContext(ctx, `DROP TABLE "test_table";`); err != nil {
+			return err
+		}
+		return errDown
+	}, migration, migrate.MigrationDown)
+	require.ErrorIs(t, err, errDown)
+
+	status, err = migrator.Status(ctx)
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	assert.Equal(t, domain.StatusFailed, status[0].Status)
+	assert.True(t, status[0].Dirty)
+
+	// функции pgx недоступны при работе через database/sql
+	err = migrator.RunNoTxMigration(ctx, func(context.Context, *pgx.Conn) error {
+		return nil
+	}, domain.Migration{Version: 2, Name: "pgx"}, migrate.MigrationUp)
+	assert.ErrorIs(t, err, domain.ErrUnsupportedMigrateFunc)
+}
+
+func TestMigrate_RunMigration_NilFunc(t *testing.T) {
+	ctx := context.Background()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migration.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	migrator := migrate.NewMigrate(zaptest.NewLogger(t), &config.Config{}, migrate.WithDB(db, migrate.DialectSQLite))
+	migration := domain.Migration{Version: 1, Name: "nil_func"}
+
+	tCases := []struct {
+		name string
+		run  func() error
+	}{
+		{
+			name: "custom migration",
+			run: func() error {
+				return migrator.RunCustomMigration(ctx, nil, migration, migrate.MigrationUp)
+			},
+		},
+		{
+			name: "sql migration",
+			run: func() error {
+				return migrator.RunSQLMigration(ctx, nil, migration, migrate.MigrationUp)
+			},
+		},
+		{
+			name: "no transaction migration",
+			run: func() error {
+				return migrator.RunNoTxMigration(ctx, nil, migration, migrate.MigrationUp)
+			},
+		},
+		{
+			name: "sql no transaction migration",
+			run: func() error {
+				return migrator.RunSQLNoTxMigration(ctx, nil, migration, migrate.MigrationDown)
+			},
+		},
+	}
+
+	for _, tCase := range tCases {
+		t.Run(tCase.name, func(t *testing.T) {
+			assert.ErrorIs(t, tCase.run(), domain.ErrNilMigrateFunc)
+
+			// транзакция не открывалась, запись о миграции не создана
+			status, err := migrator.Status(ctx)
+			require.NoError(t, err)
+			assert.Empty(t, status)
+		})
+	}
+}
+
+func TestMigrate_DownRedo_Dependencies(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	// миграция 2 из другой ветки зависит от более поздней миграции 4: миграции накатываются в порядке 1, 3, 4, 2
+	files := map[string]string{
+		"1_first.sql": "-- +migrate Up\nCREATE TABLE first (id INTEGER);\n-- +migrate Down\nDROP TABLE first;\n",
+		"2_second.sql": "-- +migrate Requires 4\n-- +migrate Up\nCREATE TABLE second (id INTEGER);\n" +
+			"-- +migrate Down\nDROP TABLE second;\n",
+		"3_third.sql":  "-- +migrate Up\nCREATE TABLE third (id INTEGER);\n-- +migrate Down\nDROP TABLE third;\n",
+		"4_fourth.sql": "-- +migrate Up\nCREATE TABLE fourth (id INTEGER);\n-- +migrate Down\nDROP TABLE fourth;\n",
+	}
+	for name, content := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+	}
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "migration.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// после отката миграция 2 накатывается снова, хотя ее версия ниже последней примененной
+	cfg := &config.Config{Path: dir, Format: config.FormatSQL, AllowOutOfOrder: true}
+	migrator := migrate.NewMigrate(zaptest.NewLogger(t), cfg, migrate.WithDB(db, migrate.DialectSQLite))
+	applied := func() []uint64 {
+		t.Helper()
+		status, err := migrator.Status(ctx)
+		require.NoError(t, err)
+		var versions []uint64
+		for _, migration := range status {
+			if migration.IsApplied {
+				versions = append(versions, migration.Version)
+			}
+		}
+		return versions
+	}
+
+	count, err := migrator.Up(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	// последней накатывалась миграция 2, а не миграция с наибольшей версией
+	migration, err := migrator.Redo(ctx)
+	require.NoError(t, err)
+	if assert.NotNil(t, migration) {
+		assert.Equal(t, uint64(2), migration.Version)
+	}
+	assert.ElementsMatch(t, []uint64{1, 2, 3, 4}, applied())
+
+	count, err = migrator.Down(ctx, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.ElementsMatch(t, []uint64{1, 3, 4}, applied())
+
+	// откат до версии 2 не затрагивает миграции 3 и 4, накатанные раньше нее
+	_, err = migrator.Up(ctx, 0)
+	require.NoError(t, err)
+	count, err = migrator.Down(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, 1, count)
+	assert.ElementsMatch(t, []uint64{1, 3, 4}, applied())
+
+	// откат до версии 3 откатывает и накатанную после нее миграцию 4
+	count, err = migrator.Down(ctx, 3)
+	require.NoError(t, err)
+	assert.Equal(t, 2, count)
+	assert.ElementsMatch(t, []uint64{1}, applied())
+}
@@ -0,0 +1,114 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/BashMS/SQL_migrator/internal/core"    //nolint:depguard
+	"github.com/BashMS/SQL_migrator/internal/storage" //nolint:depguard
+	"github.com/BashMS/SQL_migrator/pkg/domain"       //nolint:depguard
+)
+
+// registry - миграции на Go, зарегистрированные в приложении функциями Register и RegisterSQL.
+var registry = struct {
+	sync.Mutex
+	migrations map[uint64]core.RegisteredMigration
+}{migrations: make(map[uint64]core.RegisteredMigration)}
+
+// Register - регистрирует миграцию на Go, скомпилированную в приложение (обычно вызывается в init пакета миграций).
+// Мигратор, созданный NewMigrate после регистрации, выполняет такие миграции в своем процессе без сборки
+// программы миграций: Up, Down и Redo - вместе с файлами миграций в порядке версий и с записью в журнал,
+// а Status показывает их наравне с остальными. Как и в RunCustomMigration, функции сами фиксируют транзакцию.
+// down может быть nil, тогда откат только отмечается в таблице миграций.
+// Нулевая версия, пустое имя, up == nil и повторная регистрация версии - ошибка программы (panic).
+func Register(version uint64, name string, up, down CustomMigrateFunc) {
+	if up == nil {
+		panic(fmt.Sprintf("migrate: up function of migration %d (%s) is nil", version, name))
+	}
+	register(core.RegisteredMigration{
+		Version: version,
+		Name:    name,
+		Up:      pgxMigrationFunc(up),
+		Down:    pgxMigrationFunc(down),
+	})
+}
+
+// RegisterSQL - регистрирует миграцию на Go с функциями database/sql (для пула WithDB), как Register.
+// Транзакцию фиксирует мигратор после успешного выполнения функции.
+func RegisterSQL(version uint64, name string, up, down SQLMigrateFunc) {
+	if up == nil {
+		panic(fmt.Sprintf("migrate: up function of migration %d (%s) is nil", version, name))
+	}
+	register(core.RegisteredMigration{
+		Version: version,
+		Name:    name,
+		Up:      sqlMigrationFunc(up),
+		Down:    sqlMigrationFunc(down),
+	})
+}
+
+// register - добавляет миграцию в registry.
+func register(migration core.RegisteredMigration) {
+	if migration.Version == 0 || migration.Name == "" {
+		panic(fmt.Sprintf("migrate: migration %d (%s) must have a version greater than 0 and a name",
+			migration.Version, migration.Name))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	if existing, ok := registry.migrations[migration.Version]; ok {
+		panic(fmt.Sprintf("migrate: migration version %d is registered twice (%s and %s)",
+			migration.Version, existing.Name, migration.Name))
+	}
+	registry.migrations[migration.Version] = migration
+}
+
+// registeredMigrations - возвращает миграции, зарегистрированные к текущему моменту.
+func registeredMigrations() []core.RegisteredMigration {
+	registry.Lock()
+	defer registry.Unlock()
+
+	migrations := make([]core.RegisteredMigration, 0, len(registry.migrations))
+	for _, migration := range registry.migrations {
+		migrations = append(migrations, migration)
+	}
+
+	return migrations
+}
+
+// pgxMigrationFunc - адаптирует пользовательскую функцию pgx к транзакции мигратора.
+func pgxMigrationFunc(migrateFunc CustomMigrateFunc) core.MigrationFunc {
+	if migrateFunc == nil {
+		return nil
+	}
+
+	return func(ctx context.Context, tx storage.Tx) error {
+		pgxTx, ok := storage.PgxTx(tx)
+		if !ok {
+			return domain.ErrUnsupportedMigrateFunc
+		}
+
+		return migrateFunc(ctx, pgxTx)
+	}
+}
+
+// sqlMigrationFunc - адаптирует пользовательскую функцию database/sql к транзакции мигратора
+// и фиксирует транзакцию после ее успешного выполнения.
+func sqlMigrationFunc(migrateFunc SQLMigrateFunc) core.MigrationFunc {
+	if migrateFunc == nil {
+		return nil
+	}
+
+	return func(ctx context.Context, tx storage.Tx) error {
+		sqlTx, ok := storage.SQLTx(tx)
+		if !ok {
+			return domain.ErrUnsupportedMigrateFunc
+		}
+		if err := migrateFunc(ctx, sqlTx); err != nil {
+			return err
+		}
+
+		return tx.Commit(ctx)
+	}
+}
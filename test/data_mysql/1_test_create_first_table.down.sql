@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `test_first_table`;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS `test_second_table`;
\ No newline at end of file
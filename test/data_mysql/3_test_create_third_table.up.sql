@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS `test_third_table` (id INT);
\ No newline at end of file
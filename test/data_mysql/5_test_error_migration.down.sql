@@ -0,0 +1 @@
+SELECT Bad_Migratiom FORM MORF;
\ No newline at end of file
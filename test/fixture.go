@@ -14,10 +14,16 @@ func GetMigrationByVersion(version uint64, isApplied bool) domain.Migration {
 		return domain.Migration{}
 	}
 
+	status := domain.StatusPending
+	if isApplied {
+		status = domain.StatusApplied
+	}
+
 	return domain.Migration{
 		Version:   version,
 		Name:      GetRawMigrationByVersion(version).Name,
 		IsApplied: isApplied,
+		Status:    status,
 		UpdateAt:  time.Time{},
 	}
 }
@@ -37,6 +43,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 				Format:    config.FormatSQL,
 				QueryUp:   `CREATE TABLE IF NOT EXISTS "test_first_table"();`,
 				QueryDown: `DROP TABLE IF EXISTS "test_first_table";`,
+				Checksum:  "53dc3f932eab07d37f4a5a7e54e353d0f62c27dbf8f7d951edfb16e02a71aa9a",
 			},
 			{
 				Version:   2,
@@ -46,6 +53,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 				Format:    config.FormatSQL,
 				QueryUp:   `CREATE TABLE IF NOT EXISTS "test_second_table"();`,
 				QueryDown: `DROP TABLE IF EXISTS "test_second_table";`,
+				Checksum:  "250d30bf368305dfc03a93c344b6fd8fdef92850d785ed7f868007d89902ec24",
 			},
 			{
 				Version:   3,
@@ -55,6 +63,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 				Format:    config.FormatSQL,
 				QueryUp:   `CREATE TABLE IF NOT EXISTS "test_third_table"();`,
 				QueryDown: `DROP TABLE IF EXISTS "test_third_table";`,
+				Checksum:  "e01782d103a6d7cef3d776fd09530c578d18548628bb99219f2801b9d1bc32cf",
 			},
 			{
 				Version:   4,
@@ -64,6 +73,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 				Format:    config.FormatSQL,
 				QueryUp:   "",
 				QueryDown: "",
+				Checksum:  "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
 			},
 			{
 				Version:   5,
@@ -73,6 +83,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 				Format:    config.FormatSQL,
 				QueryUp:   `SELECT Bad_Migratiom FORM MORF;`,
 				QueryDown: `SELECT Bad_Migratiom FORM MORF;`,
+				Checksum:  "5fe730556cd22e09f9a1247663b518fa8071e620403c48be483b3d40450d2b2b",
 			},
 		}
 	}
@@ -86,6 +97,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 			Format:    config.FormatSQL,
 			QueryUp:   `SELECT Bad_Migratiom FORM MORF;`,
 			QueryDown: `SELECT Bad_Migratiom FORM MORF;`,
+			Checksum:  "5fe730556cd22e09f9a1247663b518fa8071e620403c48be483b3d40450d2b2b",
 		},
 		{
 			Version:   4,
@@ -95,6 +107,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 			Format:    config.FormatSQL,
 			QueryUp:   "",
 			QueryDown: "",
+			Checksum:  "6e340b9cffb37a989ca544e6bb780a2c78901d3fb33738768511a30617afa01d",
 		},
 		{
 			Version:   3,
@@ -104,6 +117,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 			Format:    config.FormatSQL,
 			QueryUp:   `CREATE TABLE IF NOT EXISTS "test_third_table"();`,
 			QueryDown: `DROP TABLE IF EXISTS "test_third_table";`,
+			Checksum:  "e01782d103a6d7cef3d776fd09530c578d18548628bb99219f2801b9d1bc32cf",
 		},
 		{
 			Version:   2,
@@ -113,6 +127,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 			Format:    config.FormatSQL,
 			QueryUp:   `CREATE TABLE IF NOT EXISTS "test_second_table"();`,
 			QueryDown: `DROP TABLE IF EXISTS "test_second_table";`,
+			Checksum:  "250d30bf368305dfc03a93c344b6fd8fdef92850d785ed7f868007d89902ec24",
 		},
 		{
 			Version:   1,
@@ -122,6 +137,7 @@ func RawSQLMigrations(cfg *config.Config, direction bool) []loader.RawMigration
 			Format:    config.FormatSQL,
 			QueryUp:   `CREATE TABLE IF NOT EXISTS "test_first_table"();`,
 			QueryDown: `DROP TABLE IF EXISTS "test_first_table";`,
+			Checksum:  "53dc3f932eab07d37f4a5a7e54e353d0f62c27dbf8f7d951edfb16e02a71aa9a",
 		},
 	}
 }
@@ -135,6 +151,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 				PathUp:   filepath.Join(cfg.Path, "1_test_create_first_table.go"),
 				PathDown: filepath.Join(cfg.Path, "1_test_create_first_table.go"),
 				Format:   config.FormatGolang,
+				Checksum: "381eb41b230be2549045228910805751f9f56dee03cb3f2f42e3c6b27e49566a",
 			},
 			{
 				Version:  2,
@@ -142,6 +159,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 				PathUp:   filepath.Join(cfg.Path, "2_test_create_second_table.go"),
 				PathDown: filepath.Join(cfg.Path, "2_test_create_second_table.go"),
 				Format:   config.FormatGolang,
+				Checksum: "60aead0c5268cfa44bacc14cc59c38293c3f332abfd3af6d4163448ee18267d9",
 			},
 			{
 				Version:  3,
@@ -149,6 +167,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 				PathUp:   filepath.Join(cfg.Path, "third_table/3_test_create_third_table.go"),
 				PathDown: filepath.Join(cfg.Path, "third_table/3_test_create_third_table.go"),
 				Format:   config.FormatGolang,
+				Checksum: "c47486ea1cafbcf24fbef0b6d8b7d15d08daa1a69bea02589c6bba579193094b",
 			},
 			{
 				Version:  4,
@@ -156,6 +175,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 				PathUp:   filepath.Join(cfg.Path, "4_test_empty_migration.go"),
 				PathDown: filepath.Join(cfg.Path, "4_test_empty_migration.go"),
 				Format:   config.FormatGolang,
+				Checksum: "aabbda139c467be89148825f79b774f76fc16f8d64648d0b79eabfe30ef08066",
 			},
 			{
 				Version:  5,
@@ -163,6 +183,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 				PathUp:   filepath.Join(cfg.Path, "5_test_error_migration.go"),
 				PathDown: filepath.Join(cfg.Path, "5_test_error_migration.go"),
 				Format:   config.FormatGolang,
+				Checksum: "98d29923da16f5b9ac58a9a45f15653a82abecc78b98f85a348a1284ca480d74",
 			},
 		}
 	}
@@ -174,6 +195,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 			PathUp:   filepath.Join(cfg.Path, "5_test_error_migration.go"),
 			PathDown: filepath.Join(cfg.Path, "5_test_error_migration.go"),
 			Format:   config.FormatGolang,
+			Checksum: "98d29923da16f5b9ac58a9a45f15653a82abecc78b98f85a348a1284ca480d74",
 		},
 		{
 			Version:  4,
@@ -181,6 +203,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 			PathUp:   filepath.Join(cfg.Path, "4_test_empty_migration.go"),
 			PathDown: filepath.Join(cfg.Path, "4_test_empty_migration.go"),
 			Format:   config.FormatGolang,
+			Checksum: "aabbda139c467be89148825f79b774f76fc16f8d64648d0b79eabfe30ef08066",
 		},
 		{
 			Version:  3,
@@ -188,6 +211,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 			PathUp:   filepath.Join(cfg.Path, "third_table/3_test_create_third_table.go"),
 			PathDown: filepath.Join(cfg.Path, "third_table/3_test_create_third_table.go"),
 			Format:   config.FormatGolang,
+			Checksum: "c47486ea1cafbcf24fbef0b6d8b7d15d08daa1a69bea02589c6bba579193094b",
 		},
 		{
 			Version:  2,
@@ -195,6 +219,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 			PathUp:   filepath.Join(cfg.Path, "2_test_create_second_table.go"),
 			PathDown: filepath.Join(cfg.Path, "2_test_create_second_table.go"),
 			Format:   config.FormatGolang,
+			Checksum: "60aead0c5268cfa44bacc14cc59c38293c3f332abfd3af6d4163448ee18267d9",
 		},
 		{
 			Version:  1,
@@ -202,6 +227,7 @@ func RawGoMigrations(cfg *config.Config, direction bool) []loader.RawMigration {
 			PathUp:   filepath.Join(cfg.Path, "1_test_create_first_table.go"),
 			PathDown: filepath.Join(cfg.Path, "1_test_create_first_table.go"),
 			Format:   config.FormatGolang,
+			Checksum: "381eb41b230be2549045228910805751f9f56dee03cb3f2f42e3c6b27e49566a",
 		},
 	}
 }
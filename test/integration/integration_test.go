@@ -149,6 +149,8 @@ func checkTable(ctx context.Context, conn *pgx.Conn, scheme, table string) (bool
 func clearDatabase(ctx context.Context, conn *pgx.Conn) error {
 	_, err := conn.Exec(ctx, `
 DROP TABLE IF EXISTS "public"."tmigration"; 
+DROP TABLE IF EXISTS "public"."tmigration_history";
+DROP TABLE IF EXISTS "public"."tmigration_meta";
 DROP TABLE IF EXISTS "public"."test_first_table";
 DROP TABLE IF EXISTS "public"."test_second_table";
 DROP TABLE IF EXISTS "public"."test_third_table";
@@ -0,0 +1,76 @@
+//go:build integration
+// +build integration
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap/zaptest"
+
+	"github.com/BashMS/SQL_migrator/pkg/config"
+	"github.com/BashMS/SQL_migrator/pkg/migrate"
+)
+
+// TestMigrator_WithPool - миграции через пул приложения с настройками по умолчанию:
+// в отличие от собственного пула мигратора, он использует расширенный протокол.
+func TestMigrator_WithPool(t *testing.T) {
+	conn, err := ConnectDB()
+	if err != nil {
+		t.Fatalf("failed to connect to database: %s", err)
+	}
+	defer CloseConnectDB(conn)
+	ctx, cancelFunc := context.WithTimeout(context.Background(), timeout)
+	defer cancelFunc()
+
+	fmt.Println("** Clear database **")
+	if err := clearDatabase(ctx, conn); err != nil {
+		t.Fatalf("failed to clear database: %s", err)
+	}
+
+	cfg := config.Config{}
+	filePath, err := filepath.Abs(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.ReadConfigFromFile(filePath); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Apply()
+	cfg.Path = "/src/test/data"
+	cfg.Format = config.FormatSQL
+
+	pool, err := pgxpool.Connect(ctx, cfg.DSN)
+	if err != nil {
+		t.Fatalf("failed to connect to database: %s", err)
+	}
+	defer pool.Close()
+	migrator := migrate.NewMigrate(zaptest.NewLogger(t), &cfg, migrate.WithPool(pool))
+
+	fmt.Println("** Rolling migrations up to version 3 through the application pool **")
+	if _, err := migrator.Up(ctx, 3); err != nil {
+		t.Fatalf("failed to roll migrations: %s", err)
+	}
+	assertTableExists(ctx, t, conn, "test_first_table")
+	assertTableExists(ctx, t, conn, "test_third_table")
+
+	fmt.Println("** Running the redo command through the application pool **")
+	if _, err := migrator.Redo(ctx); err != nil {
+		t.Fatalf("failed to redo migration: %s", err)
+	}
+	assertTableExists(ctx, t, conn, "test_third_table")
+
+	fmt.Println("** Rollback all migrations through the application pool **")
+	if _, err := migrator.Down(ctx, 1); err != nil {
+		t.Fatalf("failed to rollback migrations: %s", err)
+	}
+	assertTableNoExists(ctx, t, conn, "test_first_table")
+
+	if _, err := migrator.Status(ctx); err != nil {
+		t.Fatalf("failed to get status: %s", err)
+	}
+}